@@ -0,0 +1,144 @@
+package pubsub
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strings"
+)
+
+//TopicAccess is the persisted record of who can read a Topic.
+//
+//Public Topics can be read by any User. Private Topics can only be read by their
+// creator and the Users granted access as Readers
+type TopicAccess struct {
+	Topic   string
+	Private bool
+	//Readers holds the UsernameHash of the Users granted read access
+	Readers map[string]bool
+}
+
+//CanRead is whether the User can read the Topic by subscribing or streaming it.
+// A nil User is an anonymous SSE client and can only read public Topics
+func (topic *Topic) CanRead(user *User) bool {
+	topic.mu.RLock()
+	defer topic.mu.RUnlock()
+	if !topic.Private {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	return user.UUID == topic.Creator || topic.Readers[user.UsernameHash]
+}
+
+//SetTopicAccess changes who can read the Topic. Only the Topic creator can.
+//
+//Private is left unchanged if nil. Grant and revoke are lists of usernames to add to and
+// remove from the Readers. Users that can no longer read the Topic are unsubscribed from it.
+//
+//Returns the resulting access settings
+func (pubsub *PubSub) SetTopicAccess(topic *Topic, user *User, private *bool, grant, revoke []string) (TopicAccess, error) {
+	topic.mu.Lock()
+	if user.UUID != topic.Creator {
+		topic.mu.Unlock()
+		return TopicAccess{}, fmt.Errorf("only the Topic creator can change who can read it")
+	}
+	if private != nil {
+		topic.Private = *private
+	}
+	if topic.Readers == nil {
+		topic.Readers = make(map[string]bool)
+	}
+	for _, username := range grant {
+		if username = strings.TrimSpace(username); username != "" {
+			topic.Readers[usernameHash(username)] = true
+		}
+	}
+	for _, username := range revoke {
+		delete(topic.Readers, usernameHash(strings.TrimSpace(username)))
+	}
+	access := topic.access()
+	topic.mu.Unlock()
+
+	//public Topics with no Readers need no record
+	if !access.Private && len(access.Readers) == 0 {
+		dropTopicAccess(pubsub.persistLayer, access)
+	} else {
+		saveTopicAccess(pubsub.persistLayer, access)
+	}
+	pubsub.evictReaders(topic)
+	return access, nil
+}
+
+//saveTopicAccess sends the TopicAccess to be saved by the persist layer if it implements TopicAccessPersist
+func saveTopicAccess(persist Persist, access TopicAccess) {
+	if _, ok := persist.(TopicAccessPersist); ok {
+		persist.Switchboard().accessWriter <- access
+	}
+}
+
+//dropTopicAccess sends the TopicAccess to be deleted by the persist layer if it implements TopicAccessPersist
+func dropTopicAccess(persist Persist, access TopicAccess) {
+	if _, ok := persist.(TopicAccessPersist); ok {
+		persist.Switchboard().accessDeleter <- access
+	}
+}
+
+//access copies the Topic's access settings for persisting. Caller must hold topic.mu
+func (topic *Topic) access() TopicAccess {
+	access := TopicAccess{
+		Topic:   topic.Name,
+		Private: topic.Private,
+		Readers: make(map[string]bool, len(topic.Readers)),
+	}
+	for reader := range topic.Readers {
+		access.Readers[reader] = true
+	}
+	return access
+}
+
+//evictReaders unsubscribes the Users that can no longer read the Topic
+func (pubsub *PubSub) evictReaders(topic *Topic) {
+	type eviction struct {
+		usernameHash string
+		name         string
+	}
+	evictions := []eviction{}
+	topic.mu.RLock()
+	for _, subscribers := range topic.PointerPositions {
+		for _, sub := range subscribers {
+			if topic.Private && sub.ID != topic.Creator && !topic.Readers[sub.UsernameHash] {
+				evictions = append(evictions, eviction{sub.UsernameHash, sub.Name})
+			}
+		}
+	}
+	topic.mu.RUnlock()
+
+	for _, evict := range evictions {
+		pubsub.mu.RLock()
+		user, ok := pubsub.Users[evict.usernameHash]
+		pubsub.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		if err := user.Unsubscribe(topic, evict.name); err != nil {
+			log.Printf("error unsubscribing User without read access from Topic %s: %v\n", topic.Name, err)
+		}
+	}
+}
+
+//streamable is whether the User can stream the Topic of the given name over SSE.
+// Topics that do not exist yet can be streamed as they are public until made private
+func (pubsub *PubSub) streamable(topicName string, user *User) bool {
+	topic, err := pubsub.FetchTopic(topicName, user)
+	if err != nil {
+		return true
+	}
+	return topic.CanRead(user)
+}
+
+//usernameHash gives the User.UsernameHash of a username
+func usernameHash(username string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(username)))
+}
@@ -0,0 +1,25 @@
+package pubsub
+
+const (
+	//defaultBatchMaxMessages is the batch message limit used when a batching Subscriber does not set one
+	defaultBatchMaxMessages = 100
+	//defaultBatchMaxBytes is the batch size limit used when a batching Subscriber does not set one
+	defaultBatchMaxBytes = 1 << 20
+)
+
+//batching is whether the Subscriber receives push messages in batches
+func (subscriber *Subscriber) batching() bool {
+	return subscriber.BatchMaxMessages > 0 || subscriber.BatchMaxBytes > 0 || subscriber.BatchLinger > 0
+}
+
+//batchLimits gives the message count and byte size limits of a batch, using defaults for any unset
+func (subscriber *Subscriber) batchLimits() (maxMessages, maxBytes int) {
+	maxMessages, maxBytes = subscriber.BatchMaxMessages, subscriber.BatchMaxBytes
+	if maxMessages == 0 {
+		maxMessages = defaultBatchMaxMessages
+	}
+	if maxBytes == 0 {
+		maxBytes = defaultBatchMaxBytes
+	}
+	return maxMessages, maxBytes
+}
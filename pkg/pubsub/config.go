@@ -2,6 +2,8 @@ package pubsub
 
 import (
 	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,6 +14,38 @@ var (
 	adminPassword        string        // adminPassword is the password of the initial system user
 	//persistToDirPath gives the root directory location to which data should be persisted. Set by envar `PS_STORE`
 	persistToDirPath string
+	//pushConcurrency is the maximum number of webhook requests in flight at once. Set by envar `PS_PUSH_CONCURRENCY`
+	pushConcurrency int
+	//sseBufferSize is how many Messages each SSE client can fall behind by. Set by envar `PS_SSE_BUFFER`
+	sseBufferSize int
+	//sseOverflow is what happens to SSE clients that fall further behind. Set by envar `PS_SSE_OVERFLOW`
+	sseOverflow SSEOverflowPolicy
+	//sseOrigins are the origins allowed to open SSE streams, or `*` for any. Set by envar `PS_SSE_ORIGINS`
+	sseOrigins map[string]bool
+	//tokenSecret signs User tokens. Set by envar `PS_TOKEN_SECRET`
+	tokenSecret []byte
+	//tokenTTL is how long issued User tokens last. Set by envar `PS_TOKEN_TTL`
+	tokenTTL time.Duration
+	//grpcPort is the port the gRPC server listens on. Set by envar `PS_GRPC_PORT`
+	grpcPort int
+	//grpcEnabled starts the gRPC server, which is off by default. Set by envar `PS_GRPC_ENABLED`
+	grpcEnabled bool
+	//mqttPort is the port the MQTT listener accepts clients on. Set by envar `PS_MQTT_PORT`
+	mqttPort int
+	//mqttEnabled starts the MQTT listener, which is off by default. Set by envar `PS_MQTT_ENABLED`
+	mqttEnabled bool
+	//stompPort is the port the STOMP listener accepts clients on. Set by envar `PS_STOMP_PORT`
+	stompPort int
+	//stompEnabled starts the STOMP listener, which is off by default. Set by envar `PS_STOMP_ENABLED`
+	stompEnabled bool
+	//redisPort is the port the Redis listener accepts clients on. Set by envar `PS_REDIS_PORT`
+	redisPort int
+	//redisEnabled starts the Redis listener, which is off by default. Set by envar `PS_REDIS_ENABLED`
+	redisEnabled bool
+	//natsPort is the port the NATS listener accepts clients on. Set by envar `PS_NATS_PORT`
+	natsPort int
+	//natsEnabled starts the NATS listener, which is off by default. Set by envar `PS_NATS_ENABLED`
+	natsEnabled bool
 )
 
 func init() {
@@ -29,4 +63,77 @@ func init() {
 	adminUsername = envarOrDefault("PS_SUPERADMIN_USERNAME", "ping")
 	adminPassword = envarOrDefault("PS_SUPERADMIN_PASSWORD", RandomString(6))
 	persistToDirPath = envarOrDefault("PS_STORE", "store/")
+	pushConcurrency, err = strconv.Atoi(envarOrDefault("PS_PUSH_CONCURRENCY", "16"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	sseBufferSize, err = strconv.Atoi(envarOrDefault("PS_SSE_BUFFER", "256"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if sseBufferSize < 1 {
+		log.Fatalln("PS_SSE_BUFFER must be at least 1")
+	}
+	sseOverflow = SSEOverflowPolicy(envarOrDefault("PS_SSE_OVERFLOW", string(SSEDisconnect)))
+	if sseOverflow != SSEDropOldest && sseOverflow != SSEDisconnect {
+		log.Fatalf("PS_SSE_OVERFLOW must be %s or %s\n", SSEDropOldest, SSEDisconnect)
+	}
+	sseOrigins = make(map[string]bool)
+	for _, origin := range strings.Split(envarOrDefault("PS_SSE_ORIGINS", "*"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			sseOrigins[origin] = true
+		}
+	}
+	//without a set secret tokens do not survive a restart
+	secret := envarOrDefault("PS_TOKEN_SECRET", "")
+	if secret == "" {
+		if secret, err = randomHex(32); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	tokenSecret = []byte(secret)
+	tokenTTL, err = time.ParseDuration(envarOrDefault("PS_TOKEN_TTL", "24h"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	grpcPort, err = strconv.Atoi(envarOrDefault("PS_GRPC_PORT", "50051"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	grpcEnabled, err = strconv.ParseBool(envarOrDefault("PS_GRPC_ENABLED", "false"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	mqttPort, err = strconv.Atoi(envarOrDefault("PS_MQTT_PORT", "1883"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	mqttEnabled, err = strconv.ParseBool(envarOrDefault("PS_MQTT_ENABLED", "false"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	stompPort, err = strconv.Atoi(envarOrDefault("PS_STOMP_PORT", "61613"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	stompEnabled, err = strconv.ParseBool(envarOrDefault("PS_STOMP_ENABLED", "false"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	redisPort, err = strconv.Atoi(envarOrDefault("PS_REDIS_PORT", "6379"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	redisEnabled, err = strconv.ParseBool(envarOrDefault("PS_REDIS_ENABLED", "false"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	natsPort, err = strconv.Atoi(envarOrDefault("PS_NATS_PORT", "4222"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	natsEnabled, err = strconv.ParseBool(envarOrDefault("PS_NATS_ENABLED", "false"))
+	if err != nil {
+		log.Fatalln(err)
+	}
 }
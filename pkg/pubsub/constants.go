@@ -11,6 +11,12 @@ const (
 	pullVerb
 	subscribeVerb
 	unsubscribeVerb
+	ackVerb
+	nackVerb
+	modifyDeadlineVerb
+	deleteVerb
+	joinVerb
+	leaveVerb
 )
 
 //PersistUnit is an Enum type for what needs to be persisted for the defulat Persit implementation for streamers
@@ -21,4 +27,8 @@ const (
 	PersistUser PersistUnit = iota
 	//PersistSubscriber gives an enum option for Subscriber using the PersistUnit type
 	PersistSubscriber
+	//PersistSnapshot gives an enum option for Snapshot using the PersistUnit type
+	PersistSnapshot
+	//PersistTopicAccess gives an enum option for TopicAccess using the PersistUnit type
+	PersistTopicAccess
 )
@@ -0,0 +1,100 @@
+package pubsub
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	//DeadLetterMaxAttempts is the DeadLetter reason given when a message ran out of delivery attempts
+	DeadLetterMaxAttempts = "max_attempts"
+	//DeadLetterMaxAge is the DeadLetter reason given when a message became too old to keep retrying
+	DeadLetterMaxAge = "max_age"
+	//defaultMaxAttempts is used when a dead-letter Topic is given without any delivery limits
+	defaultMaxAttempts = 5
+)
+
+//DeadLetter is the Data of a Message moved to a dead-letter Topic after a push Subscription
+// could not deliver it. It carries the original Message and the failure detail
+type DeadLetter struct {
+	//Topic is the name of the Topic the Message was published to
+	Topic      string `json:"topic"`
+	Subscriber string `json:"subscriber_id"`
+	//Subscription is the name of the Subscription. Empty for the User's default Subscription
+	Subscription string  `json:"subscription,omitempty"`
+	Message      Message `json:"message"`
+	//Reason is DeadLetterMaxAttempts or DeadLetterMaxAge
+	Reason         string `json:"reason"`
+	Attempts       int    `json:"attempts"`
+	LastStatusCode int    `json:"last_status_code,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	FirstAttempt   string `json:"first_attempt"`
+	LastAttempt    string `json:"last_attempt"`
+}
+
+//deadLetterTopic gets the dead-letter Topic of the given name, creating it with
+// the User as creator if it does not exist. Errors if another User created the
+// Topic as only the creator can write the dead-lettered messages to it
+func (pubsub *PubSub) deadLetterTopic(topicName string, user *User) (*Topic, error) {
+	topic, err := pubsub.GetTopic(topicName, user)
+	if err != nil {
+		return nil, err
+	}
+	if topic.Creator != user.UUID {
+		return nil, fmt.Errorf("dead letter topic %s must be created by the subscribing user", topicName)
+	}
+	return topic, nil
+}
+
+//deadLetterBatch dead-letters each message of the worker's current batch. Messages already
+// dead-lettered by an earlier call that failed part way are skipped
+func (dispatcher *PushDispatcher) deadLetterBatch(worker *pushWorker, reason string) error {
+	if worker.deadLettered == nil {
+		worker.deadLettered = make(map[int]bool)
+	}
+	for _, message := range worker.batch {
+		if worker.deadLettered[message.ID] {
+			continue
+		}
+		if err := dispatcher.deadLetter(worker, message, reason); err != nil {
+			return err
+		}
+		worker.deadLettered[message.ID] = true
+	}
+	return nil
+}
+
+//deadLetter writes the message with its failure detail to the Subscriber's dead-letter Topic
+func (dispatcher *PushDispatcher) deadLetter(worker *pushWorker, message Message, reason string) error {
+	subscriber := worker.subscriber
+	pubsub := dispatcher.pubsub
+	pubsub.mu.RLock()
+	user, ok := pubsub.Users[subscriber.UsernameHash]
+	pubsub.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("subscriber user no longer exists")
+	}
+	topic, err := pubsub.deadLetterTopic(subscriber.DeadLetterTopic, user)
+	if err != nil {
+		return err
+	}
+	letter := Message{
+		Data: DeadLetter{
+			Topic:          worker.topic.Name,
+			Subscriber:     subscriber.ID,
+			Subscription:   subscriber.Name,
+			Message:        message,
+			Reason:         reason,
+			Attempts:       worker.attempts,
+			LastStatusCode: worker.lastStatus,
+			LastError:      worker.lastError,
+			FirstAttempt:   worker.firstAttempt.Format(time.RFC3339),
+			LastAttempt:    time.Now().Format(time.RFC3339),
+		},
+	}
+	letter.AddCreatedDatestring(time.Now())
+	if _, err := user.WriteToTopic(topic, letter); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,598 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//pushBackoffStart is the first wait after a failed push
+	pushBackoffStart = 80 * time.Millisecond
+	//pushBackoffCap is the longest wait between push attempts
+	pushBackoffCap = 60 * time.Minute
+	//pushTimeout is the longest a webhook endpoint is given to respond
+	pushTimeout = 10 * time.Second
+)
+
+//PushDispatcher delivers messages to push Subscribers (Webhooks).
+//
+//Each push Subscriber has its own worker goroutine which is woken when its
+// Topic is written to, so a slow endpoint only holds up its own Subscription.
+// The number of webhook requests in flight at once is capped across all workers
+type PushDispatcher struct {
+	pubsub *PubSub
+	//workers is keyed by Topic name then Subscriber key, suffixed with `#{consumer}`
+	// for the push consumers of shared Subscribers
+	workers map[string]map[string]*pushWorker
+	mu      *sync.Mutex
+	//slots is a semaphore limiting concurrent webhook requests
+	slots  chan struct{}
+	client *http.Client
+}
+
+//pushWorker is the delivery state for a single push Subscriber. Only the
+// worker goroutine reads or writes the backoff and attempt fields
+type pushWorker struct {
+	topic      *Topic
+	subscriber *Subscriber
+	//member is the push consumer delivered to when the Subscriber is shared
+	member *GroupMember
+	//wake is signalled when new messages may be available
+	wake chan struct{}
+	//quit is closed to stop the worker
+	quit chan struct{}
+	//policy is the Subscriber's RetryPolicy with defaults filled in
+	policy  RetryPolicy
+	backoff time.Duration
+	//deliveryID is sent in HeaderDelivery for every attempt at delivering the message deliveryFor
+	deliveryID  string
+	deliveryFor int
+	//attempts, firstAttempt, lastStatus and lastError record failures delivering the message deliveryFor
+	attempts     int
+	firstAttempt time.Time
+	lastStatus   int
+	lastError    string
+	//retryAfter is the wait asked for by the endpoint on the last failed push
+	retryAfter time.Duration
+	//verifyAttempts counts failed verifications of a pending Subscriber
+	verifyAttempts int
+	//batch is the messages being pushed. Kept for retries until acknowledged or dead-lettered
+	batch []Message
+	//deadLettered holds the IDs of batch messages already written to the dead-letter Topic
+	// so that retrying a partly failed dead-lettering does not write them again
+	deadLettered map[int]bool
+	//lingerStart is when the worker began waiting for a partial batch to fill
+	lingerStart time.Time
+}
+
+//NewPushDispatcher creates a PushDispatcher allowing up to maxConcurrent webhook requests at once.
+// The PubSub is used to reach dead-letter Topics
+func NewPushDispatcher(pubsub *PubSub, maxConcurrent int) *PushDispatcher {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return &PushDispatcher{
+		pubsub:  pubsub,
+		workers: make(map[string]map[string]*pushWorker),
+		mu:      &sync.Mutex{},
+		slots:   make(chan struct{}, maxConcurrent),
+		client:  &http.Client{Timeout: pushTimeout},
+	}
+}
+
+//Register starts a delivery worker for the Subscriber if it is a push Subscriber, or for
+// each push consumer of a shared Subscriber. Any worker already running for the same
+// Subscriber on the Topic is stopped
+func (dispatcher *PushDispatcher) Register(topic *Topic, subscriber *Subscriber) {
+	if subscriber.Shared {
+		topic.mu.RLock()
+		members := make([]*GroupMember, 0, len(subscriber.Members))
+		for _, member := range subscriber.Members {
+			members = append(members, member)
+		}
+		topic.mu.RUnlock()
+		for _, member := range members {
+			dispatcher.RegisterMember(topic, subscriber, member)
+		}
+		return
+	}
+	if subscriber.PushURL == "" {
+		return
+	}
+	dispatcher.start(subscriber.key(), newPushWorker(topic, subscriber, nil))
+}
+
+//RegisterMember starts a delivery worker for the consumer of a shared Subscriber if it is
+// a push consumer, stopping any worker already running for the consumer
+func (dispatcher *PushDispatcher) RegisterMember(topic *Topic, subscriber *Subscriber, member *GroupMember) {
+	if member.PushURL == "" {
+		//the consumer may have rejoined as a pull consumer
+		dispatcher.Deregister(topic.Name, memberKey(subscriber.key(), member.ID))
+		return
+	}
+	dispatcher.start(memberKey(subscriber.key(), member.ID), newPushWorker(topic, subscriber, member))
+}
+
+//newPushWorker sets up the delivery state for the Subscriber or for its consumer if member is not nil
+func newPushWorker(topic *Topic, subscriber *Subscriber, member *GroupMember) *pushWorker {
+	policy := subscriber.RetryPolicy.withDefaults()
+	return &pushWorker{
+		topic:       topic,
+		subscriber:  subscriber,
+		member:      member,
+		wake:        make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+		policy:      policy,
+		backoff:     policy.MinBackoff,
+		deliveryFor: -1,
+	}
+}
+
+//start runs the worker under the key, stopping any worker already running under it
+func (dispatcher *PushDispatcher) start(key string, worker *pushWorker) {
+	topicName := worker.topic.Name
+	dispatcher.mu.Lock()
+	if _, ok := dispatcher.workers[topicName]; !ok {
+		dispatcher.workers[topicName] = make(map[string]*pushWorker)
+	}
+	if existing, ok := dispatcher.workers[topicName][key]; ok {
+		close(existing.quit)
+	}
+	dispatcher.workers[topicName][key] = worker
+	dispatcher.mu.Unlock()
+
+	go dispatcher.work(worker)
+}
+
+//Deregister stops the worker of the Subscriber key on the named Topic if there is one,
+// along with the workers of its push consumers
+func (dispatcher *PushDispatcher) Deregister(topicName, key string) {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	for workerKey, worker := range dispatcher.workers[topicName] {
+		if workerKey == key || strings.HasPrefix(workerKey, key+"#") {
+			close(worker.quit)
+			delete(dispatcher.workers[topicName], workerKey)
+		}
+	}
+}
+
+//DeregisterTopic stops all workers for the named Topic
+func (dispatcher *PushDispatcher) DeregisterTopic(topicName string) {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	for _, worker := range dispatcher.workers[topicName] {
+		close(worker.quit)
+	}
+	delete(dispatcher.workers, topicName)
+}
+
+//Notify wakes the workers of the named Topic to check for new messages
+func (dispatcher *PushDispatcher) Notify(topicName string) {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	for _, worker := range dispatcher.workers[topicName] {
+		select {
+		case worker.wake <- struct{}{}:
+		default: //already due to wake
+		}
+	}
+}
+
+//Close stops all workers
+func (dispatcher *PushDispatcher) Close() error {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	for topicName, workers := range dispatcher.workers {
+		for _, worker := range workers {
+			close(worker.quit)
+		}
+		delete(dispatcher.workers, topicName)
+	}
+	return nil
+}
+
+//work is the worker goroutine. It pushes messages in order from the
+// Subscriber's pointer position - one at a time or in batches - sleeping
+// until woken when there is nothing to send and backing off as set by the
+// Subscriber's RetryPolicy when the endpoint does not acknowledge.
+//
+//Pending Subscribers are verified before any messages are sent. Messages that
+// exhaust the Subscriber's delivery limits are moved to its dead-letter Topic
+func (dispatcher *PushDispatcher) work(worker *pushWorker) {
+	for {
+		select {
+		case <-worker.quit:
+			return
+		default:
+		}
+
+		if worker.pending() {
+			if err := dispatcher.verify(worker); err != nil {
+				log.Printf("could not verify webhook of subscriber %s to topic %s: %v\n", worker.name(), worker.topic.Name, err)
+				worker.verifyAttempts++
+				if worker.verifyAttempts >= maxVerifyAttempts {
+					dispatcher.abandon(worker)
+					return
+				}
+				if !worker.sleep(worker.policy.wait(worker.backoff, 0)) {
+					return
+				}
+				worker.backoff = worker.policy.next(worker.backoff)
+				continue
+			}
+			dispatcher.activate(worker)
+			worker.backoff = worker.policy.MinBackoff
+		}
+
+		//the same messages are retried until acknowledged or dead-lettered
+		if len(worker.batch) == 0 {
+			batch, full := worker.nextMessages()
+			if len(batch) == 0 {
+				//nothing to send so wait for a write to the Topic. Consumers of shared
+				// Subscribers also recheck for messages whose leases have expired
+				var recheck time.Duration
+				if worker.member != nil {
+					recheck = worker.subscriber.ackDeadline()
+				}
+				if !worker.idle(recheck) {
+					return
+				}
+				continue
+			}
+			//give a partial batch time to fill up
+			if linger := worker.subscriber.BatchLinger; !full && linger > 0 {
+				if worker.lingerStart.IsZero() {
+					worker.lingerStart = time.Now()
+				}
+				if wait := time.Until(worker.lingerStart.Add(linger)); wait > 0 {
+					if !worker.idle(wait) {
+						return
+					}
+					continue
+				}
+			}
+			worker.batch = batch
+			worker.lingerStart = time.Time{}
+		}
+
+		first, last := worker.batch[0], worker.batch[len(worker.batch)-1]
+		//consumers of shared Subscribers drop messages handed to another consumer while backing off
+		if !worker.hold() {
+			worker.batch = nil
+			continue
+		}
+		if err := dispatcher.push(worker, worker.batch); err != nil {
+			log.Printf("could not deliver msgs #%d-%d of topic %s to subscriber %s: %v\n", first.ID, last.ID, worker.topic.Name, worker.name(), err)
+			if reason := worker.exhausted(first); reason != "" {
+				if err := dispatcher.deadLetterBatch(worker, reason); err != nil {
+					log.Printf("could not dead-letter msgs #%d-%d of topic %s for subscriber %s: %v\n", first.ID, last.ID, worker.topic.Name, worker.name(), err)
+				} else {
+					worker.backoff = worker.policy.MinBackoff
+					worker.advance(first.ID, last.ID+1)
+					continue
+				}
+			}
+			if !worker.sleep(worker.policy.wait(worker.backoff, worker.retryAfter)) {
+				return
+			}
+			worker.backoff = worker.policy.next(worker.backoff)
+			continue
+		}
+		worker.backoff = worker.policy.MinBackoff
+		worker.advance(first.ID, last.ID+1)
+	}
+}
+
+//push POSTs the messages to the worker's endpoint and returns an error
+// unless it is acknowledged with one of the RetryPolicy's accepted status codes.
+//
+//Batching Subscribers are sent a BatchResp of all the messages, others a
+// MessageResp of the single message. Requests carry HeaderDelivery and
+// HeaderTimestamp, plus HeaderSignature when the Subscriber has a signing secret
+func (dispatcher *PushDispatcher) push(worker *pushWorker, messages []Message) error {
+	var parcel []byte
+	var err error
+	if worker.subscriber.batching() {
+		parcel, err = BatchResp{
+			Topic:    worker.topic.Name,
+			Messages: messages,
+		}.toJSON()
+	} else {
+		parcel, err = MessageResp{
+			Topic:   worker.topic.Name,
+			Message: messages[0],
+		}.toJSON()
+	}
+	if err != nil {
+		return fmt.Errorf("error converting to JSON: %v", err)
+	}
+	if err := worker.track(messages[0].ID); err != nil {
+		return err
+	}
+	pushURL, secret := worker.endpoint()
+	req, err := http.NewRequest(http.MethodPost, pushURL, bytes.NewReader(parcel))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDelivery, worker.deliveryID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if secret != "" {
+		req.Header.Set(HeaderSignature, signPayload(secret, timestamp, parcel))
+	}
+	//wait for a free slot
+	select {
+	case dispatcher.slots <- struct{}{}:
+	case <-worker.quit:
+		return fmt.Errorf("worker stopped before push")
+	}
+	defer func() { <-dispatcher.slots }()
+
+	worker.attempts++
+	worker.retryAfter = 0
+	started := time.Now()
+	resp, err := dispatcher.client.Do(req)
+	if err != nil {
+		worker.lastStatus, worker.lastError = 0, err.Error()
+		worker.recordAttempt(DeliveryTypePush, messages, started, 0, err)
+		return err
+	}
+	defer resp.Body.Close()
+	//drain so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+	if !worker.policy.accepts(resp.StatusCode) {
+		err := fmt.Errorf("webhook responded with status code %d", resp.StatusCode)
+		worker.lastStatus, worker.lastError = resp.StatusCode, err.Error()
+		worker.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		worker.recordAttempt(DeliveryTypePush, messages, started, resp.StatusCode, err)
+		return err
+	}
+	worker.recordAttempt(DeliveryTypePush, messages, started, resp.StatusCode, nil)
+	return nil
+}
+
+//track resets the delivery ID and attempt record when the worker moves on to new messages.
+// The delivery ID is kept across retries of the same messages
+func (worker *pushWorker) track(messageID int) error {
+	if worker.deliveryFor == messageID && worker.deliveryID != "" {
+		return nil
+	}
+	deliveryID, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	worker.deliveryID = deliveryID
+	worker.deliveryFor = messageID
+	worker.attempts = 0
+	worker.firstAttempt = time.Now()
+	worker.lastStatus, worker.lastError = 0, ""
+	return nil
+}
+
+//exhausted gives the reason the message should be dead-lettered or an empty string if it should be retried
+func (worker *pushWorker) exhausted(message Message) string {
+	subscriber := worker.subscriber
+	if subscriber.DeadLetterTopic == "" {
+		return ""
+	}
+	if subscriber.MaxAttempts > 0 && worker.attempts >= subscriber.MaxAttempts {
+		return DeadLetterMaxAttempts
+	}
+	if subscriber.MaxAge > 0 {
+		created, err := message.GetCreatedDateTime()
+		if err != nil {
+			created = worker.firstAttempt
+		}
+		if isStale(created, subscriber.MaxAge) {
+			return DeadLetterMaxAge
+		}
+	}
+	return ""
+}
+
+//nextMessages gets the messages to send from the Subscriber's pointer position.
+// Messages the Subscriber's filter does not match are passed over and acknowledged.
+//
+//This is a single message unless the Subscriber is batching, in which case it is
+// as many consecutive messages as fit the batch limits. Full reports whether a
+// limit was reached so the batch should be sent without lingering
+func (worker *pushWorker) nextMessages() (batch []Message, full bool) {
+	if worker.member != nil {
+		return worker.claim()
+	}
+	worker.topic.mu.Lock()
+	defer worker.topic.mu.Unlock()
+	position, ok := worker.topic.subscriberPosition(worker.subscriber)
+	if !ok {
+		return nil, false
+	}
+	position = worker.topic.skipFiltered(worker.subscriber, position)
+	if !worker.subscriber.batching() {
+		if message, ok := worker.topic.Messages[position]; ok {
+			return []Message{message}, true
+		}
+		return nil, false
+	}
+	maxMessages, maxBytes := worker.subscriber.batchLimits()
+	size := 0
+	for id := position; id < worker.topic.PointerHead; id++ {
+		message, ok := worker.topic.Messages[id]
+		if !ok {
+			break
+		}
+		//filtered out messages are passed over when the batch is acknowledged
+		if !worker.subscriber.matches(message) {
+			continue
+		}
+		encoded, err := json.Marshal(message)
+		if err != nil {
+			break
+		}
+		//always send at least one message even if it is over the byte limit
+		if len(batch) > 0 && size+len(encoded) > maxBytes {
+			return batch, true
+		}
+		batch = append(batch, message)
+		size += len(encoded)
+		if len(batch) >= maxMessages || size >= maxBytes {
+			return batch, true
+		}
+	}
+	return batch, false
+}
+
+//claim leases the next message available to the worker's consumer from the shared
+// Subscriber's pointer position, skipping those leased to the rest of the group
+func (worker *pushWorker) claim() (batch []Message, full bool) {
+	worker.topic.mu.Lock()
+	defer worker.topic.mu.Unlock()
+	sub := worker.subscriber
+	position, ok := worker.topic.subscriberPosition(sub)
+	if !ok {
+		return nil, false
+	}
+	if sub.leases == nil {
+		sub.leases = newLeaseTable()
+	}
+	now := time.Now()
+	filtered := []int{}
+	//acknowledge messages the filter passed over on the way out
+	defer func() { worker.topic.acknowledge(sub, position, filtered) }()
+	for id := position; id < worker.topic.PointerHead; id++ {
+		message, ok := worker.topic.Messages[id]
+		if !ok || !sub.leases.available(id, now) {
+			continue
+		}
+		if !sub.matches(message) {
+			filtered = append(filtered, id)
+			continue
+		}
+		if !sub.assigned(message, worker.member.ID) {
+			continue
+		}
+		sub.leases.lease(id, worker.member.ID, now.Add(worker.leaseTime()))
+		return []Message{message}, true
+	}
+	return nil, false
+}
+
+//hold renews the consumer's leases on the messages being pushed. Returns false if any have
+// been acknowledged or handed to another consumer since they were claimed. Always true for
+// Subscribers that are not shared
+func (worker *pushWorker) hold() bool {
+	if worker.member == nil {
+		return true
+	}
+	worker.topic.mu.Lock()
+	defer worker.topic.mu.Unlock()
+	leases := worker.subscriber.leases
+	if leases == nil {
+		return false
+	}
+	deadline := time.Now().Add(worker.leaseTime())
+	for _, message := range worker.batch {
+		if leases.acked[message.ID] || leases.owners[message.ID] != worker.member.ID {
+			return false
+		}
+		leases.deadlines[message.ID] = deadline
+	}
+	return true
+}
+
+//leaseTime gives how long a consumer's claimed messages are leased for. Long enough for the push to time out
+func (worker *pushWorker) leaseTime() time.Duration {
+	return worker.subscriber.ackDeadline() + pushTimeout
+}
+
+//advance moves the Subscriber from the first sent message to the position after the
+// last if it has not been moved elsewhere in the meantime. Clears the sent batch.
+//
+//For consumers of shared Subscribers the sent messages are acknowledged instead so the
+// Subscriber only moves past messages the whole group has finished with
+func (worker *pushWorker) advance(from, to int) {
+	worker.batch = nil
+	worker.deadLettered = nil
+	worker.topic.mu.Lock()
+	defer worker.topic.mu.Unlock()
+	position, ok := worker.topic.subscriberPosition(worker.subscriber)
+	if !ok {
+		return
+	}
+	if worker.member != nil {
+		messageIDs := make([]int, 0, to-from)
+		for id := from; id < to; id++ {
+			messageIDs = append(messageIDs, id)
+		}
+		worker.topic.acknowledge(worker.subscriber, position, messageIDs)
+		return
+	}
+	if position == from {
+		worker.topic.moveSubscriber(worker.subscriber, position, to)
+	}
+}
+
+//endpoint gives the webhook URL and signing secret the worker pushes to
+func (worker *pushWorker) endpoint() (string, string) {
+	if worker.member != nil {
+		return worker.member.PushURL, worker.member.Secret
+	}
+	return worker.subscriber.PushURL, worker.subscriber.Secret
+}
+
+//name gives the Subscriber key the worker delivers for, with the consumer if any. For logging
+func (worker *pushWorker) name() string {
+	if worker.member != nil {
+		return memberKey(worker.subscriber.key(), worker.member.ID)
+	}
+	return worker.subscriber.key()
+}
+
+//pending is whether the worker is waiting on its endpoint to be verified
+func (worker *pushWorker) pending() bool {
+	if worker.member == nil {
+		return worker.subscriber.pending()
+	}
+	worker.topic.mu.RLock()
+	defer worker.topic.mu.RUnlock()
+	return worker.member.Status == SubscriptionPending
+}
+
+//idle waits for the Topic to be written to, or for the timeout if greater than zero.
+// Returns false if the worker was stopped in the meantime
+func (worker *pushWorker) idle(timeout time.Duration) bool {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case <-worker.wake:
+	case <-timer:
+	case <-worker.quit:
+		return false
+	}
+	return true
+}
+
+//sleep waits for the duration. Returns false if the worker was stopped in the meantime
+func (worker *pushWorker) sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-worker.quit:
+		return false
+	}
+}
@@ -1,6 +1,10 @@
 package pubsub
 
-import "log"
+import (
+	"fmt"
+	"log"
+	"net"
+)
 
 //Start is the super easy API from running the PubSub from code
 func Start(port int) { //add options struct as second arg
@@ -19,6 +23,71 @@ func Start(port int) { //add options struct as second arg
 		log.Fatalln(sseServer.ListenAndServe())
 	}(closer)
 
+	//start gRPC server seperately in goroutine if enabled
+	if grpcEnabled {
+		go func(pubsub *PubSub) {
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%d", grpcPort))
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			log.Printf("gRPC server running on port %d\n", grpcPort)
+			log.Fatalln(pubsub.ServeGRPC(listener))
+		}(closer)
+	}
+
+	//start MQTT listener seperately in goroutine if enabled
+	if mqttEnabled {
+		go func(pubsub *PubSub) {
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%d", mqttPort))
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			log.Printf("MQTT listener running on port %d\n", mqttPort)
+			log.Fatalln(pubsub.ServeMQTT(listener))
+		}(closer)
+	}
+
+	//start STOMP listener seperately in goroutine if enabled
+	if stompEnabled {
+		go func(pubsub *PubSub) {
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%d", stompPort))
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			log.Printf("STOMP listener running on port %d\n", stompPort)
+			log.Fatalln(pubsub.ServeSTOMP(listener))
+		}(closer)
+	}
+
+	//start Redis listener seperately in goroutine if enabled
+	if redisEnabled {
+		go func(pubsub *PubSub) {
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%d", redisPort))
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			log.Printf("Redis listener running on port %d\n", redisPort)
+			log.Fatalln(pubsub.ServeRedis(listener))
+		}(closer)
+	}
+
+	//start NATS listener seperately in goroutine if enabled
+	if natsEnabled {
+		go func(pubsub *PubSub) {
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%d", natsPort))
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			log.Printf("NATS listener running on port %d\n", natsPort)
+			log.Fatalln(pubsub.ServeNATS(listener))
+		}(closer)
+	}
+
 	//start API server in main thread
 	log.Printf("API Server running on port %d\n", port)
 	log.Fatalln(server.ListenAndServe())
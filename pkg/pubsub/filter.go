@@ -0,0 +1,498 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	//maxFilterLength caps the size of a filter expression
+	maxFilterLength = 1024
+)
+
+//filterOperators are the comparison operators a filter expression can use
+var filterOperators = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+//Filter is a parsed filter expression picking the messages a Subscription or SSE stream receives.
+//
+//Expressions compare message fields to quoted strings, numbers or true/false:
+//
+// attributes.region = "eu" AND (data.amount >= 100 OR NOT key = "test")
+//
+//Fields are `key`, `attributes.{name}` and `data.{name}` for the top-level fields of a JSON
+// object Message.Data. The operators are =, !=, <, <=, >, >= and hasPrefix(field, "prefix").
+// A field on its own checks it is present. Comparisons against missing fields are false.
+// AND binds tighter than OR and parentheses group
+type Filter struct {
+	expression string
+	root       filterNode
+}
+
+//filterNode is a node of a parsed Filter expression
+type filterNode interface {
+	eval(message Message, data map[string]interface{}) bool
+}
+
+//ParseFilter parses the filter expression. An empty expression gives a nil Filter which matches everything
+func ParseFilter(expression string) (*Filter, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+	if len(expression) > maxFilterLength {
+		return nil, fmt.Errorf("filter can not be longer than %d characters", maxFilterLength)
+	}
+	tokens, err := lexFilter(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %v", err)
+	}
+	parser := &filterParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err == nil && parser.pos < len(parser.tokens) {
+		err = fmt.Errorf("unexpected %q", parser.tokens[parser.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %v", err)
+	}
+	return &Filter{expression: expression, root: root}, nil
+}
+
+//Matches is whether the message passes the filter. A nil Filter matches every message
+func (filter *Filter) Matches(message Message) bool {
+	if filter == nil {
+		return true
+	}
+	return filter.root.eval(message, messageFields(message))
+}
+
+//String gives the filter expression as it was given
+func (filter *Filter) String() string {
+	if filter == nil {
+		return ""
+	}
+	return filter.expression
+}
+
+//matches is whether the message passes the Subscriber's filter. Subscribers without
+// a filter receive every message
+func (subscriber *Subscriber) matches(message Message) bool {
+	return subscriber.filter.Matches(message)
+}
+
+//skipFiltered moves the Subscriber past the messages at its pointer position that its
+// filter does not match, acknowledging them. Gives the new position.
+// Caller must hold topic.mu for writing
+func (topic *Topic) skipFiltered(subscriber *Subscriber, position int) int {
+	if subscriber.filter == nil {
+		return position
+	}
+	next := position
+	for next < topic.PointerHead {
+		message, ok := topic.Messages[next]
+		if !ok || subscriber.matches(message) {
+			break
+		}
+		next++
+	}
+	topic.moveSubscriber(subscriber, position, next)
+	return next
+}
+
+//messageFields gives the top-level fields of the message Data if it is a JSON object.
+// String Data holding a JSON object, as written by URL query, is decoded
+func messageFields(message Message) map[string]interface{} {
+	switch data := message.Data.(type) {
+	case map[string]interface{}:
+		return data
+	case string:
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(data), &fields); err == nil {
+			return fields
+		}
+	}
+	return nil
+}
+
+//------------------------------------------- evaluation
+
+//andNode matches when both sides match
+type andNode struct{ left, right filterNode }
+
+func (node andNode) eval(message Message, data map[string]interface{}) bool {
+	return node.left.eval(message, data) && node.right.eval(message, data)
+}
+
+//orNode matches when either side matches
+type orNode struct{ left, right filterNode }
+
+func (node orNode) eval(message Message, data map[string]interface{}) bool {
+	return node.left.eval(message, data) || node.right.eval(message, data)
+}
+
+//notNode inverts its operand
+type notNode struct{ operand filterNode }
+
+func (node notNode) eval(message Message, data map[string]interface{}) bool {
+	return !node.operand.eval(message, data)
+}
+
+//compareNode compares a field to a literal. An empty op checks the field is present
+type compareNode struct {
+	field   string
+	op      string
+	literal interface{} //string, float64 or bool
+}
+
+func (node compareNode) eval(message Message, data map[string]interface{}) bool {
+	value, ok := lookupField(node.field, message, data)
+	if !ok {
+		return false
+	}
+	switch node.op {
+	case "":
+		return true
+	case "hasPrefix":
+		text, ok := fieldString(value)
+		return ok && strings.HasPrefix(text, node.literal.(string))
+	}
+	order, ok := compareField(value, node.literal)
+	if !ok {
+		//values of different kinds are only ever unequal
+		return node.op == "!="
+	}
+	switch node.op {
+	case "=":
+		return order == 0
+	case "!=":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	case ">=":
+		return order >= 0
+	}
+	return false
+}
+
+//lookupField finds the value of the field in the message
+func lookupField(field string, message Message, data map[string]interface{}) (interface{}, bool) {
+	switch {
+	case field == "key":
+		return message.Key, message.Key != ""
+	case strings.HasPrefix(field, "attributes."):
+		value, ok := message.Attributes[strings.TrimPrefix(field, "attributes.")]
+		return value, ok
+	default: //data.
+		value, ok := data[strings.TrimPrefix(field, "data.")]
+		return value, ok && value != nil
+	}
+}
+
+//fieldString gives the field value as text if it is a string, number or bool
+func fieldString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+//compareField orders the field value against the literal, giving -1, 0 or 1. Number
+// literals compare numerically, parsing string values such as attributes. Returns false
+// if the value can not be compared to the literal
+func compareField(value interface{}, literal interface{}) (int, bool) {
+	switch lit := literal.(type) {
+	case float64:
+		var number float64
+		switch v := value.(type) {
+		case float64:
+			number = v
+		case string:
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return 0, false
+			}
+			number = parsed
+		default:
+			return 0, false
+		}
+		switch {
+		case number < lit:
+			return -1, true
+		case number > lit:
+			return 1, true
+		}
+		return 0, true
+	case bool:
+		text, ok := fieldString(value)
+		if !ok || (text != "true" && text != "false") {
+			return 0, false
+		}
+		if (text == "true") == lit {
+			return 0, true
+		}
+		return 1, true
+	default: //string
+		text, ok := fieldString(value)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(text, lit.(string)), true
+	}
+}
+
+//------------------------------------------- parsing
+
+//filterToken is a lexed piece of a filter expression
+type filterToken struct {
+	kind string //ident, string, number, op, ( , ) or ,
+	text string
+}
+
+//lexFilter splits the filter expression into tokens
+func lexFilter(expression string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, filterToken{kind: string(r), text: string(r)})
+			i++
+		case r == '"':
+			//find the closing quote, skipping escaped characters
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			text, err := strconv.Unquote(string(runes[i : end+1]))
+			if err != nil {
+				return nil, fmt.Errorf("bad string %s", string(runes[i:end+1]))
+			}
+			tokens = append(tokens, filterToken{kind: "string", text: text})
+			i = end + 1
+		case strings.ContainsRune("=!<>", r):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected '!' - use != or NOT")
+			}
+			tokens = append(tokens, filterToken{kind: "op", text: op})
+			i += len(op)
+		case r == '-' || unicode.IsDigit(r):
+			end := i + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || strings.ContainsRune(".eE+-", runes[end])) {
+				end++
+			}
+			tokens = append(tokens, filterToken{kind: "number", text: string(runes[i:end])})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || strings.ContainsRune("_.-", runes[end])) {
+				end++
+			}
+			tokens = append(tokens, filterToken{kind: "ident", text: string(runes[i:end])})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+//filterParser is a recursive descent parser over the lexed tokens
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+//peek gives the next token without consuming it. The zero token is given at the end
+func (parser *filterParser) peek() filterToken {
+	if parser.pos < len(parser.tokens) {
+		return parser.tokens[parser.pos]
+	}
+	return filterToken{}
+}
+
+//keyword is whether the next token is the case-insensitive keyword, consuming it if so
+func (parser *filterParser) keyword(word string) bool {
+	if token := parser.peek(); token.kind == "ident" && strings.EqualFold(token.text, word) {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+//expect consumes the next token if it is of the kind or errors
+func (parser *filterParser) expect(kind string) (filterToken, error) {
+	token := parser.peek()
+	if token.kind != kind {
+		expected := map[string]string{"ident": "a field", "string": "a quoted string"}[kind]
+		if expected == "" {
+			expected = "'" + kind + "'"
+		}
+		if token.kind == "" {
+			return token, fmt.Errorf("expected %s at end of filter", expected)
+		}
+		return token, fmt.Errorf("expected %s but found %q", expected, token.text)
+	}
+	parser.pos++
+	return token, nil
+}
+
+//parseOr parses `and (OR and)*`
+func (parser *filterParser) parseOr() (filterNode, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.keyword("OR") {
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+//parseAnd parses `unary (AND unary)*`
+func (parser *filterParser) parseAnd() (filterNode, error) {
+	left, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for parser.keyword("AND") {
+		right, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+//parseUnary parses `NOT unary`, a parenthesised expression or a comparison
+func (parser *filterParser) parseUnary() (filterNode, error) {
+	if parser.keyword("NOT") {
+		operand, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+	if parser.peek().kind == "(" {
+		parser.pos++
+		inner, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parser.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	return parser.parseComparison()
+}
+
+//parseComparison parses `hasPrefix(field, "prefix")`, `field op literal` or a lone field
+func (parser *filterParser) parseComparison() (filterNode, error) {
+	if parser.keyword("hasPrefix") {
+		if _, err := parser.expect("("); err != nil {
+			return nil, err
+		}
+		field, err := parser.parseField()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parser.expect(","); err != nil {
+			return nil, err
+		}
+		prefix, err := parser.expect("string")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parser.expect(")"); err != nil {
+			return nil, err
+		}
+		return compareNode{field: field, op: "hasPrefix", literal: prefix.text}, nil
+	}
+	field, err := parser.parseField()
+	if err != nil {
+		return nil, err
+	}
+	if parser.peek().kind != "op" {
+		return compareNode{field: field}, nil
+	}
+	op := parser.tokens[parser.pos].text
+	if !filterOperators[op] {
+		return nil, fmt.Errorf("unknown operator %q - use =, !=, <, <=, > or >=", op)
+	}
+	parser.pos++
+	literal, err := parser.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{field: field, op: op, literal: literal}, nil
+}
+
+//parseField parses a field name, checking it is one that can be looked up
+func (parser *filterParser) parseField() (string, error) {
+	token, err := parser.expect("ident")
+	if err != nil {
+		return "", err
+	}
+	field := token.text
+	if field == "key" {
+		return field, nil
+	}
+	for _, prefix := range []string{"attributes.", "data."} {
+		if strings.HasPrefix(field, prefix) && len(field) > len(prefix) {
+			return field, nil
+		}
+	}
+	return "", fmt.Errorf("unknown field %q - use key, attributes.{name} or data.{name}", field)
+}
+
+//parseLiteral parses a quoted string, number or true/false
+func (parser *filterParser) parseLiteral() (interface{}, error) {
+	token := parser.peek()
+	switch {
+	case token.kind == "string":
+		parser.pos++
+		return token.text, nil
+	case token.kind == "number":
+		parser.pos++
+		number, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", token.text)
+		}
+		return number, nil
+	case parser.keyword("true"):
+		return true, nil
+	case parser.keyword("false"):
+		return false, nil
+	case token.kind == "":
+		return nil, fmt.Errorf("expected a value at end of filter")
+	}
+	return nil, fmt.Errorf("expected a value but found %q", token.text)
+}
@@ -0,0 +1,152 @@
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLexFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       []filterToken
+		wantErr    bool
+	}{
+		{
+			name:       "comparison",
+			expression: `attributes.region = "eu"`,
+			want: []filterToken{
+				{kind: "ident", text: "attributes.region"},
+				{kind: "op", text: "="},
+				{kind: "string", text: "eu"},
+			},
+		},
+		{
+			name:       "two character operators",
+			expression: `data.a<=1 data.b>=-2.5e3 data.c!=3`,
+			want: []filterToken{
+				{kind: "ident", text: "data.a"},
+				{kind: "op", text: "<="},
+				{kind: "number", text: "1"},
+				{kind: "ident", text: "data.b"},
+				{kind: "op", text: ">="},
+				{kind: "number", text: "-2.5e3"},
+				{kind: "ident", text: "data.c"},
+				{kind: "op", text: "!="},
+				{kind: "number", text: "3"},
+			},
+		},
+		{
+			name:       "double equals is lexed as one operator",
+			expression: `data.x == 5`,
+			want: []filterToken{
+				{kind: "ident", text: "data.x"},
+				{kind: "op", text: "=="},
+				{kind: "number", text: "5"},
+			},
+		},
+		{
+			name:       "punctuation and escaped string",
+			expression: `hasPrefix(key, "a\"b")`,
+			want: []filterToken{
+				{kind: "ident", text: "hasPrefix"},
+				{kind: "(", text: "("},
+				{kind: "ident", text: "key"},
+				{kind: ",", text: ","},
+				{kind: "string", text: `a"b`},
+				{kind: ")", text: ")"},
+			},
+		},
+		{name: "unterminated string", expression: `key = "eu`, wantErr: true},
+		{name: "lone bang", expression: `! key`, wantErr: true},
+		{name: "unexpected character", expression: `key = 'eu'`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := lexFilter(test.expression)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("lexFilter(%q) error = %v, wantErr %v", test.expression, err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("lexFilter(%q) = %v, want %v", test.expression, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseComparison(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       compareNode
+		wantErr    bool
+	}{
+		{name: "string", expression: `key = "a"`, want: compareNode{field: "key", op: "=", literal: "a"}},
+		{name: "number", expression: `data.n >= 10`, want: compareNode{field: "data.n", op: ">=", literal: float64(10)}},
+		{name: "bool", expression: `attributes.on != TRUE`, want: compareNode{field: "attributes.on", op: "!=", literal: true}},
+		{name: "presence", expression: `data.n`, want: compareNode{field: "data.n"}},
+		{name: "hasPrefix", expression: `hasPrefix(key, "ord-")`, want: compareNode{field: "key", op: "hasPrefix", literal: "ord-"}},
+		{name: "double equals", expression: `data.x == 5`, wantErr: true},
+		{name: "unknown field", expression: `value = 5`, wantErr: true},
+		{name: "empty field name", expression: `data. = 5`, wantErr: true},
+		{name: "missing value", expression: `key =`, wantErr: true},
+		{name: "bad number", expression: `data.n = 1e`, wantErr: true},
+		{name: "unquoted prefix", expression: `hasPrefix(key, ord)`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := lexFilter(test.expression)
+			if err != nil {
+				t.Fatalf("lexFilter(%q) error = %v", test.expression, err)
+			}
+			parser := &filterParser{tokens: tokens}
+			got, err := parser.parseComparison()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseComparison(%q) error = %v, wantErr %v", test.expression, err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseComparison(%q) = %#v, want %#v", test.expression, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompareNodeEval(t *testing.T) {
+	message := Message{
+		Key:        "ord-1",
+		Attributes: map[string]string{"region": "eu", "count": "7", "on": "true"},
+		Data:       `{"amount": 6, "name": "bob", "paid": false, "none": null}`,
+	}
+	tests := []struct {
+		name string
+		node compareNode
+		want bool
+	}{
+		{name: "key present", node: compareNode{field: "key"}, want: true},
+		{name: "attribute missing", node: compareNode{field: "attributes.zone"}, want: false},
+		{name: "null data is missing", node: compareNode{field: "data.none"}, want: false},
+		{name: "string equal", node: compareNode{field: "attributes.region", op: "=", literal: "eu"}, want: true},
+		{name: "string not equal", node: compareNode{field: "attributes.region", op: "!=", literal: "eu"}, want: false},
+		{name: "string order", node: compareNode{field: "data.name", op: "<", literal: "carl"}, want: true},
+		{name: "number equal", node: compareNode{field: "data.amount", op: "=", literal: float64(5)}, want: false},
+		{name: "number less or equal", node: compareNode{field: "data.amount", op: "<=", literal: float64(6)}, want: true},
+		{name: "number greater", node: compareNode{field: "data.amount", op: ">", literal: float64(6)}, want: false},
+		{name: "number greater or equal", node: compareNode{field: "data.amount", op: ">=", literal: float64(6)}, want: true},
+		{name: "attribute parsed as number", node: compareNode{field: "attributes.count", op: ">", literal: float64(6)}, want: true},
+		{name: "bool attribute", node: compareNode{field: "attributes.on", op: "=", literal: true}, want: true},
+		{name: "bool data", node: compareNode{field: "data.paid", op: "=", literal: false}, want: true},
+		{name: "different kinds are unequal", node: compareNode{field: "data.name", op: "!=", literal: float64(1)}, want: true},
+		{name: "different kinds do not order", node: compareNode{field: "data.name", op: ">=", literal: float64(1)}, want: false},
+		{name: "hasPrefix", node: compareNode{field: "key", op: "hasPrefix", literal: "ord-"}, want: true},
+		{name: "hasPrefix no match", node: compareNode{field: "key", op: "hasPrefix", literal: "inv-"}, want: false},
+		{name: "unknown operator matches nothing", node: compareNode{field: "data.amount", op: "==", literal: float64(5)}, want: false},
+	}
+	data := messageFields(message)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.node.eval(message, data); got != test.want {
+				t.Errorf("%#v.eval() = %v, want %v", test.node, got, test.want)
+			}
+		})
+	}
+}
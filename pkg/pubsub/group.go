@@ -0,0 +1,308 @@
+package pubsub
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//memberTimeout is how long a pull consumer of a shared Subscription can go without pulling
+	// or acknowledging before it is dropped from the group and its leased messages handed out again
+	memberTimeout = 60 * time.Second
+)
+
+//GroupMember is a consumer of a shared Subscription.
+//
+//Pull consumers join by pulling and are dropped once quiet for longer than memberTimeout.
+// Push consumers are webhooks that stay in the group until they leave
+type GroupMember struct {
+	ID      string //ID is the consumer name given when joining or pulling
+	PushURL string //PushURL is the webhook of a push consumer. Empty for pull consumers
+	Secret  string //Secret is the HMAC key used to sign push requests to PushURL
+	//Status is SubscriptionPending until a push consumer's webhook is verified, then SubscriptionActive
+	Status string
+	Joined string //Joined is the date the consumer joined the group
+	//lastSeen is when a pull consumer last pulled or acknowledged. Not persisted
+	lastSeen time.Time
+}
+
+//Consumer identifies who is pulling or acknowledging on a Topic.
+//
+//The zero Consumer is the User's own Subscription. Setting Subscription uses the User's
+// shared Subscription of that name instead, with Member naming the consumer in its group
+type Consumer struct {
+	Subscription string
+	Member       string
+}
+
+//subscriptionKey gives the key of a Subscription in Subscribers from the User ID and
+// Subscription name. Unnamed Subscriptions are keyed by the User ID alone
+func subscriptionKey(id, name string) string {
+	if name == "" {
+		return id
+	}
+	return id + ":" + name
+}
+
+//topicKeyEscaper escapes the `:` that separates the Topic name from the Subscription name
+// in User.Subscriptions keys, and the `%` it is escaped with
+var topicKeyEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+//userSubscriptionKey gives the key of a Subscription in User.Subscriptions from the Topic
+// name and Subscription name. The Topic name is escaped as it can contain `:`
+func userSubscriptionKey(topicName, name string) string {
+	return subscriptionKey(topicKeyEscaper.Replace(topicName), name)
+}
+
+//memberKey gives the PushDispatcher worker key of a push consumer of a shared Subscription
+func memberKey(subscriptionKey, memberID string) string {
+	return subscriptionKey + "#" + memberID
+}
+
+//key gives the Subscriber's key in Subscribers
+func (subscriber *Subscriber) key() string {
+	return subscriptionKey(subscriber.ID, subscriber.Name)
+}
+
+//checkName errors if the Subscription or consumer name is empty or would break the keys it is used in
+func checkName(kind, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s name is required", kind)
+	}
+	if strings.ContainsAny(name, "/:#") {
+		return fmt.Errorf("%s name can not contain '/', ':' or '#'", kind)
+	}
+	return nil
+}
+
+//JoinSubscription adds the consumer to the User's shared Subscription of the given name on
+// the Topic. The Subscription is created at the Topic's PointerHead if it does not exist.
+//
+//Giving a PushURL in the options makes the consumer a push consumer that must verify its
+// webhook before receiving messages. The other options set up the Subscription when it is
+// created and are ignored when joining an existing one.
+//
+//Returns the joined consumer
+func (user *User) JoinSubscription(topic *Topic, name, memberID string, options SubscriptionOptions) (GroupMember, error) {
+	if !topic.CanRead(user) {
+		return GroupMember{}, fmt.Errorf("User can not read private Topic %s", topic.Name)
+	}
+	if err := checkName("subscription", name); err != nil {
+		return GroupMember{}, err
+	}
+	if err := checkName("consumer", memberID); err != nil {
+		return GroupMember{}, err
+	}
+	if err := options.validate(topic, true); err != nil {
+		return GroupMember{}, err
+	}
+	//push requests are always signed
+	if options.PushURL != "" && options.Secret == "" {
+		secret, err := randomHex(32)
+		if err != nil {
+			return GroupMember{}, err
+		}
+		options.Secret = secret
+	}
+	now := time.Now()
+	member := &GroupMember{
+		ID:       memberID,
+		PushURL:  options.PushURL,
+		Secret:   options.Secret,
+		Status:   SubscriptionActive,
+		Joined:   now.Format(time.RFC3339),
+		lastSeen: now,
+	}
+	//push consumers wait on the webhook to confirm before receiving messages
+	if member.PushURL != "" {
+		member.Status = SubscriptionPending
+	}
+
+	topic.mu.Lock()
+	sub, position, ok := topic.findSubscriber(subscriptionKey(user.UUID, name))
+	if ok && !sub.Shared {
+		topic.mu.Unlock()
+		return GroupMember{}, fmt.Errorf("subscription %s is not shared", name)
+	}
+	if !ok {
+		sub = &Subscriber{
+			ID:           user.UUID,
+			Name:         name,
+			UsernameHash: user.UsernameHash,
+			mu:           &sync.RWMutex{},
+			deliveries:   newDeliveryHistory(),
+			Creator:      topic.Creator == user.UUID,
+			Status:       SubscriptionActive,
+			//dead-lettering
+			DeadLetterTopic: options.DeadLetterTopic,
+			MaxAttempts:     options.MaxAttempts,
+			MaxAge:          options.MaxAge,
+			RetryPolicy:     options.RetryPolicy,
+			//leasing
+			AckDeadline: options.AckDeadline,
+			//consumer group
+			Shared:  true,
+			Members: make(map[string]*GroupMember),
+			Sticky:  options.Sticky,
+			//filtering
+			Filter: options.Filter,
+			filter: options.filter,
+		}
+		position = topic.PointerHead
+		if _, ok := topic.PointerPositions[position]; !ok {
+			topic.PointerPositions[position] = make(Subscribers)
+		}
+		topic.PointerPositions[position][sub.key()] = sub
+	}
+	//a rejoining consumer keeps the messages it has leased
+	sub.Members[memberID] = member
+	sub.removeTombstone()
+	if err := topic.removeTombstone(); err != nil {
+		topic.mu.Unlock()
+		return GroupMember{}, err
+	}
+	record := sub.record()
+	joined := *member
+	topic.mu.Unlock()
+
+	user.mu.Lock()
+	//add to User subscriber list
+	user.Subscriptions[userSubscriptionKey(topic.Name, name)] = ""
+	//remove any user tombstones
+	if err := user.removeTombstone(); err != nil {
+		user.mu.Unlock()
+		return GroupMember{}, err
+	}
+	user.mu.Unlock()
+	//start delivering if push consumer
+	topic.dispatcher.RegisterMember(topic, sub, member)
+
+	//persist the Subscription with its consumers
+	user.persistLayer.Switchboard().subscriberWriter <- PersistSubscriberStruct{
+		Subscriber: record,
+		MessageID:  position,
+		TopicName:  topic.Name,
+	}
+	return joined, nil
+}
+
+//LeaveSubscription removes the consumer from the User's shared Subscription of the given
+// name. Messages leased to the consumer are handed out to the rest of the group
+func (user *User) LeaveSubscription(topic *Topic, name, memberID string) error {
+	key := subscriptionKey(user.UUID, name)
+	topic.mu.Lock()
+	sub, position, ok := topic.findSubscriber(key)
+	if !ok || !sub.Shared {
+		topic.mu.Unlock()
+		return fmt.Errorf("User has no shared subscription %s on Topic", name)
+	}
+	if _, ok := sub.Members[memberID]; !ok {
+		topic.mu.Unlock()
+		return fmt.Errorf("consumer %s is not in subscription %s", memberID, name)
+	}
+	sub.removeMember(memberID)
+	record := sub.record()
+	topic.mu.Unlock()
+	//stop any push deliveries
+	topic.dispatcher.Deregister(topic.Name, memberKey(key, memberID))
+
+	user.persistLayer.Switchboard().subscriberWriter <- PersistSubscriberStruct{
+		Subscriber: record,
+		MessageID:  position,
+		TopicName:  topic.Name,
+	}
+	return nil
+}
+
+//join finds the pull consumer in the shared Subscriber's group, adding it if new, and marks
+// it as seen. Quiet pull consumers are dropped. Caller must hold topic.mu for writing
+func (subscriber *Subscriber) join(memberID string) error {
+	if memberID == "" {
+		return fmt.Errorf("consumer is required for shared subscription %s", subscriber.Name)
+	}
+	member, ok := subscriber.Members[memberID]
+	if !ok {
+		if err := checkName("consumer", memberID); err != nil {
+			return err
+		}
+		member = &GroupMember{
+			ID:     memberID,
+			Status: SubscriptionActive,
+			Joined: time.Now().Format(time.RFC3339),
+		}
+		subscriber.Members[memberID] = member
+	}
+	if member.PushURL != "" {
+		return fmt.Errorf("consumer %s is a push consumer", memberID)
+	}
+	member.lastSeen = time.Now()
+	subscriber.expireMembers(member.lastSeen)
+	return nil
+}
+
+//expireMembers drops the pull consumers not seen within memberTimeout so their leased
+// messages can be handed to the rest of the group. Caller must hold topic.mu for writing
+func (subscriber *Subscriber) expireMembers(now time.Time) {
+	for id, member := range subscriber.Members {
+		if member.PushURL == "" && member.lastSeen.Add(memberTimeout).Before(now) {
+			subscriber.removeMember(id)
+		}
+	}
+}
+
+//removeMember drops the consumer from the group and releases its leases.
+// Caller must hold topic.mu for writing
+func (subscriber *Subscriber) removeMember(memberID string) {
+	delete(subscriber.Members, memberID)
+	subscriber.leases.release(memberID)
+}
+
+//assigned is whether the message can be handed to the consumer. Messages of Sticky
+// Subscriptions with a Key always go to the same consumer while the group is unchanged.
+// Caller must hold topic.mu
+func (subscriber *Subscriber) assigned(message Message, memberID string) bool {
+	if !subscriber.Sticky || message.Key == "" {
+		return true
+	}
+	return subscriber.assignee(message.Key) == memberID
+}
+
+//assignee picks the consumer a message key belongs to. Rendezvous hashing is used so that
+// only the keys of a joining or departing consumer move when the group changes.
+// Push consumers waiting on verification are left out. Caller must hold topic.mu
+func (subscriber *Subscriber) assignee(key string) string {
+	best, bestScore := "", uint64(0)
+	for id, member := range subscriber.Members {
+		if member.Status == SubscriptionPending {
+			continue
+		}
+		hash := fnv.New64a()
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(id))
+		score := hash.Sum64()
+		if best == "" || score > bestScore || (score == bestScore && id < best) {
+			best, bestScore = id, score
+		}
+	}
+	return best
+}
+
+//record copies the Subscriber for persisting. Pull consumers come and go with their
+// connections so only push consumers are kept. Caller must hold topic.mu
+func (subscriber *Subscriber) record() Subscriber {
+	record := *subscriber
+	if subscriber.Members != nil {
+		record.Members = make(map[string]*GroupMember)
+		for id, member := range subscriber.Members {
+			if member.PushURL != "" {
+				kept := *member
+				record.Members[id] = &kept
+			}
+		}
+	}
+	return record
+}
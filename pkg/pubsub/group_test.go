@@ -0,0 +1,96 @@
+package pubsub
+
+import (
+	"fmt"
+	"testing"
+)
+
+//newGroup creates a Sticky shared Subscriber with active consumers of the given IDs
+func newGroup(ids ...string) *Subscriber {
+	sub := &Subscriber{Shared: true, Sticky: true, Members: make(map[string]*GroupMember)}
+	for _, id := range ids {
+		sub.Members[id] = &GroupMember{ID: id, Status: SubscriptionActive}
+	}
+	return sub
+}
+
+//assignments gives the assignee of each of count keys
+func assignments(sub *Subscriber, count int) map[string]string {
+	assigned := make(map[string]string)
+	for i := 0; i < count; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		assigned[key] = sub.assignee(key)
+	}
+	return assigned
+}
+
+func TestAssigneeStability(t *testing.T) {
+	sub := newGroup("a", "b", "c")
+	before := assignments(sub, 300)
+	counts := make(map[string]int)
+	for _, id := range before {
+		counts[id]++
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if counts[id] == 0 {
+			t.Errorf("consumer %s was assigned no keys of 300", id)
+		}
+	}
+	if again := assignments(sub, 300); fmt.Sprint(again) != fmt.Sprint(before) {
+		t.Errorf("assignee() changed without the group changing")
+	}
+
+	tests := []struct {
+		name   string
+		change func(sub *Subscriber)
+		//moved is the consumer keys are allowed to move to, or from if leaving
+		moved string
+	}{
+		{name: "consumer joins", change: func(sub *Subscriber) {
+			sub.Members["d"] = &GroupMember{ID: "d", Status: SubscriptionActive}
+		}, moved: "d"},
+		{name: "consumer leaves", change: func(sub *Subscriber) { delete(sub.Members, "b") }, moved: "b"},
+		{name: "pending consumer joins", change: func(sub *Subscriber) {
+			sub.Members["e"] = &GroupMember{ID: "e", Status: SubscriptionPending}
+		}},
+	}
+	for _, test := range tests {
+		sub := newGroup("a", "b", "c")
+		test.change(sub)
+		for key, id := range assignments(sub, 300) {
+			if id == before[key] {
+				continue
+			}
+			if test.moved == "" || (id != test.moved && before[key] != test.moved) {
+				t.Errorf("%s: key %s moved from %s to %s", test.name, key, before[key], id)
+			}
+		}
+	}
+}
+
+func TestAssigned(t *testing.T) {
+	sticky := newGroup("a", "b")
+	owner := sticky.assignee("order-1")
+	other := "a"
+	if owner == "a" {
+		other = "b"
+	}
+	tests := []struct {
+		name    string
+		sub     *Subscriber
+		message Message
+		member  string
+		want    bool
+	}{
+		{name: "not sticky", sub: &Subscriber{Shared: true, Members: sticky.Members}, message: Message{Key: "order-1"}, member: other, want: true},
+		{name: "no key", sub: sticky, message: Message{}, member: other, want: true},
+		{name: "key owner", sub: sticky, message: Message{Key: "order-1"}, member: owner, want: true},
+		{name: "other consumer", sub: sticky, message: Message{Key: "order-1"}, member: other, want: false},
+		{name: "empty group", sub: newGroup(), message: Message{Key: "order-1"}, member: "a", want: false},
+	}
+	for _, test := range tests {
+		if got := test.sub.assigned(test.message, test.member); got != test.want {
+			t.Errorf("%s: assigned() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package pubsub
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CDennis-CR/PubSub/pkg/pubsub/pubsubpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	//grpcMaxMessageSize caps the size of request messages
+	grpcMaxMessageSize = 4 << 20
+)
+
+//grpcService implements the PubSub gRPC service described by pubsubpb/pubsub.proto
+type grpcService struct {
+	pubsubpb.UnimplementedPubSubServer
+	pubsub *PubSub
+}
+
+//ServeGRPC serves the PubSub gRPC service to the connections of the listener. It returns
+// when the listener fails
+func (pubsub *PubSub) ServeGRPC(listener net.Listener) error {
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(grpcMaxMessageSize))
+	pubsubpb.RegisterPubSubServer(server, &grpcService{pubsub: pubsub})
+	return server.Serve(listener)
+}
+
+//grpcStatus wraps the error with the gRPC status code. Nil errors stay nil
+func grpcStatus(code codes.Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return status.Error(code, err.Error())
+}
+
+//grpcUser logs in the User of the call from the `username` and `password` metadata,
+// or an `authorization` metadata of `Bearer <token>`
+func (pubsub *PubSub) grpcUser(ctx context.Context) (*User, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	if auth := first("authorization"); auth != "" {
+		pieces := strings.SplitN(auth, " ", 2)
+		if len(pieces) != 2 || !strings.EqualFold(pieces[0], "Bearer") {
+			return nil, status.Error(codes.Unauthenticated, "authorization metadata must be a Bearer token")
+		}
+		user, err := pubsub.TokenUser(strings.TrimSpace(pieces[1]))
+		return user, grpcStatus(codes.Unauthenticated, err)
+	}
+	username, password := first("username"), first("password")
+	if username == "" || password == "" {
+		return nil, status.Error(codes.Unauthenticated, "username and password or a Bearer token must be given as metadata")
+	}
+	user, err := pubsub.GetUser(username, password)
+	return user, grpcStatus(codes.Unauthenticated, err)
+}
+
+//grpcContextStatus gives the status of an error from a call whose context may have ended,
+// falling back to the code if it has not
+func grpcContextStatus(ctx context.Context, code codes.Code, err error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	return grpcStatus(code, err)
+}
+
+//Publish writes the message to the topic, creating the topic if needed as the write endpoint does
+func (service *grpcService) Publish(ctx context.Context, req *pubsubpb.PublishRequest) (*pubsubpb.PublishResponse, error) {
+	user, err := service.pubsub.grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Topic == "" {
+		return nil, status.Error(codes.InvalidArgument, "Topic Name is required")
+	}
+	//messages are stored as text so bytes that are not UTF-8 would be mangled
+	if !utf8.Valid(req.Data) {
+		return nil, status.Error(codes.InvalidArgument, "data must be UTF-8 text - encode binary data, such as with base64, before publishing")
+	}
+	topic, err := service.pubsub.GetTopic(req.Topic, user)
+	if err != nil {
+		return nil, grpcStatus(codes.Internal, err)
+	}
+	msg := Message{Data: string(req.Data), Key: req.Key, Attributes: req.Attributes}
+	msg.AddCreatedDatestring(time.Now())
+	message, err := user.WriteToTopic(topic, msg)
+	if err != nil {
+		return nil, grpcStatus(codes.PermissionDenied, err)
+	}
+	return &pubsubpb.PublishResponse{Message: grpcMessage(message)}, nil
+}
+
+//Pull leases messages from a pull subscription as a batch pull does
+func (service *grpcService) Pull(ctx context.Context, req *pubsubpb.PullRequest) (*pubsubpb.PullResponse, error) {
+	user, err := service.pubsub.grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := service.pubsub.FetchTopic(req.Topic, user)
+	if err != nil {
+		return nil, grpcStatus(codes.NotFound, err)
+	}
+	var wait time.Duration
+	if req.Wait != "" {
+		if wait, err = time.ParseDuration(req.Wait); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "wait is not a valid duration: %v", err)
+		}
+	}
+	msgs, deadline, err := user.PullMessages(ctx, topic, Consumer{Subscription: req.Subscription, Member: req.Consumer}, int(req.MaxMessages), wait)
+	if err != nil {
+		return nil, grpcContextStatus(ctx, codes.FailedPrecondition, err)
+	}
+	resp := &pubsubpb.PullResponse{Messages: make([]*pubsubpb.Message, 0, len(msgs))}
+	for _, msg := range msgs {
+		resp.Messages = append(resp.Messages, grpcMessage(msg))
+	}
+	if !deadline.IsZero() {
+		resp.AckDeadline = deadline.Format(time.RFC3339)
+	}
+	return resp, nil
+}
+
+//Acknowledge acknowledges pulled messages, moving the subscription on
+func (service *grpcService) Acknowledge(ctx context.Context, req *pubsubpb.AcknowledgeRequest) (*pubsubpb.AcknowledgeResponse, error) {
+	user, err := service.pubsub.grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := service.pubsub.FetchTopic(req.Topic, user)
+	if err != nil {
+		return nil, grpcStatus(codes.NotFound, err)
+	}
+	ids := make([]int, 0, len(req.MessageIds))
+	for _, id := range req.MessageIds {
+		ids = append(ids, int(id))
+	}
+	position, err := user.Ack(topic, Consumer{Subscription: req.Subscription, Member: req.Consumer}, ids)
+	if err != nil {
+		return nil, grpcStatus(codes.InvalidArgument, err)
+	}
+	return &pubsubpb.AcknowledgeResponse{PointerPosition: int64(position)}, nil
+}
+
+//Subscribe streams a pull subscription from its pointer until the client cancels the call
+func (service *grpcService) Subscribe(req *pubsubpb.SubscribeRequest, stream grpc.ServerStreamingServer[pubsubpb.Message]) error {
+	ctx := stream.Context()
+	user, err := service.pubsub.grpcUser(ctx)
+	if err != nil {
+		return err
+	}
+	topic, err := service.pubsub.FetchTopic(req.Topic, user)
+	if err != nil {
+		return grpcStatus(codes.NotFound, err)
+	}
+	consumer := Consumer{Subscription: req.Subscription, Member: req.Consumer}
+	err = user.streamSubscription(ctx, topic, consumer, func(msgs []Message) error {
+		ids := make([]int, 0, len(msgs))
+		for _, msg := range msgs {
+			if err := stream.Send(grpcMessage(msg)); err != nil {
+				return err
+			}
+			ids = append(ids, msg.ID)
+		}
+		if req.ManualAck {
+			return nil
+		}
+		_, err := user.Ack(topic, consumer, ids)
+		return err
+	}, nil)
+	return grpcContextStatus(ctx, codes.FailedPrecondition, err)
+}
+
+//CreateTopic creates the topic, making it private if asked
+func (service *grpcService) CreateTopic(ctx context.Context, req *pubsubpb.TopicRequest) (*pubsubpb.Topic, error) {
+	user, err := service.pubsub.grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := service.pubsub.CreateTopic(req.Topic, user)
+	if err != nil {
+		return nil, grpcStatus(codes.AlreadyExists, err)
+	}
+	if req.Private {
+		if _, err := service.pubsub.SetTopicAccess(topic, user, &req.Private, nil, nil); err != nil {
+			return nil, grpcStatus(codes.PermissionDenied, err)
+		}
+	}
+	return grpcTopic(topic, user), nil
+}
+
+//GetTopic gives the topic if the User can read it
+func (service *grpcService) GetTopic(ctx context.Context, req *pubsubpb.TopicRequest) (*pubsubpb.Topic, error) {
+	user, err := service.pubsub.grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := service.pubsub.FetchTopic(req.Topic, user)
+	if err != nil {
+		return nil, grpcStatus(codes.NotFound, err)
+	}
+	if !topic.CanRead(user) {
+		return nil, status.Errorf(codes.PermissionDenied, "User can not read private Topic %s", topic.Name)
+	}
+	return grpcTopic(topic, user), nil
+}
+
+//ListTopics gives the names of the topics the User can read, in order
+func (service *grpcService) ListTopics(ctx context.Context, req *pubsubpb.ListTopicsRequest) (*pubsubpb.ListTopicsResponse, error) {
+	user, err := service.pubsub.grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pubsub := service.pubsub
+	pubsub.mu.RLock()
+	names := make([]string, 0, len(pubsub.Topics))
+	for name, topic := range pubsub.Topics {
+		if topic.CanRead(user) {
+			names = append(names, name)
+		}
+	}
+	pubsub.mu.RUnlock()
+	sort.Strings(names)
+	return &pubsubpb.ListTopicsResponse{Topics: names}, nil
+}
+
+//CreateSubscription subscribes the User to the topic, creating the topic if needed
+func (service *grpcService) CreateSubscription(ctx context.Context, req *pubsubpb.SubscriptionRequest) (*pubsubpb.Subscription, error) {
+	user, err := service.pubsub.grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := service.pubsub.GetTopic(req.Topic, user)
+	if err != nil {
+		return nil, grpcStatus(codes.Internal, err)
+	}
+	if !topic.CanRead(user) {
+		return nil, status.Errorf(codes.PermissionDenied, "User can not read private Topic %s", topic.Name)
+	}
+	options, err := grpcSubscriptionOptions(req)
+	if err != nil {
+		return nil, grpcStatus(codes.InvalidArgument, err)
+	}
+	if err := options.validate(topic, false); err != nil {
+		return nil, grpcStatus(codes.InvalidArgument, err)
+	}
+	//make sure the dead letter topic can be written to
+	if options.DeadLetterTopic != "" {
+		if _, err := service.pubsub.deadLetterTopic(options.DeadLetterTopic, user); err != nil {
+			return nil, grpcStatus(codes.InvalidArgument, err)
+		}
+	}
+	sub, err := user.Subscribe(topic, options)
+	if err != nil {
+		return nil, grpcStatus(codes.Internal, err)
+	}
+	subStatus := "Subscribed"
+	if sub.pending() {
+		subStatus = "Pending"
+	}
+	return grpcSubscription(topic.Name, sub, subStatus), nil
+}
+
+//DeleteSubscription unsubscribes the User's subscription of the given name from the topic
+func (service *grpcService) DeleteSubscription(ctx context.Context, req *pubsubpb.SubscriptionRequest) (*pubsubpb.Subscription, error) {
+	user, err := service.pubsub.grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := service.pubsub.FetchTopic(req.Topic, user)
+	if err != nil {
+		return nil, grpcStatus(codes.NotFound, err)
+	}
+	if err := user.Unsubscribe(topic, req.Subscription); err != nil {
+		return nil, grpcStatus(codes.NotFound, err)
+	}
+	return grpcSubscription(topic.Name, &Subscriber{Name: req.Subscription}, "Unsubscribed"), nil
+}
+
+//------------------------------------------- conversion
+
+//grpcMessage converts the Message for sending. Data that is not a string is sent JSON encoded
+func grpcMessage(msg Message) *pubsubpb.Message {
+	return &pubsubpb.Message{
+		Id:         int64(msg.ID),
+		Data:       msg.dataBytes(),
+		Created:    msg.Created,
+		Key:        msg.Key,
+		Attributes: msg.Attributes,
+	}
+}
+
+//grpcTopic converts the Topic as seen by the User
+func grpcTopic(topic *Topic, user *User) *pubsubpb.Topic {
+	topic.mu.RLock()
+	defer topic.mu.RUnlock()
+	return &pubsubpb.Topic{
+		Name:        topic.Name,
+		Creator:     topic.Creator,
+		PointerHead: int64(topic.PointerHead),
+		Private:     topic.Private,
+		Writable:    user.UUID == topic.Creator,
+	}
+}
+
+//grpcSubscriptionOptions parses the options of the subscription request as the HTTP API does
+func grpcSubscriptionOptions(req *pubsubpb.SubscriptionRequest) (SubscriptionOptions, error) {
+	var statusCodes []int
+	for _, code := range req.RetryStatusCodes {
+		statusCodes = append(statusCodes, int(code))
+	}
+	payload := IncomingReq{
+		Subscription:     req.Subscription,
+		WebhookURL:       req.PushEndpoint,
+		Secret:           req.Secret,
+		AckDeadline:      req.AckDeadline,
+		Filter:           req.Filter,
+		DeadLetterTopic:  req.DeadLetterTopic,
+		MaxAttempts:      int(req.MaxAttempts),
+		MaxAge:           req.MaxAge,
+		RetryMinBackoff:  req.RetryMinBackoff,
+		RetryMaxBackoff:  req.RetryMaxBackoff,
+		RetryMultiplier:  req.RetryMultiplier,
+		RetryJitter:      req.RetryJitter,
+		RetryStatusCodes: statusCodes,
+		RetryAfter:       req.RetryAfter,
+		BatchMaxMessages: int(req.BatchMaxMessages),
+		BatchMaxBytes:    int(req.BatchMaxBytes),
+		BatchLinger:      req.BatchLinger,
+		Sticky:           req.Sticky,
+	}
+	return payload.subscriptionOptions()
+}
+
+//grpcSubscription converts the Subscriber's details
+func grpcSubscription(topicName string, sub *Subscriber, subStatus string) *pubsubpb.Subscription {
+	return &pubsubpb.Subscription{
+		Topic:        topicName,
+		Subscription: sub.Name,
+		Status:       subStatus,
+		PushEndpoint: sub.PushURL,
+		Secret:       sub.Secret,
+		Filter:       sub.Filter,
+	}
+}
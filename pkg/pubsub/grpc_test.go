@@ -0,0 +1,217 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CDennis-CR/PubSub/pkg/pubsub/pubsubpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+//roundTrip marshals the message to the protobuf wire format and back
+func roundTrip(t *testing.T, message proto.Message, into proto.Message) {
+	t.Helper()
+	wire, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatalf("proto.Marshal() error = %v", err)
+	}
+	if err := proto.Unmarshal(wire, into); err != nil {
+		t.Fatalf("proto.Unmarshal() error = %v", err)
+	}
+}
+
+func TestGRPCMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		want    *pubsubpb.Message
+	}{
+		{
+			name:    "empty",
+			message: Message{},
+			want:    &pubsubpb.Message{},
+		},
+		{
+			name:    "string data",
+			message: Message{ID: 7, Data: "hello", Created: "2021-01-02T03:04:05Z", Key: "k"},
+			want:    &pubsubpb.Message{Id: 7, Data: []byte("hello"), Created: "2021-01-02T03:04:05Z", Key: "k"},
+		},
+		{
+			name:    "JSON data is JSON encoded",
+			message: Message{ID: 1, Data: map[string]interface{}{"amount": float64(5)}},
+			want:    &pubsubpb.Message{Id: 1, Data: []byte(`{"amount":5}`)},
+		},
+		{
+			name:    "attributes",
+			message: Message{ID: 300, Data: "x", Attributes: map[string]string{"region": "eu", "empty": ""}},
+			want:    &pubsubpb.Message{Id: 300, Data: []byte("x"), Attributes: map[string]string{"region": "eu", "empty": ""}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := &pubsubpb.Message{}
+			roundTrip(t, grpcMessage(test.message), got)
+			if !proto.Equal(got, test.want) {
+				t.Errorf("grpcMessage(%+v) round trip = %v, want %v", test.message, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGRPCTopicRoundTrip(t *testing.T) {
+	topic := &Topic{Name: "orders", Creator: "creator", PointerHead: 42, Private: true, mu: &sync.RWMutex{}}
+	tests := []struct {
+		name string
+		user *User
+		want *pubsubpb.Topic
+	}{
+		{
+			name: "creator can write",
+			user: &User{UUID: "creator"},
+			want: &pubsubpb.Topic{Name: "orders", Creator: "creator", PointerHead: 42, Private: true, Writable: true},
+		},
+		{
+			name: "reader can not write",
+			user: &User{UUID: "reader"},
+			want: &pubsubpb.Topic{Name: "orders", Creator: "creator", PointerHead: 42, Private: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := &pubsubpb.Topic{}
+			roundTrip(t, grpcTopic(topic, test.user), got)
+			if !proto.Equal(got, test.want) {
+				t.Errorf("grpcTopic() round trip = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGRPCSubscriptionRoundTrip(t *testing.T) {
+	sub := &Subscriber{Name: "audit", PushURL: "https://example.com/hook", Secret: "s3cret", Filter: `key = "a"`}
+	want := &pubsubpb.Subscription{
+		Topic:        "orders",
+		Subscription: "audit",
+		Status:       "Pending",
+		PushEndpoint: "https://example.com/hook",
+		Secret:       "s3cret",
+		Filter:       `key = "a"`,
+	}
+	got := &pubsubpb.Subscription{}
+	roundTrip(t, grpcSubscription("orders", sub, "Pending"), got)
+	if !proto.Equal(got, want) {
+		t.Errorf("grpcSubscription() round trip = %v, want %v", got, want)
+	}
+}
+
+func TestGRPCPublish(t *testing.T) {
+	pubsub, _ := newTestPubSub(t)
+	service := &grpcService{pubsub: pubsub}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("username", "creator", "password", "password"))
+	tests := []struct {
+		name     string
+		req      *pubsubpb.PublishRequest
+		wantCode codes.Code
+	}{
+		{name: "text", req: &pubsubpb.PublishRequest{Topic: "orders", Data: []byte("héllo")}, wantCode: codes.OK},
+		{name: "empty data", req: &pubsubpb.PublishRequest{Topic: "orders"}, wantCode: codes.OK},
+		{name: "binary data", req: &pubsubpb.PublishRequest{Topic: "orders", Data: []byte{0xff, 0xfe, 0x00}}, wantCode: codes.InvalidArgument},
+		{name: "no topic", req: &pubsubpb.PublishRequest{Data: []byte("hello")}, wantCode: codes.InvalidArgument},
+	}
+	for _, test := range tests {
+		resp, err := service.Publish(ctx, test.req)
+		if got := status.Code(err); got != test.wantCode {
+			t.Errorf("%s: Publish() code = %s, want %s (%v)", test.name, got, test.wantCode, err)
+			continue
+		}
+		if err == nil && !bytes.Equal(resp.Message.Data, test.req.Data) {
+			t.Errorf("%s: Publish() data = %q, want %q", test.name, resp.Message.Data, test.req.Data)
+		}
+	}
+}
+
+func TestGRPCSubscriptionOptions(t *testing.T) {
+	req := &pubsubpb.SubscriptionRequest{
+		Subscription:     "audit",
+		PushEndpoint:     "https://example.com/hook",
+		DeadLetterTopic:  "orders-dead",
+		MaxAttempts:      5,
+		MaxAge:           "1h",
+		RetryMinBackoff:  "1s",
+		RetryMaxBackoff:  "1m",
+		RetryMultiplier:  1.5,
+		RetryJitter:      0.2,
+		RetryStatusCodes: []int32{200, 204},
+		RetryAfter:       true,
+		BatchMaxMessages: 10,
+		BatchMaxBytes:    1024,
+		BatchLinger:      "500ms",
+		Sticky:           true,
+	}
+	want := SubscriptionOptions{
+		Name:            "audit",
+		PushURL:         "https://example.com/hook",
+		DeadLetterTopic: "orders-dead",
+		MaxAttempts:     5,
+		MaxAge:          time.Hour,
+		RetryPolicy: RetryPolicy{
+			MinBackoff:          time.Second,
+			MaxBackoff:          time.Minute,
+			Multiplier:          1.5,
+			Jitter:              0.2,
+			AcceptedStatusCodes: []int{200, 204},
+			HonourRetryAfter:    true,
+		},
+		BatchMaxMessages: 10,
+		BatchMaxBytes:    1024,
+		BatchLinger:      500 * time.Millisecond,
+		Sticky:           true,
+	}
+	got, err := grpcSubscriptionOptions(req)
+	if err != nil {
+		t.Fatalf("grpcSubscriptionOptions() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("grpcSubscriptionOptions() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGRPCCreateSubscriptionInvalid(t *testing.T) {
+	pubsub, _ := newTestPubSub(t)
+	service := &grpcService{pubsub: pubsub}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("username", "creator", "password", "password"))
+	push := "https://example.com/hook"
+	tests := []struct {
+		name string
+		req  *pubsubpb.SubscriptionRequest
+	}{
+		{name: "bad max_age", req: &pubsubpb.SubscriptionRequest{PushEndpoint: push, DeadLetterTopic: "dead", MaxAge: "soon"}},
+		{name: "bad retry backoff", req: &pubsubpb.SubscriptionRequest{PushEndpoint: push, RetryMinBackoff: "1"}},
+		{name: "bad batch linger", req: &pubsubpb.SubscriptionRequest{PushEndpoint: push, BatchLinger: "later"}},
+		{name: "max_attempts without dead letter topic", req: &pubsubpb.SubscriptionRequest{PushEndpoint: push, MaxAttempts: 3}},
+		{name: "dead letter topic of a pull subscription", req: &pubsubpb.SubscriptionRequest{DeadLetterTopic: "dead"}},
+		{name: "batching a pull subscription", req: &pubsubpb.SubscriptionRequest{BatchMaxMessages: 10}},
+		{name: "sticky without sharing", req: &pubsubpb.SubscriptionRequest{Sticky: true}},
+		{name: "dead letter topic of another user", req: &pubsubpb.SubscriptionRequest{PushEndpoint: push, DeadLetterTopic: "others"}},
+	}
+	reader, err := pubsub.GetUser("reader", "password")
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if _, err := pubsub.GetTopic("others", reader); err != nil {
+		t.Fatalf("GetTopic() error = %v", err)
+	}
+	for _, test := range tests {
+		test.req.Topic = "orders"
+		if _, err := service.CreateSubscription(ctx, test.req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: CreateSubscription() error = %v, want code %s", test.name, err, codes.InvalidArgument)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package pubsub
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	//deliveryHistorySize is the number of recent delivery attempts kept per Subscriber
+	deliveryHistorySize = 50
+	//DeliveryTypePush is the DeliveryAttempt type of a push of messages to a webhook
+	DeliveryTypePush = "delivery"
+	//DeliveryTypeVerification is the DeliveryAttempt type of a webhook verification request
+	DeliveryTypeVerification = "verification"
+)
+
+//DeliveryAttempt records the outcome of a single request to a push Subscriber's webhook
+type DeliveryAttempt struct {
+	Timestamp string `json:"timestamp"`
+	//Type is DeliveryTypePush or DeliveryTypeVerification
+	Type string `json:"type"`
+	//MessageID is the ID of the first message sent. BatchSize is the number of messages sent
+	MessageID  int    `json:"message_id"`
+	BatchSize  int    `json:"batch_size,omitempty"`
+	DeliveryID string `json:"delivery_id,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	//Consumer is the push consumer of a shared Subscription the attempt was made to
+	Consumer string `json:"consumer,omitempty"`
+	//Latency is the time taken for the webhook to respond in milliseconds
+	Latency int64  `json:"latency_ms"`
+	Error   string `json:"error,omitempty"`
+}
+
+//deliveryHistory is a fixed size ring buffer of a Subscriber's most recent delivery attempts.
+// It is kept in memory only
+type deliveryHistory struct {
+	mu       *sync.Mutex
+	attempts []DeliveryAttempt
+	next     int //next is the index the next attempt is written to once the buffer is full
+}
+
+//newDeliveryHistory creates an empty deliveryHistory
+func newDeliveryHistory() *deliveryHistory {
+	return &deliveryHistory{
+		mu:       &sync.Mutex{},
+		attempts: make([]DeliveryAttempt, 0, deliveryHistorySize),
+	}
+}
+
+//record adds the attempt, overwriting the oldest when full
+func (history *deliveryHistory) record(attempt DeliveryAttempt) {
+	if history == nil {
+		return
+	}
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	if len(history.attempts) < deliveryHistorySize {
+		history.attempts = append(history.attempts, attempt)
+		return
+	}
+	history.attempts[history.next] = attempt
+	history.next = (history.next + 1) % deliveryHistorySize
+}
+
+//list gives the recorded attempts, most recent first
+func (history *deliveryHistory) list() []DeliveryAttempt {
+	if history == nil {
+		return []DeliveryAttempt{}
+	}
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	out := make([]DeliveryAttempt, 0, len(history.attempts))
+	for i := len(history.attempts) - 1; i >= 0; i-- {
+		out = append(out, history.attempts[(history.next+i)%len(history.attempts)])
+	}
+	return out
+}
+
+//recordAttempt adds a request to the worker's webhook to the Subscriber's delivery history
+func (worker *pushWorker) recordAttempt(attemptType string, messages []Message, started time.Time, statusCode int, err error) {
+	attempt := DeliveryAttempt{
+		Timestamp:  started.Format(time.RFC3339Nano),
+		Type:       attemptType,
+		StatusCode: statusCode,
+		Latency:    time.Since(started).Milliseconds(),
+	}
+	if len(messages) > 0 {
+		attempt.MessageID = messages[0].ID
+		attempt.BatchSize = len(messages)
+		attempt.DeliveryID = worker.deliveryID
+	}
+	if worker.member != nil {
+		attempt.Consumer = worker.member.ID
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	worker.subscriber.deliveries.record(attempt)
+}
@@ -23,8 +23,9 @@ func getReady(superUsername, superUserpassword string) *PubSub {
 		Topics:    make(Topics),
 		Users:     users,
 		mu:        &sync.RWMutex{},
-		sseDistro: SSENewDistro(),
+		sseDistro: SSENewDistro(sseBufferSize, sseOverflow),
 	}
+	pubsub.pushDispatcher = NewPushDispatcher(pubsub, pushConcurrency)
 	//start server side events goroutine
 	go pubsub.sseDistro.Routine()
 	//start regular task ticks
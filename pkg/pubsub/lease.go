@@ -0,0 +1,277 @@
+package pubsub
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	//defaultAckDeadline is how long pulled messages are leased for when the Subscriber does not set an AckDeadline
+	defaultAckDeadline = 10 * time.Second
+	//maxAckDeadline is the longest a pulled message can be leased for
+	maxAckDeadline = 10 * time.Minute
+)
+
+//leaseTable tracks the pulled but unacknowledged messages of a pull Subscriber.
+// It is kept in memory only and guarded by the Topic's mu
+type leaseTable struct {
+	//deadlines is keyed by message ID. Messages are redelivered once their deadline passes
+	deadlines map[int]time.Time
+	//acked holds message IDs acknowledged ahead of the Subscriber's pointer
+	acked map[int]bool
+	//owners holds the consumer each message is leased to for shared Subscribers
+	owners map[int]string
+}
+
+//newLeaseTable creates an empty leaseTable
+func newLeaseTable() *leaseTable {
+	return &leaseTable{
+		deadlines: make(map[int]time.Time),
+		acked:     make(map[int]bool),
+		owners:    make(map[int]string),
+	}
+}
+
+//available is whether the message can be handed out - not acknowledged and not under an unexpired lease
+func (leases *leaseTable) available(messageID int, now time.Time) bool {
+	if leases.acked[messageID] {
+		return false
+	}
+	deadline, ok := leases.deadlines[messageID]
+	return !ok || !deadline.After(now)
+}
+
+//nextExpiry gives the earliest unexpired lease deadline or the zero time if there are none
+func (leases *leaseTable) nextExpiry(now time.Time) time.Time {
+	next := time.Time{}
+	for _, deadline := range leases.deadlines {
+		if deadline.After(now) && (next.IsZero() || deadline.Before(next)) {
+			next = deadline
+		}
+	}
+	return next
+}
+
+//forget drops the leases and acknowledgements of messages below the position
+func (leases *leaseTable) forget(position int) {
+	if leases == nil {
+		return
+	}
+	for id := range leases.deadlines {
+		if id < position {
+			delete(leases.deadlines, id)
+		}
+	}
+	for id := range leases.acked {
+		if id < position {
+			delete(leases.acked, id)
+		}
+	}
+	for id := range leases.owners {
+		if id < position {
+			delete(leases.owners, id)
+		}
+	}
+}
+
+//clear drops all leases and acknowledgements
+func (leases *leaseTable) clear() {
+	if leases == nil {
+		return
+	}
+	leases.deadlines = make(map[int]time.Time)
+	leases.acked = make(map[int]bool)
+	leases.owners = make(map[int]string)
+}
+
+//lease hands the message to the owner until the deadline
+func (leases *leaseTable) lease(messageID int, owner string, deadline time.Time) {
+	leases.deadlines[messageID] = deadline
+	if owner != "" {
+		leases.owners[messageID] = owner
+	}
+}
+
+//release drops the leases of the owner so its messages are handed out again
+func (leases *leaseTable) release(owner string) {
+	if leases == nil {
+		return
+	}
+	for id, leasedTo := range leases.owners {
+		if leasedTo == owner {
+			delete(leases.deadlines, id)
+			delete(leases.owners, id)
+		}
+	}
+}
+
+//checkOwner errors if the message is under an unexpired lease of a consumer other than the owner
+func (leases *leaseTable) checkOwner(messageID int, owner string, now time.Time) error {
+	leasedTo, ok := leases.owners[messageID]
+	if !ok || leasedTo == owner {
+		return nil
+	}
+	if deadline, ok := leases.deadlines[messageID]; ok && deadline.After(now) {
+		return fmt.Errorf("message #%d is leased to another consumer", messageID)
+	}
+	return nil
+}
+
+//checkLease errors if the message is not under an unexpired lease held by the owner
+func (leases *leaseTable) checkLease(messageID int, owner string, now time.Time) error {
+	deadline, ok := leases.deadlines[messageID]
+	if !ok {
+		return fmt.Errorf("message #%d is not leased", messageID)
+	}
+	if leasedTo := leases.owners[messageID]; leasedTo != owner {
+		return fmt.Errorf("message #%d is leased to another consumer", messageID)
+	}
+	if !deadline.After(now) {
+		return fmt.Errorf("lease on message #%d has expired", messageID)
+	}
+	return nil
+}
+
+//ackDeadline gives the lease duration of messages pulled by the Subscriber
+func (subscriber *Subscriber) ackDeadline() time.Duration {
+	if subscriber.AckDeadline == 0 {
+		return defaultAckDeadline
+	}
+	return subscriber.AckDeadline
+}
+
+//leaseSubscriber finds the Subscriber the Consumer pulls from and its pointer position.
+// Pull consumers of shared Subscribers are joined to the group. Caller must hold topic.mu for writing
+func (topic *Topic) leaseSubscriber(user *User, consumer Consumer) (*Subscriber, int, error) {
+	sub, position, ok := topic.findSubscriber(subscriptionKey(user.UUID, consumer.Subscription))
+	if !ok {
+		if consumer.Subscription != "" {
+			return nil, 0, fmt.Errorf("User has no subscription %s on Topic", consumer.Subscription)
+		}
+		return nil, 0, fmt.Errorf("User not subscribed to Topic")
+	}
+	if sub.leases == nil {
+		sub.leases = newLeaseTable()
+	}
+	if sub.Shared {
+		if err := sub.join(consumer.Member); err != nil {
+			return nil, 0, err
+		}
+		return sub, position, nil
+	}
+	if sub.PushURL != "" {
+		return nil, 0, fmt.Errorf("operationn not allowed - user attempting to pull from push subscription")
+	}
+	return sub, position, nil
+}
+
+//checkMessageIDs errors if any of the message IDs have not been written to the Topic.
+// Caller must hold topic.mu
+func (topic *Topic) checkMessageIDs(messageIDs []int) error {
+	if len(messageIDs) == 0 {
+		return fmt.Errorf("message_ids are required")
+	}
+	for _, id := range messageIDs {
+		if id >= topic.PointerHead || id < 0 {
+			return fmt.Errorf("message #%d does not exist - head point is %d so latest message is #%d", id, topic.PointerHead, topic.PointerHead-1)
+		}
+	}
+	return nil
+}
+
+//Ack acknowledges the pulled messages so they are not redelivered. The Subscription's pointer
+// moves past all messages that have been acknowledged without gaps.
+//
+//Acknowledging messages that are already acknowledged does nothing. Other messages must be
+// under an unexpired lease from a pull by the same consumer, so messages can not be skipped
+// without being pulled. Returns the new pointer position
+func (user *User) Ack(topic *Topic, consumer Consumer, messageIDs []int) (int, error) {
+	topic.mu.Lock()
+	defer topic.mu.Unlock()
+	sub, position, err := topic.leaseSubscriber(user, consumer)
+	if err != nil {
+		return 0, err
+	}
+	if err := topic.checkMessageIDs(messageIDs); err != nil {
+		return position, err
+	}
+	now := time.Now()
+	for _, id := range messageIDs {
+		if id < position || sub.leases.acked[id] {
+			continue
+		}
+		if err := sub.leases.checkLease(id, consumer.Member, now); err != nil {
+			return position, err
+		}
+	}
+	return topic.acknowledge(sub, position, messageIDs), nil
+}
+
+//acknowledge marks the messages as acknowledged and advances the Subscriber over
+// contiguously acknowledged messages. Returns the new pointer position.
+// Caller must hold topic.mu for writing
+func (topic *Topic) acknowledge(sub *Subscriber, position int, messageIDs []int) int {
+	for _, id := range messageIDs {
+		if id < position {
+			continue
+		}
+		delete(sub.leases.deadlines, id)
+		delete(sub.leases.owners, id)
+		sub.leases.acked[id] = true
+	}
+	//advance over contiguously acknowledged messages
+	next := position
+	for sub.leases.acked[next] {
+		next++
+	}
+	topic.moveSubscriber(sub, position, next)
+	sub.leases.forget(next)
+	return next
+}
+
+//Nack releases the leases on the pulled messages so they are redelivered on the next pull
+func (user *User) Nack(topic *Topic, consumer Consumer, messageIDs []int) error {
+	return user.ModifyDeadline(topic, consumer, messageIDs, 0)
+}
+
+//ModifyDeadline sets the leases of pulled messages to expire after the deadline from now.
+// Extending gives a consumer more time to process. A zero deadline is the same as Nack
+func (user *User) ModifyDeadline(topic *Topic, consumer Consumer, messageIDs []int, deadline time.Duration) error {
+	if deadline < 0 || deadline > maxAckDeadline {
+		return fmt.Errorf("ack_deadline must be between 0s and %s", maxAckDeadline)
+	}
+	topic.mu.Lock()
+	defer topic.mu.Unlock()
+	sub, position, err := topic.leaseSubscriber(user, consumer)
+	if err != nil {
+		return err
+	}
+	if err := topic.checkMessageIDs(messageIDs); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, id := range messageIDs {
+		if _, ok := sub.leases.deadlines[id]; !ok {
+			if id < position || sub.leases.acked[id] {
+				return fmt.Errorf("message #%d has already been acknowledged", id)
+			}
+			return fmt.Errorf("message #%d is not leased", id)
+		}
+		if err := sub.leases.checkOwner(id, consumer.Member, now); err != nil {
+			return err
+		}
+	}
+	for _, id := range messageIDs {
+		if deadline == 0 {
+			delete(sub.leases.deadlines, id)
+			delete(sub.leases.owners, id)
+			continue
+		}
+		sub.leases.deadlines[id] = now.Add(deadline)
+	}
+	//released messages go straight to pulls waiting on the Topic
+	if deadline == 0 {
+		topic.announce()
+	}
+	return nil
+}
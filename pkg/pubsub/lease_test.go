@@ -0,0 +1,146 @@
+package pubsub
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//newPullTopic creates a Topic with count messages and a pull Subscription of the returned User
+// whose messages are leased for ackDeadline
+func newPullTopic(t *testing.T, count int, ackDeadline time.Duration) (*Topic, *User) {
+	t.Helper()
+	pubsub, creator := newTestPubSub(t)
+	topic, err := pubsub.CreateTopic("orders", creator)
+	if err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	reader, err := pubsub.GetUser("reader", "password")
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if _, err := reader.Subscribe(topic, SubscriptionOptions{AckDeadline: ackDeadline}); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	writeMessages(t, creator, topic, count, time.Now())
+	return topic, reader
+}
+
+//pullIDs pulls up to max messages without waiting and gives their IDs
+func pullIDs(t *testing.T, user *User, topic *Topic, max int) []int {
+	t.Helper()
+	msgs, _, err := user.PullMessages(context.Background(), topic, Consumer{}, max, 0)
+	if err != nil {
+		t.Fatalf("PullMessages() error = %v", err)
+	}
+	ids := []int{}
+	for _, msg := range msgs {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func TestAckAdvancesOverContiguousAcks(t *testing.T) {
+	tests := []struct {
+		name      string
+		acks      [][]int
+		positions []int
+	}{
+		{name: "in order", acks: [][]int{{0}, {1}, {2}}, positions: []int{1, 2, 3}},
+		{name: "out of order", acks: [][]int{{2}, {1}, {0}}, positions: []int{0, 0, 3}},
+		{name: "gaps filled later", acks: [][]int{{0, 2, 4}, {1}, {3}}, positions: []int{1, 3, 5}},
+		{name: "repeated acks", acks: [][]int{{1}, {1}, {0}, {0}}, positions: []int{0, 0, 2, 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topic, reader := newPullTopic(t, 5, time.Minute)
+			if got := pullIDs(t, reader, topic, 5); !reflect.DeepEqual(got, []int{0, 1, 2, 3, 4}) {
+				t.Fatalf("pulled %v, want [0 1 2 3 4]", got)
+			}
+			for i, ids := range test.acks {
+				position, err := reader.Ack(topic, Consumer{}, ids)
+				if err != nil {
+					t.Fatalf("Ack(%v) error = %v", ids, err)
+				}
+				if position != test.positions[i] {
+					t.Errorf("Ack(%v) position = %d, want %d", ids, position, test.positions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAckRequiresLease(t *testing.T) {
+	topic, reader := newPullTopic(t, 2, 20*time.Millisecond)
+	if _, err := reader.Ack(topic, Consumer{}, []int{0}); err == nil {
+		t.Errorf("Ack() of an unpulled message error = nil, want an error")
+	}
+	pullIDs(t, reader, topic, 1)
+	time.Sleep(40 * time.Millisecond)
+	if _, err := reader.Ack(topic, Consumer{}, []int{0}); err == nil {
+		t.Errorf("Ack() after the lease expired error = nil, want an error")
+	}
+	if _, err := reader.Ack(topic, Consumer{}, []int{2}); err == nil {
+		t.Errorf("Ack() of an unwritten message error = nil, want an error")
+	}
+}
+
+func TestPullRedeliversAfterDeadline(t *testing.T) {
+	topic, reader := newPullTopic(t, 1, 100*time.Millisecond)
+	if got := pullIDs(t, reader, topic, 1); !reflect.DeepEqual(got, []int{0}) {
+		t.Fatalf("first pull = %v, want [0]", got)
+	}
+	if got := pullIDs(t, reader, topic, 1); len(got) != 0 {
+		t.Errorf("pull under lease = %v, want none", got)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if got := pullIDs(t, reader, topic, 1); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("pull after the deadline = %v, want [0]", got)
+	}
+}
+
+func TestModifyDeadline(t *testing.T) {
+	topic, reader := newPullTopic(t, 1, 20*time.Millisecond)
+	pullIDs(t, reader, topic, 1)
+	if err := reader.ModifyDeadline(topic, Consumer{}, []int{0}, time.Minute); err != nil {
+		t.Fatalf("ModifyDeadline() error = %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if got := pullIDs(t, reader, topic, 1); len(got) != 0 {
+		t.Errorf("pull after extending the deadline = %v, want none", got)
+	}
+	if position, err := reader.Ack(topic, Consumer{}, []int{0}); err != nil || position != 1 {
+		t.Errorf("Ack() = %d, %v, want 1, nil", position, err)
+	}
+	for _, deadline := range []time.Duration{-time.Second, maxAckDeadline + time.Second} {
+		if err := reader.ModifyDeadline(topic, Consumer{}, []int{0}, deadline); err == nil {
+			t.Errorf("ModifyDeadline(%s) error = nil, want an error", deadline)
+		}
+	}
+}
+
+func TestNack(t *testing.T) {
+	topic, reader := newPullTopic(t, 2, time.Minute)
+	if got := pullIDs(t, reader, topic, 2); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Fatalf("first pull = %v, want [0 1]", got)
+	}
+	if err := reader.Nack(topic, Consumer{}, []int{1}); err != nil {
+		t.Fatalf("Nack() error = %v", err)
+	}
+	if got := pullIDs(t, reader, topic, 2); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("pull after Nack = %v, want [1]", got)
+	}
+	if _, err := reader.Ack(topic, Consumer{}, []int{0}); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if err := reader.Nack(topic, Consumer{}, []int{0}); err == nil {
+		t.Errorf("Nack() of an acknowledged message error = nil, want an error")
+	}
+	if err := reader.Nack(topic, Consumer{}, []int{1}); err != nil {
+		t.Errorf("Nack() error = %v", err)
+	}
+	if err := reader.Nack(topic, Consumer{}, []int{1}); err == nil {
+		t.Errorf("Nack() of a released message error = nil, want an error")
+	}
+}
@@ -1,6 +1,7 @@
 package pubsub
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -18,3 +19,20 @@ func (message *Message) AddCreatedDatestring(time.Time) string {
 	message.Created = time.Now().Format(time.RFC3339)
 	return message.Created
 }
+
+//dataBytes gives the message Data as raw bytes for protocols without JSON payloads.
+// Data that is not a string, such as JSON written to the HTTP API, is JSON encoded
+func (message Message) dataBytes() []byte {
+	switch data := message.Data.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(data)
+	default:
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil
+		}
+		return encoded
+	}
+}
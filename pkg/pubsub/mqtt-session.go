@@ -0,0 +1,700 @@
+package pubsub
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+//mqttBroker runs the MQTT sessions of a listener. The subscriptions of sessions that
+// are not clean are kept between connections
+type mqttBroker struct {
+	pubsub *PubSub
+	mu     *sync.Mutex
+	//connected holds the connected sessions by client ID
+	connected map[string]*mqttSession
+	//stored holds the state of the sessions that are not clean by client ID
+	stored map[string]*mqttState
+}
+
+//mqttState is the subscriptions of an MQTT session
+type mqttState struct {
+	user *User
+	//filters holds the QoS granted to each subscribed topic filter
+	filters map[string]byte
+	//topics holds the names of the Topics given a pull Subscription for QoS 1 delivery
+	topics map[string]bool
+}
+
+func newMQTTState(user *User) *mqttState {
+	return &mqttState{
+		user:    user,
+		filters: make(map[string]byte),
+		topics:  make(map[string]bool),
+	}
+}
+
+//qos gives the highest QoS granted to the filters matching the topic name.
+// Returns false if none match
+func (state *mqttState) qos(topicName string) (byte, bool) {
+	qos, matched := byte(0), false
+	for filter, granted := range state.filters {
+		if mqttMatch(filter, topicName) {
+			matched = true
+			if granted > qos {
+				qos = granted
+			}
+		}
+	}
+	return qos, matched
+}
+
+//mqttInflight is a Message sent at QoS 1 that the client has not acknowledged with PUBACK
+type mqttInflight struct {
+	topic     *Topic
+	messageID int
+	//retained messages are not sent from the pull Subscription so are not acknowledged to it
+	retained bool
+}
+
+//mqttSession serves an MQTT client connection.
+//
+//QoS 0 subscriptions are sent Messages from the SSE fan-out as they are written. QoS 1
+// subscriptions give the client a pull Subscription on each matching Topic, named
+// after its client ID, that is streamed from its pointer. PUBACKs acknowledge the Messages
+// so the pointer only moves past Messages the client has received
+type mqttSession struct {
+	broker    *mqttBroker
+	conn      net.Conn
+	clientID  string
+	clean     bool
+	keepAlive time.Duration
+	user      *User
+	will      *mqttPublishPacket
+	ctx       context.Context
+	cancel    context.CancelFunc
+	//done is closed once the session has ended and its state has been tidied up
+	done chan struct{}
+	out  chan []byte
+	//streaming waits on the QoS 1 streams
+	streaming *sync.WaitGroup
+	//mu guards the state, streams and inflight Messages
+	mu    *sync.Mutex
+	state *mqttState
+	//streams holds the cancel functions of the running QoS 1 streams by Topic name
+	streams  map[string]context.CancelFunc
+	inflight map[uint16]mqttInflight
+	nextID   uint16
+}
+
+//ServeMQTT serves MQTT 3.1.1 clients connecting to the listener. Only returns when
+// the listener fails
+func (pubsub *PubSub) ServeMQTT(listener net.Listener) error {
+	broker := &mqttBroker{
+		pubsub:    pubsub,
+		mu:        &sync.Mutex{},
+		connected: make(map[string]*mqttSession),
+		stored:    make(map[string]*mqttState),
+	}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				log.Printf("error accepting MQTT connection: %v\n", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go broker.serve(conn)
+	}
+}
+
+//serve runs the client connection from CONNECT until it is closed
+func (broker *mqttBroker) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(mqttConnectTimeout))
+	packet, err := readMQTTPacket(reader)
+	if err != nil || packet.Type != mqttConnect {
+		conn.Close()
+		return
+	}
+	connect, err := parseMQTTConnect(packet.Body)
+	if err != nil {
+		log.Printf("MQTT client %s sent an invalid CONNECT: %v\n", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	session, present, code := broker.connect(conn, connect)
+	conn.SetWriteDeadline(time.Now().Add(mqttWriteTimeout))
+	connack := mqttPacket{Type: mqttConnack, Body: []byte{0, code}}
+	if present {
+		connack.Body[0] = 1
+	}
+	_, err = conn.Write(connack.bytes())
+	if code != mqttAccepted {
+		conn.Close()
+		return
+	}
+	if err != nil {
+		session.end(false)
+		return
+	}
+
+	go session.writeLoop()
+	go session.streamLive()
+	//resume the QoS 1 streams of a stored session
+	session.mu.Lock()
+	resumed := []string{}
+	for filter, qos := range session.state.filters {
+		if qos == 1 {
+			resumed = append(resumed, filter)
+		}
+	}
+	session.mu.Unlock()
+	for _, filter := range resumed {
+		session.streamFilter(filter)
+	}
+
+	for {
+		//clients must send something within one and a half keep alive periods
+		if session.keepAlive > 0 {
+			conn.SetReadDeadline(time.Now().Add(session.keepAlive * 3 / 2))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+		packet, err := readMQTTPacket(reader)
+		if err != nil {
+			session.end(false)
+			return
+		}
+		if packet.Type == mqttDisconnect {
+			session.end(true)
+			return
+		}
+		if err := session.handle(packet); err != nil {
+			log.Printf("MQTT client %s disconnected: %v\n", session.clientID, err)
+			session.end(false)
+			return
+		}
+	}
+}
+
+//connect logs the client in and registers its session, disconnecting any other
+// connection with the same client ID. Returns whether a stored session was resumed
+// and the CONNACK return code
+func (broker *mqttBroker) connect(conn net.Conn, connect mqttConnectPacket) (*mqttSession, bool, byte) {
+	if connect.ProtocolName != "MQTT" || connect.ProtocolLevel != 4 {
+		return nil, false, mqttBadProtocolVersion
+	}
+	//the client ID names the client's pull Subscriptions so must be a valid name
+	if connect.ClientID == "" {
+		if !connect.CleanSession {
+			return nil, false, mqttIdentifierRejected
+		}
+		connect.ClientID = RandomString(16)
+	}
+	if strings.ContainsAny(connect.ClientID, "/:#") {
+		return nil, false, mqttIdentifierRejected
+	}
+	if connect.Username == "" || connect.Password == "" {
+		return nil, false, mqttNotAuthorized
+	}
+	user, err := broker.pubsub.GetUser(connect.Username, connect.Password)
+	if err != nil {
+		return nil, false, mqttBadUsernamePassword
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &mqttSession{
+		broker:    broker,
+		conn:      conn,
+		clientID:  connect.ClientID,
+		clean:     connect.CleanSession,
+		keepAlive: connect.KeepAlive,
+		user:      user,
+		will:      connect.Will,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		out:       make(chan []byte, broker.pubsub.sseDistro.BufferSize),
+		streaming: &sync.WaitGroup{},
+		mu:        &sync.Mutex{},
+		streams:   make(map[string]context.CancelFunc),
+		inflight:  make(map[uint16]mqttInflight),
+	}
+	for {
+		broker.mu.Lock()
+		previous, ok := broker.connected[connect.ClientID]
+		if ok {
+			broker.mu.Unlock()
+			previous.close()
+			<-previous.done
+			continue
+		}
+		broker.connected[connect.ClientID] = session
+		stored, present := broker.stored[connect.ClientID]
+		//stored sessions are dropped by clean sessions and by other Users taking the client ID
+		if present && (connect.CleanSession || stored.user != user) {
+			delete(broker.stored, connect.ClientID)
+			present = false
+			defer broker.discard(stored, connect.ClientID)
+		}
+		switch {
+		case present:
+			session.state = stored
+		case connect.CleanSession:
+			session.state = newMQTTState(user)
+		default:
+			session.state = newMQTTState(user)
+			broker.stored[connect.ClientID] = session.state
+		}
+		broker.mu.Unlock()
+		return session, present, mqttAccepted
+	}
+}
+
+//discard removes the pull Subscriptions of the session state
+func (broker *mqttBroker) discard(state *mqttState, clientID string) {
+	for topicName := range state.topics {
+		topic, err := broker.pubsub.FetchTopic(topicName, state.user)
+		if err != nil {
+			continue
+		}
+		if err := state.user.Unsubscribe(topic, mqttSubscriptionName(clientID)); err != nil {
+			log.Printf("error removing subscription of MQTT client %s from Topic %s: %v\n", clientID, topicName, err)
+		}
+	}
+}
+
+//mqttSubscriptionName names the pull Subscriptions of the client ID
+func mqttSubscriptionName(clientID string) string {
+	return "mqtt-" + clientID
+}
+
+//close disconnects the client
+func (session *mqttSession) close() {
+	session.cancel()
+	session.conn.Close()
+}
+
+//end tidies up after the client has disconnected. The will message is published
+// unless the client disconnected with DISCONNECT
+func (session *mqttSession) end(graceful bool) {
+	session.close()
+	session.mu.Lock()
+	for _, cancel := range session.streams {
+		cancel()
+	}
+	session.mu.Unlock()
+	//streams release their unacknowledged Messages as they end
+	session.streaming.Wait()
+
+	if !graceful && session.will != nil {
+		if err := session.publish(*session.will); err != nil {
+			log.Printf("error publishing will message of MQTT client %s: %v\n", session.clientID, err)
+		}
+	}
+	if session.clean {
+		session.broker.discard(session.state, session.clientID)
+	}
+	session.broker.mu.Lock()
+	if session.broker.connected[session.clientID] == session {
+		delete(session.broker.connected, session.clientID)
+	}
+	session.broker.mu.Unlock()
+	close(session.done)
+}
+
+//writeLoop writes queued packets to the client. The session is ended if a write fails
+func (session *mqttSession) writeLoop() {
+	defer session.conn.Close()
+	for {
+		select {
+		case <-session.ctx.Done():
+			return
+		case packet := <-session.out:
+			session.conn.SetWriteDeadline(time.Now().Add(mqttWriteTimeout))
+			if _, err := session.conn.Write(packet); err != nil {
+				session.cancel()
+				return
+			}
+		}
+	}
+}
+
+//send queues the packet for the client, waiting while the queue is full.
+// Returns false if the session ended first
+func (session *mqttSession) send(packet mqttPacket) bool {
+	select {
+	case session.out <- packet.bytes():
+		return true
+	case <-session.ctx.Done():
+		return false
+	}
+}
+
+//handle carries out a packet from the client
+func (session *mqttSession) handle(packet mqttPacket) error {
+	switch packet.Type {
+	case mqttPublish:
+		publish, err := parseMQTTPublish(packet)
+		if err != nil {
+			return err
+		}
+		if publish.QoS == 2 {
+			return fmt.Errorf("QoS 2 is not supported")
+		}
+		//MQTT can not report a failed publish so the client is disconnected
+		if err := session.publish(publish); err != nil {
+			return fmt.Errorf("could not publish to Topic %s: %v", publish.Topic, err)
+		}
+		if publish.QoS == 1 {
+			session.send(mqttPacket{Type: mqttPuback, Body: mqttPacketID(publish.PacketID)})
+		}
+	case mqttPuback:
+		if len(packet.Body) != 2 {
+			return fmt.Errorf("malformed PUBACK")
+		}
+		session.acknowledge(uint16(packet.Body[0])<<8 | uint16(packet.Body[1]))
+	case mqttSubscribe:
+		if packet.Flags != 0x02 {
+			return fmt.Errorf("malformed SUBSCRIBE")
+		}
+		packetID, subscriptions, err := parseMQTTSubscribe(packet.Body)
+		if err != nil {
+			return err
+		}
+		session.subscribe(packetID, subscriptions)
+	case mqttUnsubscribe:
+		if packet.Flags != 0x02 {
+			return fmt.Errorf("malformed UNSUBSCRIBE")
+		}
+		packetID, filters, err := parseMQTTUnsubscribe(packet.Body)
+		if err != nil {
+			return err
+		}
+		session.mu.Lock()
+		for _, filter := range filters {
+			delete(session.state.filters, filter)
+		}
+		session.mu.Unlock()
+		session.reconcile()
+		session.send(mqttPacket{Type: mqttUnsuback, Body: mqttPacketID(packetID)})
+	case mqttPingreq:
+		session.send(mqttPacket{Type: mqttPingresp})
+	default:
+		return fmt.Errorf("unexpected packet type %d", packet.Type)
+	}
+	return nil
+}
+
+//publish writes the payload to the topic, creating the topic if needed as the write endpoint
+// does. Retained messages are marked with mqttRetainAttribute
+func (session *mqttSession) publish(publish mqttPublishPacket) error {
+	topic, err := session.broker.pubsub.GetTopic(publish.Topic, session.user)
+	if err != nil {
+		return err
+	}
+	msg := Message{Data: string(publish.Payload)}
+	if publish.Retain {
+		msg.Attributes = map[string]string{mqttRetainAttribute: "true"}
+	}
+	msg.AddCreatedDatestring(time.Now())
+	_, err = session.user.WriteToTopic(topic, msg)
+	return err
+}
+
+//subscribe adds the topic filters, granting QoS 2 requests QoS 1, then sends the
+// retained messages of the matching Topics
+func (session *mqttSession) subscribe(packetID uint16, subscriptions []mqttSubscription) {
+	codes := mqttPacketID(packetID)
+	granted := []mqttSubscription{}
+	session.mu.Lock()
+	for _, subscription := range subscriptions {
+		if !validMQTTFilter(subscription.Filter) || subscription.QoS > 2 {
+			codes = append(codes, mqttSubscriptionRejected)
+			continue
+		}
+		if subscription.QoS > 1 {
+			subscription.QoS = 1
+		}
+		session.state.filters[subscription.Filter] = subscription.QoS
+		codes = append(codes, subscription.QoS)
+		granted = append(granted, subscription)
+	}
+	session.mu.Unlock()
+	if !session.send(mqttPacket{Type: mqttSuback, Body: codes}) {
+		return
+	}
+	//filters downgraded to QoS 0 stop their streams
+	session.reconcile()
+	for _, subscription := range granted {
+		session.sendRetained(subscription)
+		if subscription.QoS == 1 {
+			session.streamFilter(subscription.Filter)
+		}
+	}
+}
+
+//readableTopics gives the existing Topics matching the filter that the User can read
+func (session *mqttSession) readableTopics(filter string) []*Topic {
+	pubsub := session.broker.pubsub
+	pubsub.mu.RLock()
+	defer pubsub.mu.RUnlock()
+	topics := []*Topic{}
+	for topicName, topic := range pubsub.Topics {
+		if mqttMatch(filter, topicName) && topic.CanRead(session.user) {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+//sendRetained sends the retained messages of the Topics matching the subscription
+func (session *mqttSession) sendRetained(subscription mqttSubscription) {
+	for _, topic := range session.readableTopics(subscription.Filter) {
+		msg, ok := topic.mqttRetained()
+		if !ok {
+			continue
+		}
+		publish := mqttPublishPacket{Topic: topic.Name, QoS: subscription.QoS, Retain: true, Payload: msg.dataBytes()}
+		if publish.QoS == 1 {
+			if publish.PacketID, ok = session.track(mqttInflight{topic: topic, messageID: msg.ID, retained: true}); !ok {
+				return
+			}
+		}
+		if !session.send(publish.packet()) {
+			return
+		}
+	}
+}
+
+//mqttRetained gives the Topic's retained message. This is the newest Message published with
+// the retain flag, unless its payload was empty to clear the retained message
+func (topic *Topic) mqttRetained() (Message, bool) {
+	topic.mu.RLock()
+	defer topic.mu.RUnlock()
+	id, ok := topic.mqttRetainedID()
+	if !ok {
+		return Message{}, false
+	}
+	return topic.Messages[id], true
+}
+
+//mqttRetainedID gives the ID of the Topic's retained message and whether it has one.
+// The retained message is kept from being garbage collected. Caller must hold topic.mu
+func (topic *Topic) mqttRetainedID() (int, bool) {
+	for id := topic.PointerHead - 1; id >= topic.oldestRetained(); id-- {
+		msg, ok := topic.Messages[id]
+		if !ok || msg.Attributes[mqttRetainAttribute] != "true" {
+			continue
+		}
+		return id, len(msg.dataBytes()) > 0
+	}
+	return 0, false
+}
+
+//reconcile stops the QoS 1 streams of Topics no longer matched by a QoS 1 filter and
+// removes their pull Subscriptions
+func (session *mqttSession) reconcile() {
+	session.mu.Lock()
+	dropped := []string{}
+	for topicName := range session.state.topics {
+		if qos, _ := session.state.qos(topicName); qos == 1 {
+			continue
+		}
+		if cancel, ok := session.streams[topicName]; ok {
+			cancel()
+			delete(session.streams, topicName)
+		}
+		delete(session.state.topics, topicName)
+		dropped = append(dropped, topicName)
+	}
+	session.mu.Unlock()
+	for _, topicName := range dropped {
+		topic, err := session.broker.pubsub.FetchTopic(topicName, session.user)
+		if err != nil {
+			continue
+		}
+		if err := session.user.Unsubscribe(topic, mqttSubscriptionName(session.clientID)); err != nil {
+			log.Printf("error removing subscription of MQTT client %s from Topic %s: %v\n", session.clientID, topicName, err)
+		}
+	}
+}
+
+//streamFilter starts QoS 1 streams for the existing Topics matching the filter. Topics
+// created later are picked up by streamLive when their first Message is written
+func (session *mqttSession) streamFilter(filter string) {
+	for _, topic := range session.readableTopics(filter) {
+		session.startStream(topic, -1)
+	}
+}
+
+//startStream streams the client's pull Subscription on the Topic, unless it is already
+// streamed. A new Subscription is sought to the message ID from if it is not negative
+func (session *mqttSession) startStream(topic *Topic, from int) {
+	session.mu.Lock()
+	if _, ok := session.streams[topic.Name]; ok || session.ctx.Err() != nil {
+		session.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(session.ctx)
+	session.streams[topic.Name] = cancel
+	session.state.topics[topic.Name] = true
+	session.streaming.Add(1)
+	session.mu.Unlock()
+
+	name := mqttSubscriptionName(session.clientID)
+	consumer := Consumer{Subscription: name}
+	//stored sessions resume their existing Subscriptions
+	_, err := session.user.touchSubscription(topic, consumer)
+	if err != nil {
+		if _, err = session.user.Subscribe(topic, SubscriptionOptions{Name: name}); err == nil && from >= 0 {
+			_, err = session.user.SeekToMessage(topic, name, from)
+		}
+	}
+	if err != nil {
+		log.Printf("error subscribing MQTT client %s to Topic %s: %v\n", session.clientID, topic.Name, err)
+		session.stopStream(topic.Name)
+		session.streaming.Done()
+		return
+	}
+	go session.stream(ctx, topic, consumer)
+}
+
+//stopStream forgets the QoS 1 stream of the Topic
+func (session *mqttSession) stopStream(topicName string) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if cancel, ok := session.streams[topicName]; ok {
+		cancel()
+		delete(session.streams, topicName)
+	}
+	delete(session.state.topics, topicName)
+}
+
+//stream sends the Messages of the client's pull Subscription on the Topic at QoS 1.
+// They are acknowledged when the client sends PUBACK
+func (session *mqttSession) stream(ctx context.Context, topic *Topic, consumer Consumer) {
+	defer session.streaming.Done()
+	err := session.user.streamSubscription(ctx, topic, consumer, func(msgs []Message) error {
+		for _, msg := range msgs {
+			packetID, ok := session.track(mqttInflight{topic: topic, messageID: msg.ID})
+			if !ok {
+				return session.ctx.Err()
+			}
+			publish := mqttPublishPacket{Topic: topic.Name, QoS: 1, PacketID: packetID, Payload: msg.dataBytes()}
+			if !session.send(publish.packet()) {
+				return session.ctx.Err()
+			}
+		}
+		return nil
+	}, nil)
+	if ctx.Err() == nil {
+		log.Printf("MQTT client %s stopped receiving Topic %s: %v\n", session.clientID, topic.Name, err)
+		session.stopStream(topic.Name)
+	}
+}
+
+//track gives the Message sent at QoS 1 a packet ID to be acknowledged by. The client is
+// disconnected if it has no packet IDs left, returning false
+func (session *mqttSession) track(inflight mqttInflight) (uint16, bool) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if len(session.inflight) >= 0xFFFF {
+		log.Printf("MQTT client %s has too many unacknowledged messages and is being disconnected\n", session.clientID)
+		session.close()
+		return 0, false
+	}
+	for {
+		session.nextID++
+		if _, ok := session.inflight[session.nextID]; session.nextID != 0 && !ok {
+			break
+		}
+	}
+	session.inflight[session.nextID] = inflight
+	return session.nextID, true
+}
+
+//acknowledge acknowledges the Message sent with the packet ID to its pull Subscription,
+// moving its pointer on once the Messages before it are acknowledged too
+func (session *mqttSession) acknowledge(packetID uint16) {
+	session.mu.Lock()
+	inflight, ok := session.inflight[packetID]
+	delete(session.inflight, packetID)
+	session.mu.Unlock()
+	if !ok || inflight.retained {
+		return
+	}
+	consumer := Consumer{Subscription: mqttSubscriptionName(session.clientID)}
+	if _, err := session.user.Ack(inflight.topic, consumer, []int{inflight.messageID}); err != nil {
+		log.Printf("error acknowledging message #%d sent to MQTT client %s from Topic %s: %v\n", inflight.messageID, session.clientID, inflight.topic.Name, err)
+	}
+}
+
+//streamLive sends the Messages of Topics matched only by QoS 0 filters from the SSE fan-out
+// as they are written. Messages of new Topics matched by a QoS 1 filter start their stream
+func (session *mqttSession) streamLive() {
+	distro := &session.broker.pubsub.sseDistro
+	clientName := RandomString(6)
+	receiver := make(chan SSEResponse, distro.BufferSize)
+	distro.Add <- SSEAddRequester{
+		ID:       clientName,
+		Receiver: receiver,
+		Match:    session.live,
+	}
+	defer func() {
+		distro.Cancel <- clientName
+	}()
+	for {
+		select {
+		case <-session.ctx.Done():
+			return
+		case item, ok := <-receiver:
+			//the SSEDistro closes the receiver if the client falls too far behind
+			if !ok {
+				session.close()
+				return
+			}
+			if item.System != nil {
+				continue
+			}
+			session.mu.Lock()
+			qos, matched := session.state.qos(item.TopicName)
+			session.mu.Unlock()
+			if !matched {
+				continue
+			}
+			topic, err := session.broker.pubsub.FetchTopic(item.TopicName, session.user)
+			if err != nil || !topic.CanRead(session.user) {
+				continue
+			}
+			if qos == 1 {
+				session.startStream(topic, item.Message.ID)
+				continue
+			}
+			publish := mqttPublishPacket{Topic: item.TopicName, Payload: item.Message.dataBytes()}
+			if !session.send(publish.packet()) {
+				return
+			}
+		}
+	}
+}
+
+//live is whether the Topic's Messages should be sent to streamLive. These are the Topics
+// matched by a filter that do not have a QoS 1 stream already
+func (session *mqttSession) live(topicName string) bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if _, ok := session.streams[topicName]; ok {
+		return false
+	}
+	_, matched := session.state.qos(topicName)
+	return matched
+}
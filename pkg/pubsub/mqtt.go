@@ -0,0 +1,354 @@
+package pubsub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	//mqttMaxPacketSize caps the size of a packet read from a client
+	mqttMaxPacketSize = 1 << 20
+	//mqttConnectTimeout is how long a client has to send CONNECT once connected
+	mqttConnectTimeout = 10 * time.Second
+	//mqttWriteTimeout is how long a client can take to accept a packet before it is disconnected
+	mqttWriteTimeout = 10 * time.Second
+	//mqttRetainAttribute marks the Messages published with the MQTT retain flag. The newest
+	// marked Message of a Topic is its retained message
+	mqttRetainAttribute = "mqtt_retain"
+)
+
+//MQTT control packet types. See the MQTT 3.1.1 specification
+const (
+	mqttConnect     = 1
+	mqttConnack     = 2
+	mqttPublish     = 3
+	mqttPuback      = 4
+	mqttSubscribe   = 8
+	mqttSuback      = 9
+	mqttUnsubscribe = 10
+	mqttUnsuback    = 11
+	mqttPingreq     = 12
+	mqttPingresp    = 13
+	mqttDisconnect  = 14
+)
+
+//MQTT CONNACK return codes
+const (
+	mqttAccepted             = 0
+	mqttBadProtocolVersion   = 1
+	mqttIdentifierRejected   = 2
+	mqttBadUsernamePassword  = 4
+	mqttNotAuthorized        = 5
+	mqttSubscriptionRejected = 0x80 //SUBACK return code of a failed subscription
+)
+
+//mqttPacket is an MQTT control packet. Flags are the low four bits of the fixed header
+type mqttPacket struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+//readMQTTPacket reads the next control packet from the client
+func readMQTTPacket(reader *bufio.Reader) (mqttPacket, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return mqttPacket{}, err
+	}
+	//the remaining length is a varint of up to four bytes
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return mqttPacket{}, fmt.Errorf("malformed remaining length")
+		}
+		digit, err := reader.ReadByte()
+		if err != nil {
+			return mqttPacket{}, err
+		}
+		length += int(digit&0x7F) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > mqttMaxPacketSize {
+		return mqttPacket{}, fmt.Errorf("packet of %d bytes is over the %d byte limit", length, mqttMaxPacketSize)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return mqttPacket{}, err
+	}
+	return mqttPacket{Type: header >> 4, Flags: header & 0x0F, Body: body}, nil
+}
+
+//bytes encodes the packet with its fixed header
+func (packet mqttPacket) bytes() []byte {
+	encoded := make([]byte, 0, len(packet.Body)+5)
+	encoded = append(encoded, packet.Type<<4|packet.Flags)
+	length := len(packet.Body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		encoded = append(encoded, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(encoded, packet.Body...)
+}
+
+//mqttReader reads the fields of a packet body. The first error is kept and
+// later reads return zero values, so it only needs checking once at the end
+type mqttReader struct {
+	data []byte
+	err  error
+}
+
+func (reader *mqttReader) next(n int) []byte {
+	if reader.err != nil {
+		return nil
+	}
+	if len(reader.data) < n {
+		reader.err = fmt.Errorf("packet is truncated")
+		return nil
+	}
+	field := reader.data[:n]
+	reader.data = reader.data[n:]
+	return field
+}
+
+func (reader *mqttReader) byte() byte {
+	if field := reader.next(1); field != nil {
+		return field[0]
+	}
+	return 0
+}
+
+func (reader *mqttReader) uint16() uint16 {
+	if field := reader.next(2); field != nil {
+		return binary.BigEndian.Uint16(field)
+	}
+	return 0
+}
+
+//bytes reads a field prefixed with its two byte length
+func (reader *mqttReader) bytes() []byte {
+	return reader.next(int(reader.uint16()))
+}
+
+//string reads a length prefixed UTF-8 string, which MQTT forbids from containing U+0000
+func (reader *mqttReader) string() string {
+	field := reader.bytes()
+	if reader.err == nil && (!utf8.Valid(field) || strings.ContainsRune(string(field), 0)) {
+		reader.err = fmt.Errorf("malformed UTF-8 string")
+	}
+	return string(field)
+}
+
+//rest reads the remainder of the body
+func (reader *mqttReader) rest() []byte {
+	return reader.next(len(reader.data))
+}
+
+//appendMQTTString appends the length prefixed string
+func appendMQTTString(buf []byte, s string) []byte {
+	buf = append(buf, byte(len(s)>>8), byte(len(s)))
+	return append(buf, s...)
+}
+
+//mqttPacketID encodes a packet identifier as a packet body, as PUBACK and UNSUBACK are
+func mqttPacketID(packetID uint16) []byte {
+	return []byte{byte(packetID >> 8), byte(packetID)}
+}
+
+//mqttConnectPacket is a client's CONNECT packet
+type mqttConnectPacket struct {
+	ProtocolName  string
+	ProtocolLevel byte
+	ClientID      string
+	CleanSession  bool
+	//KeepAlive is the longest the client will go without sending a packet. Zero turns it off
+	KeepAlive time.Duration
+	Username  string
+	Password  string
+	//Will is published if the client disconnects without sending DISCONNECT
+	Will *mqttPublishPacket
+}
+
+//parseMQTTConnect reads a CONNECT packet body
+func parseMQTTConnect(body []byte) (mqttConnectPacket, error) {
+	reader := &mqttReader{data: body}
+	connect := mqttConnectPacket{}
+	connect.ProtocolName = reader.string()
+	connect.ProtocolLevel = reader.byte()
+	flags := reader.byte()
+	connect.KeepAlive = time.Duration(reader.uint16()) * time.Second
+	connect.CleanSession = flags&0x02 != 0
+	connect.ClientID = reader.string()
+	if flags&0x04 != 0 {
+		connect.Will = &mqttPublishPacket{
+			Topic:  reader.string(),
+			QoS:    flags >> 3 & 0x03,
+			Retain: flags&0x20 != 0,
+		}
+		connect.Will.Payload = reader.bytes()
+	}
+	if flags&0x80 != 0 {
+		connect.Username = reader.string()
+	}
+	if flags&0x40 != 0 {
+		connect.Password = string(reader.bytes())
+	}
+	if reader.err != nil {
+		return connect, reader.err
+	}
+	if flags&0x01 != 0 || (flags&0x80 == 0 && flags&0x40 != 0) {
+		return connect, fmt.Errorf("invalid connect flags")
+	}
+	if connect.Will != nil && (connect.Will.QoS > 2 || !validMQTTTopic(connect.Will.Topic)) {
+		return connect, fmt.Errorf("invalid will message")
+	}
+	return connect, nil
+}
+
+//mqttPublishPacket is a PUBLISH packet. PacketID is only used at QoS 1 and 2
+type mqttPublishPacket struct {
+	Topic    string
+	QoS      byte
+	Retain   bool
+	PacketID uint16
+	Payload  []byte
+}
+
+//parseMQTTPublish reads a PUBLISH packet, whose QoS and retain flag are in the fixed header
+func parseMQTTPublish(packet mqttPacket) (mqttPublishPacket, error) {
+	reader := &mqttReader{data: packet.Body}
+	publish := mqttPublishPacket{
+		QoS:    packet.Flags >> 1 & 0x03,
+		Retain: packet.Flags&0x01 != 0,
+	}
+	publish.Topic = reader.string()
+	if publish.QoS > 0 {
+		publish.PacketID = reader.uint16()
+	}
+	publish.Payload = reader.rest()
+	if reader.err != nil {
+		return publish, reader.err
+	}
+	if publish.QoS > 2 {
+		return publish, fmt.Errorf("invalid QoS %d", publish.QoS)
+	}
+	if !validMQTTTopic(publish.Topic) {
+		return publish, fmt.Errorf("invalid topic name %q", publish.Topic)
+	}
+	return publish, nil
+}
+
+//packet encodes the PUBLISH packet
+func (publish mqttPublishPacket) packet() mqttPacket {
+	flags := publish.QoS << 1
+	if publish.Retain {
+		flags |= 0x01
+	}
+	body := appendMQTTString(make([]byte, 0, len(publish.Topic)+len(publish.Payload)+4), publish.Topic)
+	if publish.QoS > 0 {
+		body = append(body, mqttPacketID(publish.PacketID)...)
+	}
+	return mqttPacket{Type: mqttPublish, Flags: flags, Body: append(body, publish.Payload...)}
+}
+
+//mqttSubscription is a topic filter of a SUBSCRIBE packet and its requested QoS
+type mqttSubscription struct {
+	Filter string
+	QoS    byte
+}
+
+//parseMQTTSubscribe reads a SUBSCRIBE packet body
+func parseMQTTSubscribe(body []byte) (uint16, []mqttSubscription, error) {
+	reader := &mqttReader{data: body}
+	packetID := reader.uint16()
+	subscriptions := []mqttSubscription{}
+	for reader.err == nil && len(reader.data) > 0 {
+		subscriptions = append(subscriptions, mqttSubscription{Filter: reader.string(), QoS: reader.byte()})
+	}
+	if reader.err != nil {
+		return 0, nil, reader.err
+	}
+	if len(subscriptions) == 0 {
+		return 0, nil, fmt.Errorf("subscribe packet has no topic filters")
+	}
+	return packetID, subscriptions, nil
+}
+
+//parseMQTTUnsubscribe reads an UNSUBSCRIBE packet body
+func parseMQTTUnsubscribe(body []byte) (uint16, []string, error) {
+	reader := &mqttReader{data: body}
+	packetID := reader.uint16()
+	filters := []string{}
+	for reader.err == nil && len(reader.data) > 0 {
+		filters = append(filters, reader.string())
+	}
+	if reader.err != nil {
+		return 0, nil, reader.err
+	}
+	if len(filters) == 0 {
+		return 0, nil, fmt.Errorf("unsubscribe packet has no topic filters")
+	}
+	return packetID, filters, nil
+}
+
+//------------------------------------------- topic filters
+
+//validMQTTTopic is whether the name can be published to. Names can not hold wildcards
+func validMQTTTopic(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "+#")
+}
+
+//validMQTTFilter is whether the topic filter is well formed. `+` must fill a whole level
+// and `#` must fill the last level
+func validMQTTFilter(filter string) bool {
+	if filter == "" {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return false
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return false
+		}
+	}
+	return true
+}
+
+//mqttMatch is whether the topic name matches the topic filter. `+` matches a single
+// level and `#` any number of levels, including none. Wildcards at the first level do not
+// match names beginning with `$`
+func mqttMatch(filter, topicName string) bool {
+	if strings.HasPrefix(topicName, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	filterLevels := strings.Split(filter, "/")
+	nameLevels := strings.Split(topicName, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(nameLevels) {
+			return false
+		}
+		if level != "+" && level != nameLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(nameLevels)
+}
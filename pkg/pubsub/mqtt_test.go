@@ -0,0 +1,57 @@
+package pubsub
+
+import "testing"
+
+func TestMQTTMatch(t *testing.T) {
+	tests := []struct {
+		filter    string
+		topicName string
+		want      bool
+	}{
+		{filter: "sensors/kitchen/temperature", topicName: "sensors/kitchen/temperature", want: true},
+		{filter: "sensors/kitchen/temperature", topicName: "sensors/kitchen/humidity", want: false},
+		{filter: "sensors/+/temperature", topicName: "sensors/kitchen/temperature", want: true},
+		{filter: "sensors/+/temperature", topicName: "sensors/kitchen/oven/temperature", want: false},
+		{filter: "sensors/+", topicName: "sensors", want: false},
+		{filter: "sensors/+", topicName: "sensors/", want: true},
+		{filter: "+/+", topicName: "/finance", want: true},
+		{filter: "+", topicName: "/finance", want: false},
+		{filter: "sensors/#", topicName: "sensors", want: true},
+		{filter: "sensors/#", topicName: "sensors/kitchen/temperature", want: true},
+		{filter: "sensors/#", topicName: "sensorsx/kitchen", want: false},
+		{filter: "#", topicName: "sensors/kitchen", want: true},
+		{filter: "sensors", topicName: "sensors/kitchen", want: false},
+		{filter: "sensors/kitchen", topicName: "sensors", want: false},
+		{filter: "#", topicName: "$SYS/uptime", want: false},
+		{filter: "+/uptime", topicName: "$SYS/uptime", want: false},
+		{filter: "$SYS/#", topicName: "$SYS/uptime", want: true},
+		{filter: "orders", topicName: "orders", want: true},
+	}
+	for _, test := range tests {
+		if got := mqttMatch(test.filter, test.topicName); got != test.want {
+			t.Errorf("mqttMatch(%q, %q) = %v, want %v", test.filter, test.topicName, got, test.want)
+		}
+	}
+}
+
+func TestValidMQTTFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{filter: "sensors/kitchen", want: true},
+		{filter: "sensors/+/temperature", want: true},
+		{filter: "sensors/#", want: true},
+		{filter: "#", want: true},
+		{filter: "+", want: true},
+		{filter: "", want: false},
+		{filter: "sensors/#/temperature", want: false},
+		{filter: "sensors#", want: false},
+		{filter: "sensors/kitchen+", want: false},
+	}
+	for _, test := range tests {
+		if got := validMQTTFilter(test.filter); got != test.want {
+			t.Errorf("validMQTTFilter(%q) = %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -54,12 +55,36 @@ func CreateMux(mtype MuxType, pubsub *PubSub) (*http.ServeMux, *PubSub) {
 		mux.HandleFunc("/users/user/obtain", func(rw http.ResponseWriter, r *http.Request) {
 			userCreateHandler(rw, r, pubsub)
 		})
+		mux.HandleFunc("/users/user/token", func(rw http.ResponseWriter, r *http.Request) {
+			userTokenHandler(rw, r, pubsub)
+		})
 		mux.HandleFunc("/topics/topic/subscribe", func(rw http.ResponseWriter, r *http.Request) {
 			subscriptionSubscribeHandler(rw, r, pubsub)
 		})
 		mux.HandleFunc("/topics/topic/unsubscribe", func(rw http.ResponseWriter, r *http.Request) {
 			subscriptionUnsubscribeHandler(rw, r, pubsub)
 		})
+		mux.HandleFunc("/topics/topic/subscription/deliveries", func(rw http.ResponseWriter, r *http.Request) {
+			subscriptionDeliveriesHandler(rw, r, pubsub)
+		})
+		mux.HandleFunc("/topics/topic/subscription/join", func(rw http.ResponseWriter, r *http.Request) {
+			subscriptionGroupHandler(rw, r, pubsub, joinVerb)
+		})
+		mux.HandleFunc("/topics/topic/subscription/leave", func(rw http.ResponseWriter, r *http.Request) {
+			subscriptionGroupHandler(rw, r, pubsub, leaveVerb)
+		})
+		mux.HandleFunc("/topics/topic/subscription/seek", func(rw http.ResponseWriter, r *http.Request) {
+			subscriptionSeekHandler(rw, r, pubsub)
+		})
+		mux.HandleFunc("/topics/topic/snapshots/create", func(rw http.ResponseWriter, r *http.Request) {
+			snapshotHandler(rw, r, pubsub, createVerb)
+		})
+		mux.HandleFunc("/topics/topic/snapshots/fetch", func(rw http.ResponseWriter, r *http.Request) {
+			snapshotHandler(rw, r, pubsub, fetchVerb)
+		})
+		mux.HandleFunc("/topics/topic/snapshots/delete", func(rw http.ResponseWriter, r *http.Request) {
+			snapshotHandler(rw, r, pubsub, deleteVerb)
+		})
 		mux.HandleFunc("/topics/fetch", func(rw http.ResponseWriter, r *http.Request) {
 			topicsListHandler(rw, r, pubsub)
 		})
@@ -72,9 +97,21 @@ func CreateMux(mtype MuxType, pubsub *PubSub) (*http.ServeMux, *PubSub) {
 		mux.HandleFunc("/topics/topic/obtain", func(rw http.ResponseWriter, r *http.Request) {
 			topicRetrieveHandler(rw, r, pubsub, obtainVerb)
 		})
+		mux.HandleFunc("/topics/topic/access", func(rw http.ResponseWriter, r *http.Request) {
+			topicAccessHandler(rw, r, pubsub)
+		})
 		mux.HandleFunc("/topics/topic/messages/pull", func(rw http.ResponseWriter, r *http.Request) {
 			messagePullHandler(rw, r, pubsub)
 		})
+		mux.HandleFunc("/topics/topic/messages/ack", func(rw http.ResponseWriter, r *http.Request) {
+			messageAckHandler(rw, r, pubsub, ackVerb)
+		})
+		mux.HandleFunc("/topics/topic/messages/nack", func(rw http.ResponseWriter, r *http.Request) {
+			messageAckHandler(rw, r, pubsub, nackVerb)
+		})
+		mux.HandleFunc("/topics/topic/messages/modify_deadline", func(rw http.ResponseWriter, r *http.Request) {
+			messageAckHandler(rw, r, pubsub, modifyDeadlineVerb)
+		})
 		mux.HandleFunc("/topics/topic/messages/write", func(rw http.ResponseWriter, r *http.Request) {
 			messageWriteHandler(rw, r, pubsub)
 		})
@@ -84,6 +121,12 @@ func CreateMux(mtype MuxType, pubsub *PubSub) (*http.ServeMux, *PubSub) {
 		mux.HandleFunc("/sse", func(rw http.ResponseWriter, r *http.Request) {
 			sseHandler(rw, r, pubsub)
 		})
+		mux.HandleFunc("/sse/ack", func(rw http.ResponseWriter, r *http.Request) {
+			sseAckHandler(rw, r, pubsub)
+		})
+		mux.HandleFunc("/ws", func(rw http.ResponseWriter, r *http.Request) {
+			wsHandler(rw, r, pubsub)
+		})
 	}
 
 	mux.HandleFunc("/", homepageHandler)
@@ -111,6 +154,33 @@ func userCreateHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub)
 	respondMuxHTTP(rw, response)
 }
 
+//userTokenHandler issues a token for the User to authenticate SSE streams with. The token
+// is also set as a cookie for browsers
+func userTokenHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
+	//login user
+	user, _, err := HTTPAuthenticate(rw, r, pubsub)
+	if err != nil {
+		return
+	}
+	token, expires := user.IssueToken(tokenTTL)
+	http.SetCookie(rw, &http.Cookie{
+		Name:     TokenCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	//create response
+	response := TokenResp{
+		User:    user.UUID,
+		Token:   token,
+		Expires: expires.Format(time.RFC3339),
+	}
+	//respond
+	respondMuxHTTP(rw, response)
+}
+
 //subscriptionSubscribeHandler handles Subscription sign-ups for topics
 func subscriptionSubscribeHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
 	//login user
@@ -123,17 +193,42 @@ func subscriptionSubscribeHandler(rw http.ResponseWriter, r *http.Request, pubsu
 	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
 		return
 	}
+	if !topic.CanRead(user) {
+		HTTPErrorResponse(fmt.Errorf("User can not read private Topic %s", topic.Name), http.StatusForbidden, rw)
+		return
+	}
+	options, err := payload.subscriptionOptions()
+	if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+		return
+	}
+	if err := HTTPErrorResponse(options.validate(topic, false), http.StatusBadRequest, rw); err != nil {
+		return
+	}
+	//make sure the dead letter topic can be written to
+	if options.DeadLetterTopic != "" {
+		_, err = pubsub.deadLetterTopic(options.DeadLetterTopic, user)
+		if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+			return
+		}
+	}
 	//subscribe
-	err = user.Subscribe(topic, payload.WebhookURL)
+	sub, err := user.Subscribe(topic, options)
 	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
 		return
 	}
 	//create response
+	status := "Subscribed"
+	if sub.pending() {
+		status = "Pending"
+	}
 	response := SubscribeResp{
-		User:     user.UUID,
-		Topic:    topic.Name,
-		Status:   "Subscribed",
-		CanWrite: user.UUID == topic.Creator,
+		User:         user.UUID,
+		Topic:        topic.Name,
+		Status:       status,
+		CanWrite:     user.UUID == topic.Creator,
+		Secret:       sub.Secret,
+		Subscription: sub.Name,
+		Filter:       sub.Filter,
 	}
 	//respond
 	respondMuxHTTP(rw, response)
@@ -151,34 +246,226 @@ func subscriptionUnsubscribeHandler(rw http.ResponseWriter, r *http.Request, pub
 	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
 		return
 	}
-	//unsubscribe
-	err = user.Unsubscribe(topic)
+	//unsubscribe - removing all consumers if shared
+	err = user.Unsubscribe(topic, payload.Subscription)
 	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
 		return
 	}
 	//create response
 	response := SubscribeResp{
-		User:     user.UUID,
-		Topic:    topic.Name,
-		Status:   "Unsubscribed",
-		CanWrite: user.UUID == topic.Creator,
+		User:         user.UUID,
+		Topic:        topic.Name,
+		Status:       "Unsubscribed",
+		CanWrite:     user.UUID == topic.Creator,
+		Subscription: payload.Subscription,
 	}
 
 	//respond
 	respondMuxHTTP(rw, response)
 }
 
+//subscriptionGroupHandler handles consumers joining and leaving the User's shared Subscriptions
+func subscriptionGroupHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub, verb verbType) {
+	//login user
+	user, payload, err := HTTPAuthenticate(rw, r, pubsub)
+	if err != nil {
+		return
+	}
+	response := SubscribeResp{
+		User:         user.UUID,
+		Subscription: payload.Subscription,
+		Consumer:     payload.Consumer,
+	}
+	switch verb {
+	case joinVerb:
+		//get topic
+		topic, err := pubsub.GetTopic(payload.Topic, user)
+		if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
+			return
+		}
+		if !topic.CanRead(user) {
+			HTTPErrorResponse(fmt.Errorf("User can not read private Topic %s", topic.Name), http.StatusForbidden, rw)
+			return
+		}
+		options, err := payload.subscriptionOptions()
+		if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+			return
+		}
+		//make sure the dead letter topic can be written to
+		if options.DeadLetterTopic != "" {
+			_, err = pubsub.deadLetterTopic(options.DeadLetterTopic, user)
+			if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+				return
+			}
+		}
+		member, err := user.JoinSubscription(topic, payload.Subscription, payload.Consumer, options)
+		if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+			return
+		}
+		response.Status = "Joined"
+		if member.Status == SubscriptionPending {
+			response.Status = "Pending"
+		}
+		response.Topic = topic.Name
+		response.CanWrite = user.UUID == topic.Creator
+		response.Secret = member.Secret
+	default: //leaveVerb
+		//get topic
+		topic, err := pubsub.FetchTopic(payload.Topic, user)
+		if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
+			return
+		}
+		err = user.LeaveSubscription(topic, payload.Subscription, payload.Consumer)
+		if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+			return
+		}
+		response.Status = "Left"
+		response.Topic = topic.Name
+		response.CanWrite = user.UUID == topic.Creator
+	}
+	//respond
+	respondMuxHTTP(rw, response)
+}
+
+//subscriptionDeliveriesHandler responds with the User's recent push delivery attempts for a Topic
+// so that subscribers can debug their webhooks
+func subscriptionDeliveriesHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
+	//login user
+	user, payload, err := HTTPAuthenticate(rw, r, pubsub)
+	if err != nil {
+		return
+	}
+	//get topic
+	topic, err := pubsub.FetchTopic(payload.Topic, user)
+	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
+		return
+	}
+	//get subscription
+	topic.mu.RLock()
+	sub, _, ok := topic.findSubscriber(subscriptionKey(user.UUID, payload.Subscription))
+	topic.mu.RUnlock()
+	if !ok {
+		HTTPErrorResponse(fmt.Errorf("user is not subscribed to topic %s", topic.Name), http.StatusNotFound, rw)
+		return
+	}
+	if sub.PushURL == "" && !sub.Shared {
+		HTTPErrorResponse(fmt.Errorf("delivery history is only kept for push subscriptions"), http.StatusBadRequest, rw)
+		return
+	}
+	//create response
+	status := "Subscribed"
+	if sub.pending() {
+		status = "Pending"
+	}
+	response := DeliveriesResp{
+		User:         user.UUID,
+		Topic:        topic.Name,
+		Subscription: sub.Name,
+		PushURL:      sub.PushURL,
+		Status:       status,
+		Deliveries:   sub.deliveries.list(),
+	}
+	//respond
+	respondMuxHTTP(rw, response)
+}
+
+//subscriptionSeekHandler moves the User's Subscription to a message ID or timestamp to replay or skip messages
+func subscriptionSeekHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
+	//login user
+	user, payload, err := HTTPAuthenticate(rw, r, pubsub)
+	if err != nil {
+		return
+	}
+	//get topic
+	topic, err := pubsub.FetchTopic(payload.Topic, user)
+	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
+		return
+	}
+	//seek
+	var position int
+	if payload.Snapshot != "" {
+		position, err = user.SeekToSnapshot(topic, payload.Subscription, payload.Snapshot)
+	} else if payload.Timestamp != "" {
+		var timestamp time.Time
+		if timestamp, err = time.Parse(time.RFC3339, payload.Timestamp); err == nil {
+			position, err = user.SeekToTime(topic, payload.Subscription, timestamp)
+		}
+	} else {
+		position, err = user.SeekToMessage(topic, payload.Subscription, payload.MessageID)
+	}
+	if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+		return
+	}
+	//create response
+	response := SeekResp{
+		User:            user.UUID,
+		Topic:           topic.Name,
+		Subscription:    payload.Subscription,
+		Status:          "Moved",
+		PointerPosition: position,
+	}
+	//respond
+	respondMuxHTTP(rw, response)
+}
+
+//snapshotHandler creates, lists or deletes the named Snapshots of a Topic
+func snapshotHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub, verb verbType) {
+	//login user
+	user, payload, err := HTTPAuthenticate(rw, r, pubsub)
+	if err != nil {
+		return
+	}
+	//get topic
+	topic, err := pubsub.FetchTopic(payload.Topic, user)
+	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
+		return
+	}
+	response := SnapshotResp{
+		Topic: topic.Name,
+	}
+	switch verb {
+	case createVerb:
+		var expireAfter time.Duration
+		if payload.ExpireAfter != "" {
+			expireAfter, err = time.ParseDuration(payload.ExpireAfter)
+			if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+				return
+			}
+		}
+		snapshot, err := user.CreateSnapshot(topic, payload.Subscription, payload.Snapshot, expireAfter)
+		if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+			return
+		}
+		response.Status = "Created"
+		response.Snapshots = []Snapshot{*snapshot}
+	case deleteVerb:
+		err := user.DeleteSnapshot(topic, payload.Snapshot)
+		if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+			return
+		}
+		response.Status = "Deleted"
+		response.Snapshots = []Snapshot{}
+	default: //fetchVerb
+		response.Status = "Active"
+		response.Snapshots = topic.ListSnapshots()
+	}
+	//respond
+	respondMuxHTTP(rw, response)
+}
+
 //topicsListHandler handles fetch requests for a list of available topics to subscribe topic
 func topicsListHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
 	//login user
-	_, _, err := HTTPAuthenticate(rw, r, pubsub)
+	user, _, err := HTTPAuthenticate(rw, r, pubsub)
 	if err != nil {
 		return
 	}
-	//get list
+	//get list of the topics the User can read
 	list := make([]string, 0, len(pubsub.Topics))
-	for k := range pubsub.Topics {
-		list = append(list, k)
+	for k, topic := range pubsub.Topics {
+		if topic.CanRead(user) {
+			list = append(list, k)
+		}
 	}
 	//create response
 	response := ListKeysResp{
@@ -214,6 +501,17 @@ func topicRetrieveHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSu
 	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
 		return
 	}
+	//the creator can make the topic private as it is created or obtained
+	if payload.Private != nil && verb != fetchVerb {
+		_, err = pubsub.SetTopicAccess(topic, user, payload.Private, nil, nil)
+		if err := HTTPErrorResponse(err, http.StatusForbidden, rw); err != nil {
+			return
+		}
+	}
+	if !topic.CanRead(user) {
+		HTTPErrorResponse(fmt.Errorf("User can not read private Topic %s", topic.Name), http.StatusForbidden, rw)
+		return
+	}
 	//create response
 	response := TopicResp{
 		Topic:       topic.Name,
@@ -221,6 +519,34 @@ func topicRetrieveHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSu
 		PointerHead: topic.PointerHead,
 		Creator:     topic.Creator,
 		CanWrite:    user.UUID == topic.Creator,
+		Private:     topic.Private,
+	}
+	//respond
+	respondMuxHTTP(rw, response)
+}
+
+//topicAccessHandler lets the topic creator make a topic private or public and grant or revoke read access
+func topicAccessHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
+	//login user
+	user, payload, err := HTTPAuthenticate(rw, r, pubsub)
+	if err != nil {
+		return
+	}
+	//get topic
+	topic, err := pubsub.FetchTopic(payload.Topic, user)
+	if err := HTTPErrorResponse(err, http.StatusNotFound, rw); err != nil {
+		return
+	}
+	//change access
+	access, err := pubsub.SetTopicAccess(topic, user, payload.Private, payload.Grant, payload.Revoke)
+	if err := HTTPErrorResponse(err, http.StatusForbidden, rw); err != nil {
+		return
+	}
+	//create response
+	response := AccessResp{
+		Topic:   topic.Name,
+		Private: access.Private,
+		Readers: len(access.Readers),
 	}
 	//respond
 	respondMuxHTTP(rw, response)
@@ -239,8 +565,31 @@ func messagePullHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub)
 	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
 		return
 	}
+	//batch pull from the subscription's pointer
+	if payload.MaxMessages != 0 || payload.Wait != "" {
+		var wait time.Duration
+		if payload.Wait != "" {
+			wait, err = time.ParseDuration(payload.Wait)
+			if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+				return
+			}
+		}
+		msgs, deadline, err := user.PullMessages(r.Context(), topic, payload.consumer(), payload.MaxMessages, wait)
+		if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
+			return
+		}
+		response := BatchResp{
+			Topic:    topic.Name,
+			Messages: msgs,
+		}
+		if len(msgs) > 0 {
+			response.AckDeadline = deadline.Format(time.RFC3339Nano)
+		}
+		respondMuxHTTP(rw, response)
+		return
+	}
 	//pull message
-	msg, err := user.PullMessage(topic, payload.MessageID)
+	msg, err := user.PullMessage(topic, payload.Subscription, payload.MessageID)
 	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
 		return
 	}
@@ -253,6 +602,50 @@ func messagePullHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub)
 	respondMuxHTTP(rw, response)
 }
 
+//messageAckHandler settles the leases of batch pulled messages with an ack, nack or
+// modify_deadline. Only works for pull subscribers
+func messageAckHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub, verb verbType) {
+	//login user
+	user, payload, err := HTTPAuthenticate(rw, r, pubsub)
+	if err != nil {
+		return
+	}
+	//get topic
+	topic, err := pubsub.FetchTopic(payload.Topic, user)
+	if err := HTTPErrorResponse(err, http.StatusInternalServerError, rw); err != nil {
+		return
+	}
+	response := AckResp{
+		Topic:      topic.Name,
+		MessageIDs: payload.MessageIDs,
+	}
+	switch verb {
+	case ackVerb:
+		var position int
+		position, err = user.Ack(topic, payload.consumer(), payload.MessageIDs)
+		response.PointerPosition = &position
+		response.Status = "Acknowledged"
+	case nackVerb:
+		err = user.Nack(topic, payload.consumer(), payload.MessageIDs)
+		response.Status = "Released"
+	default: //modifyDeadlineVerb
+		if payload.AckDeadline == "" {
+			HTTPErrorResponse(fmt.Errorf("ack_deadline is required"), http.StatusBadRequest, rw)
+			return
+		}
+		var deadline time.Duration
+		if deadline, err = time.ParseDuration(payload.AckDeadline); err == nil {
+			err = user.ModifyDeadline(topic, payload.consumer(), payload.MessageIDs, deadline)
+		}
+		response.Status = "Extended"
+	}
+	if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+		return
+	}
+	//respond
+	respondMuxHTTP(rw, response)
+}
+
 //messageWriteHandler deals with requests to write messages to a topic. Only the topic creator User is permitted to write to a topic
 func messageWriteHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
 	//login user
@@ -271,7 +664,7 @@ func messageWriteHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub
 		return
 	}
 	//prepare the message
-	msg := Message{Data: payload.Message}
+	msg := Message{Data: payload.Message, Key: payload.Key, Attributes: payload.Attributes}
 	msg.AddCreatedDatestring(time.Now())
 	//write a message
 	message, err := user.WriteToTopic(topic, msg)
@@ -291,24 +684,72 @@ func messageWriteHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub
 //
 //Useful design pattern for SSE:https://www.smashingmagazine.com/2018/02/sse-websockets-data-flow-http2/#:~:text=Server%2DSent%20Events%20are%20real,communication%20method%20from%20the%20server.
 func sseHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
-	//Set SSE and CORS headers
-	rw.Header().Set("Access-Control-Allow-Origin", "*")
-	rw.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	//Set CORS headers - only the configured origins can stream
+	if !sseAllowOrigin(rw, r.Header.Get("Origin")) {
+		HTTPErrorResponse(fmt.Errorf("origin not allowed"), http.StatusForbidden, rw)
+		return
+	}
+	if r.Method == http.MethodOptions {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+	//identify the User by their token. Anonymous clients can only stream public topics
+	user, err := pubsub.sseUser(r)
+	if err := HTTPErrorResponse(err, http.StatusUnauthorized, rw); err != nil {
+		return
+	}
+	for _, topicName := range r.URL.Query()["topic"] {
+		if !pubsub.streamable(topicName, user) {
+			HTTPErrorResponse(fmt.Errorf("User can not read private Topic %s", topicName), http.StatusForbidden, rw)
+			return
+		}
+	}
+	//streams bound to a subscription are sent from its pointer rather than live
+	if _, ok := r.URL.Query()["subscription"]; ok {
+		sseSubscriptionHandler(rw, r, pubsub, user)
+		return
+	}
+	//get the optional message filter under the `filter` url query
+	filter, err := ParseFilter(r.URL.Query().Get("filter"))
+	if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+		return
+	}
+	//get the optional message ID to replay from on first connection under the `from` url query
+	from := -1
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = strconv.Atoi(v)
+		if err != nil || from < 0 {
+			err = fmt.Errorf("from must be a message ID")
+		}
+		if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+			return
+		}
+	}
+	//reconnecting browsers send the last event ID which holds the last Message ID sent from each topic
+	cursor := ParseSSECursor(r.Header.Get("Last-Event-ID"))
+	//get topic stream filters - expected under topic url query as separate args under the `topic` key
+	filterIn := make(map[string]bool)
+	for _, term := range r.URL.Query()["topic"] {
+		filterIn[term] = true
+	}
+	//only carry the positions of the requested topics
+	for topicName := range cursor {
+		if !filterIn[topicName] {
+			delete(cursor, topicName)
+		}
+	}
+	//Set SSE headers
 	rw.Header().Set("Content-Type", "text/event-stream")
 	rw.Header().Set("Cache-Control", "no-cache")
 	rw.Header().Set("Connection", "keep-alive")
 	//sign-up to streams
 	clientName := RandomString(6)
-	receiver := make(chan SSEResponse)
+	receiver := make(chan SSEResponse, pubsub.sseDistro.BufferSize)
 	pubsub.sseDistro.Add <- SSEAddRequester{
 		ID:       clientName,
+		Topics:   r.URL.Query()["topic"],
 		Receiver: receiver,
 	}
-	//get topic stream filters - expected under topic url query as separate args under the `topic` key
-	filterIn := make(map[string]bool)
-	for _, term := range r.URL.Query()["topic"] {
-		filterIn[term] = true
-	}
 	//ensure this doesn't block on client closing the connection
 	defer func() {
 		pubsub.sseDistro.Cancel <- clientName
@@ -323,8 +764,35 @@ func sseHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
 	//Keep alive pinger
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
-	//id counter
-	idCount := 0
+	//send writes the item to the client. Messages carry the cursor as their event ID
+	send := func(item SSEResponse) error {
+		if item.System == nil {
+			cursor[item.TopicName] = item.Message.ID
+			if _, err := fmt.Fprintf(rw, "id: %s\n", cursor); err != nil {
+				return err
+			}
+		}
+		//item implements stringer with data: and \n\n wrapped
+		if _, err := fmt.Fprint(rw, item); err != nil {
+			return err
+		}
+		//flush remaining data
+		flusher.Flush()
+		return nil
+	}
+	//replay the retained messages missed since the last event ID or requested with `from`
+	// before going live. Live messages written meanwhile are skipped below by the cursor
+	for _, topicName := range r.URL.Query()["topic"] {
+		for _, item := range pubsub.sseBacklog(topicName, cursor, from) {
+			if !filter.Matches(*item.Message) {
+				continue
+			}
+			if err := send(item); err != nil {
+				log.Println(err)
+				return
+			}
+		}
+	}
 	//Run the SSE loop
 	for {
 		select {
@@ -340,24 +808,31 @@ func sseHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
 			}
 			flusher.Flush()
 
-		case item := <-receiver:
-			//Figure out which topic stream was requested
-			if !filterIn[item.TopicName] {
-				continue
+		case item, ok := <-receiver:
+			//the SSEDistro closes the receiver if the client falls too far behind
+			if !ok {
+				fmt.Fprint(rw, sseErrorEvent(fmt.Errorf("stream fell behind and was closed - reconnect to resume from the last event ID")))
+				flusher.Flush()
+				return
 			}
-			//increment the id count
-			idCount += 1
-			if _, err := fmt.Fprintf(rw, "id: %d\n", idCount); err != nil {
-				log.Println(err)
+			//the topic may have been made private or the User's access revoked since connecting
+			if !pubsub.streamable(item.TopicName, user) {
+				fmt.Fprint(rw, sseErrorEvent(fmt.Errorf("read access to Topic %s was revoked", item.TopicName)))
+				flusher.Flush()
 				return
 			}
-			//item implements stringer with data: and \n\n wrapped
-			if _, err := fmt.Fprint(rw, item); err != nil {
+			//system events are not messages so are not filtered
+			if item.System == nil && !filter.Matches(*item.Message) {
+				continue
+			}
+			//skip messages already sent by the replay
+			if last, ok := cursor[item.TopicName]; ok && item.System == nil && item.Message.ID <= last {
+				continue
+			}
+			if err := send(item); err != nil {
 				log.Println(err)
 				return
 			}
-			//flush remaining data
-			flusher.Flush()
 
 		}
 	}
@@ -393,3 +868,144 @@ func homepageHandler(rw http.ResponseWriter, r *http.Request) {
 		http.ServeContent(rw, r, "index.html", time.Time{}, file)
 	}
 }
+
+//sseSubscriptionHandler streams a topic from one of the User's pull subscriptions so each message
+// is delivered at least once. The subscription's pointer advances as messages are flushed to the
+// client, or as they are acknowledged at `/sse/ack` with `ack=manual`, so a client that
+// reconnects carries on from where it left off
+func sseSubscriptionHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub, user *User) {
+	query := r.URL.Query()
+	if user == nil {
+		HTTPErrorResponse(fmt.Errorf("a token is required to stream a subscription"), http.StatusUnauthorized, rw)
+		return
+	}
+	if len(query["topic"]) != 1 {
+		HTTPErrorResponse(fmt.Errorf("a subscription is streamed from exactly one topic"), http.StatusBadRequest, rw)
+		return
+	}
+	if query.Get("from") != "" || query.Get("filter") != "" {
+		HTTPErrorResponse(fmt.Errorf("from and filter can not be used with a subscription - seek the subscription or subscribe with a filter instead"), http.StatusBadRequest, rw)
+		return
+	}
+	mode := SSEAckMode(query.Get("ack"))
+	if mode == "" {
+		mode = SSEAckAuto
+	}
+	if mode != SSEAckAuto && mode != SSEAckManual {
+		HTTPErrorResponse(fmt.Errorf("ack must be %s or %s", SSEAckAuto, SSEAckManual), http.StatusBadRequest, rw)
+		return
+	}
+	//get topic
+	topic, err := pubsub.FetchTopic(query.Get("topic"), user)
+	if err := HTTPErrorResponse(err, http.StatusNotFound, rw); err != nil {
+		return
+	}
+	//check the subscription can be pulled from before starting the stream
+	consumer := Consumer{Subscription: query.Get("subscription"), Member: query.Get("consumer")}
+	_, err = user.touchSubscription(topic, consumer)
+	if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+		return
+	}
+	//Set SSE headers
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	//Flusher
+	var flusher http.Flusher
+	if flush, ok := rw.(http.Flusher); ok {
+		flusher = flush
+	} else {
+		log.Panicln("No flusher on rw in SSE")
+	}
+	cursor := make(SSECursor)
+	err = user.streamSubscription(r.Context(), topic, consumer, func(msgs []Message) error {
+		ids := make([]int, 0, len(msgs))
+		for _, msg := range msgs {
+			ids = append(ids, msg.ID)
+			cursor[topic.Name] = msg.ID
+			if _, err := fmt.Fprintf(rw, "id: %s\n%s", cursor, SSEResponse{TopicName: topic.Name, Message: &msg}); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+		if mode == SSEAckManual {
+			return nil
+		}
+		_, err := user.Ack(topic, consumer, ids)
+		return err
+	}, func() error {
+		//waiting on the pull doubles as the keep alive interval
+		_, err := fmt.Fprint(rw, ": keep alive\n\n")
+		flusher.Flush()
+		return err
+	})
+	if r.Context().Err() != nil {
+		log.Printf("Connection cancelled by client streaming subscription on Topic %s\n", topic.Name)
+		return
+	}
+	//tell the client why the stream is closing
+	fmt.Fprint(rw, sseErrorEvent(err))
+	flusher.Flush()
+}
+
+//sseAckHandler acknowledges messages sent by a subscription stream opened with `ack=manual`.
+// It takes the same token as the stream so pages can acknowledge without the User's password
+func sseAckHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
+	//Set CORS headers - only the configured origins can acknowledge
+	if !sseAllowOrigin(rw, r.Header.Get("Origin")) {
+		HTTPErrorResponse(fmt.Errorf("origin not allowed"), http.StatusForbidden, rw)
+		return
+	}
+	if r.Method == http.MethodOptions {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+	//identify the User by their token
+	user, err := pubsub.sseUser(r)
+	if err == nil && user == nil {
+		err = fmt.Errorf("a token is required to acknowledge messages")
+	}
+	if err := HTTPErrorResponse(err, http.StatusUnauthorized, rw); err != nil {
+		return
+	}
+	payload, err := getHTTPData(r)
+	if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+		return
+	}
+	//get topic
+	topic, err := pubsub.FetchTopic(payload.Topic, user)
+	if err := HTTPErrorResponse(err, http.StatusNotFound, rw); err != nil {
+		return
+	}
+	position, err := user.Ack(topic, payload.consumer(), payload.MessageIDs)
+	if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+		return
+	}
+	//respond
+	respondMuxHTTP(rw, AckResp{
+		Topic:           topic.Name,
+		MessageIDs:      payload.MessageIDs,
+		PointerPosition: &position,
+		Status:          "Acknowledged",
+	})
+}
+
+//wsHandler upgrades the request to a WebSocket speaking the JSON frame protocol of wsSession.
+// Connections can be opened with a token, as browsers can not set headers on WebSockets, or
+// log in afterwards with an auth frame
+func wsHandler(rw http.ResponseWriter, r *http.Request, pubsub *PubSub) {
+	//browsers do not apply CORS to WebSockets so the origin is checked here
+	if !originAllowed(r.Header.Get("Origin")) {
+		HTTPErrorResponse(fmt.Errorf("origin not allowed"), http.StatusForbidden, rw)
+		return
+	}
+	user, err := pubsub.sseUser(r)
+	if err := HTTPErrorResponse(err, http.StatusUnauthorized, rw); err != nil {
+		return
+	}
+	conn, err := wsUpgrade(rw, r)
+	if err := HTTPErrorResponse(err, http.StatusBadRequest, rw); err != nil {
+		return
+	}
+	pubsub.runWebSocket(conn, user)
+}
@@ -0,0 +1,546 @@
+package pubsub
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//natsBroker routes Messages to the subscriptions of the NATS listener's clients. Subjects
+// are Topic names.
+//
+//A single SSE fan-out client feeds the broker so that a queue group's members on different
+// connections share the Messages between them. As in NATS core, Messages written while a
+// client is not subscribed are not sent to it
+type natsBroker struct {
+	pubsub   *PubSub
+	serverID string
+	//mu guards the clients, their Users, subscriptions and inboxes
+	mu      *sync.RWMutex
+	clients map[uint64]*natsClient
+	nextID  uint64
+	//inboxes maps the `_INBOX.<id>` inboxes of request reply subjects to the client that
+	// made the request. Replies are only sent to that client
+	inboxes map[string]*natsClient
+}
+
+//natsSubscription is a client's SUB
+type natsSubscription struct {
+	Subject string
+	//Queue is the queue group. Each Message is sent to one member of the group
+	Queue string
+	SID   string
+	//Max is how many Messages are sent before the subscription is removed. Zero is unlimited
+	Max       int
+	delivered int
+}
+
+//natsOutgoing is data queued for the client. Written is called once it has been written
+type natsOutgoing struct {
+	data    []byte
+	written func()
+}
+
+//natsClient serves a NATS client connection
+type natsClient struct {
+	broker *natsBroker
+	id     uint64
+	conn   net.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	out    chan natsOutgoing
+	//user is nil for clients that CONNECT without credentials. They can only subscribe to public Topics
+	user          *User
+	verbose       bool
+	subscriptions map[string]*natsSubscription
+	//inboxes are the inboxes the client has made requests with
+	inboxes map[string]bool
+}
+
+//ServeNATS serves NATS clients connecting to the listener with the NATS core client protocol.
+// Only returns when the listener fails
+func (pubsub *PubSub) ServeNATS(listener net.Listener) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := &natsBroker{
+		pubsub:   pubsub,
+		serverID: RandomString(22),
+		mu:       &sync.RWMutex{},
+		clients:  make(map[uint64]*natsClient),
+		inboxes:  make(map[string]*natsClient),
+	}
+	go broker.feed(ctx)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				log.Printf("error accepting NATS connection: %v\n", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go broker.serve(conn)
+	}
+}
+
+//feed routes the Messages of subscribed Topics from the SSE fan-out until ctx is done.
+// Registers again if the fan-out drops the broker for falling behind
+func (broker *natsBroker) feed(ctx context.Context) {
+	for {
+		clientName := RandomString(6)
+		receiver := make(chan SSEResponse, broker.pubsub.sseDistro.BufferSize)
+		broker.pubsub.sseDistro.Add <- SSEAddRequester{
+			ID:       clientName,
+			Receiver: receiver,
+			Match:    broker.live,
+		}
+		if !broker.forward(ctx, receiver) {
+			broker.pubsub.sseDistro.Cancel <- clientName
+			return
+		}
+		log.Println("NATS listener fell behind the SSE fan-out and Messages were dropped")
+	}
+}
+
+//forward routes the Messages from the receiver. Returns false once ctx is done and true if
+// the receiver was closed by the SSEDistro
+func (broker *natsBroker) forward(ctx context.Context, receiver chan SSEResponse) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case item, ok := <-receiver:
+			if !ok {
+				return true
+			}
+			if item.System != nil {
+				continue
+			}
+			broker.route(item.TopicName, item.Message.Attributes[natsReplyAttribute], item.Message.dataBytes(), true)
+		}
+	}
+}
+
+//live is whether the Topic's Messages should be sent to the broker
+func (broker *natsBroker) live(topicName string) bool {
+	broker.mu.RLock()
+	defer broker.mu.RUnlock()
+	for _, client := range broker.clients {
+		for _, sub := range client.subscriptions {
+			if natsMatch(sub.Subject, topicName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//route sends the message to the matching subscriptions, and to one member of each matching
+// queue group. Topic Messages are only sent to Users that can read the Topic, and replies
+// to inboxes only to the client that made the request.
+//
+//Clients are never waited on. Clients whose queue is full are disconnected as slow consumers
+func (broker *natsBroker) route(subject, reply string, payload []byte, topic bool) {
+	//access is worked out before locking as it takes the PubSub lock
+	broker.mu.RLock()
+	access := make(map[*User]bool)
+	for _, client := range broker.clients {
+		access[client.user] = !topic
+	}
+	broker.mu.RUnlock()
+	if topic {
+		for user := range access {
+			access[user] = broker.pubsub.streamable(subject, user)
+		}
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	requester := broker.inboxes[natsInbox(subject)]
+	groups := make(map[string][]*natsSubscription)
+	owners := make(map[*natsSubscription]*natsClient)
+	for _, client := range broker.clients {
+		if !access[client.user] || (!topic && client != requester) {
+			continue
+		}
+		for _, sub := range client.subscriptions {
+			if !natsMatch(sub.Subject, subject) {
+				continue
+			}
+			if sub.Queue == "" {
+				client.deliver(sub, subject, reply, payload)
+				continue
+			}
+			//queue groups are per subject, as in NATS
+			group := sub.Queue + " " + sub.Subject
+			groups[group] = append(groups[group], sub)
+			owners[sub] = client
+		}
+	}
+	for _, members := range groups {
+		sub := members[rand.Intn(len(members))]
+		owners[sub].deliver(sub, subject, reply, payload)
+	}
+}
+
+//remove stops routing to the client and frees its inboxes
+func (broker *natsBroker) remove(client *natsClient) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	delete(broker.clients, client.id)
+	for inbox := range client.inboxes {
+		delete(broker.inboxes, inbox)
+	}
+}
+
+//claimInbox records the client as the requester of the reply subject's inbox. Returns false
+// if another client made requests with the inbox first
+func (broker *natsBroker) claimInbox(client *natsClient, reply string) bool {
+	inbox := natsInbox(reply)
+	if inbox == "" {
+		return true
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if requester, ok := broker.inboxes[inbox]; ok && requester != client {
+		return false
+	}
+	broker.inboxes[inbox] = client
+	client.inboxes[inbox] = true
+	return true
+}
+
+//serve runs the client connection until it is closed
+func (broker *natsBroker) serve(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	broker.mu.Lock()
+	broker.nextID++
+	client := &natsClient{
+		broker:        broker,
+		id:            broker.nextID,
+		conn:          conn,
+		ctx:           ctx,
+		cancel:        cancel,
+		out:           make(chan natsOutgoing, broker.pubsub.sseDistro.BufferSize),
+		subscriptions: make(map[string]*natsSubscription),
+		inboxes:       make(map[string]bool),
+	}
+	broker.mu.Unlock()
+	defer broker.remove(client)
+	defer cancel()
+	go client.writeLoop()
+
+	info, err := json.Marshal(natsInfo{
+		ServerID:     broker.serverID,
+		ServerName:   "PubSub",
+		Version:      natsProtocolVersion,
+		Proto:        1,
+		MaxPayload:   natsMaxPayload,
+		AuthRequired: true,
+		ClientID:     client.id,
+	})
+	if err != nil {
+		log.Printf("error encoding NATS INFO: %v\n", err)
+		return
+	}
+	if !client.send([]byte("INFO " + string(info) + "\r\n")) {
+		return
+	}
+
+	reader := bufio.NewReaderSize(conn, natsMaxControlLine)
+	conn.SetReadDeadline(time.Now().Add(natsConnectTimeout))
+	op, err := readNATSOp(reader)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		err = natsError{Message: "Authentication Timeout", Fatal: true}
+	}
+	if err == nil && op.Name != "CONNECT" {
+		err = natsError{Message: "Authorization Violation", Fatal: true}
+	}
+	if err == nil {
+		err = client.connect(op.Args[0])
+	}
+	for err == nil {
+		//clients are pinged well within the deadline so only stale connections reach it
+		conn.SetReadDeadline(time.Now().Add(2 * natsPingInterval))
+		if op, err = readNATSOp(reader); err == nil {
+			err = client.handle(op)
+		}
+		if protocolErr, ok := err.(natsError); ok && !protocolErr.Fatal {
+			if !client.send(natsErrorLine(protocolErr)) {
+				return
+			}
+			err = nil
+		}
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		err = natsError{Message: "Stale Connection", Fatal: true}
+	}
+	if protocolErr, ok := err.(natsError); ok {
+		client.send(natsErrorLine(protocolErr))
+		client.flush()
+	}
+}
+
+//natsErrorLine encodes the error as `-ERR`
+func natsErrorLine(err natsError) []byte {
+	return []byte("-ERR '" + strings.Replace(err.Message, "'", "\"", -1) + "'\r\n")
+}
+
+//writeLoop writes queued data to the client, pinging it every natsPingInterval.
+// The session is ended if a write fails
+func (client *natsClient) writeLoop() {
+	defer client.conn.Close()
+	ping := time.NewTicker(natsPingInterval)
+	defer ping.Stop()
+	for {
+		outgoing := natsOutgoing{data: []byte("PING\r\n")}
+		select {
+		case <-client.ctx.Done():
+			return
+		case <-ping.C:
+		case outgoing = <-client.out:
+		}
+		client.conn.SetWriteDeadline(time.Now().Add(natsWriteTimeout))
+		if _, err := client.conn.Write(outgoing.data); err != nil {
+			client.cancel()
+			return
+		}
+		if outgoing.written != nil {
+			outgoing.written()
+		}
+	}
+}
+
+//send queues the data for the client, waiting while the queue is full.
+// Returns false if the session ended first
+func (client *natsClient) send(data []byte) bool {
+	select {
+	case client.out <- natsOutgoing{data: data}:
+		return true
+	case <-client.ctx.Done():
+		return false
+	}
+}
+
+//flush waits for the queued data to be written, or the session to end
+func (client *natsClient) flush() {
+	written := make(chan struct{})
+	select {
+	case client.out <- natsOutgoing{written: func() { close(written) }}:
+	case <-client.ctx.Done():
+		return
+	}
+	select {
+	case <-written:
+	case <-client.ctx.Done():
+	}
+}
+
+//deliver queues a MSG for the subscription without waiting, removing the subscription once
+// its Max is reached. Must be called holding the broker lock
+func (client *natsClient) deliver(sub *natsSubscription, subject, reply string, payload []byte) {
+	if client.ctx.Err() != nil {
+		return
+	}
+	select {
+	case client.out <- natsOutgoing{data: natsMessage(subject, sub.SID, reply, payload)}:
+	default:
+		log.Printf("NATS client %s fell behind and was disconnected\n", client.conn.RemoteAddr())
+		client.cancel()
+		return
+	}
+	sub.delivered++
+	if sub.Max > 0 && sub.delivered >= sub.Max {
+		delete(client.subscriptions, sub.SID)
+		client.freeInboxes()
+	}
+}
+
+//freeInboxes frees the client's inboxes that none of its subscriptions can receive replies
+// on any more, such as the single reply inboxes of old style requests. Must be called
+// holding the broker lock
+func (client *natsClient) freeInboxes() {
+	for inbox := range client.inboxes {
+		subscribed := false
+		for _, sub := range client.subscriptions {
+			if natsFilterCovers(sub.Subject, inbox) {
+				subscribed = true
+				break
+			}
+		}
+		if !subscribed {
+			delete(client.inboxes, inbox)
+			delete(client.broker.inboxes, inbox)
+		}
+	}
+}
+
+//connect logs the client in from its CONNECT options. `user` and `pass` log in the User as
+// the HTTP API does and `auth_token` the User of a token from `/users/user/token`.
+// Clients without credentials are anonymous
+func (client *natsClient) connect(options string) error {
+	connect := natsConnect{}
+	if err := json.Unmarshal([]byte(options), &connect); err != nil {
+		return natsError{Message: "Unknown Protocol Operation", Fatal: true}
+	}
+	var user *User
+	var err error
+	switch {
+	case connect.AuthToken != "":
+		user, err = client.broker.pubsub.TokenUser(connect.AuthToken)
+	case connect.User != "":
+		user, err = client.broker.pubsub.GetUser(connect.User, connect.Pass)
+	}
+	if err != nil {
+		return natsError{Message: "Authorization Violation", Fatal: true}
+	}
+	client.broker.mu.Lock()
+	client.user = user
+	client.verbose = connect.Verbose
+	client.broker.clients[client.id] = client
+	client.broker.mu.Unlock()
+	return client.ok()
+}
+
+//ok acknowledges the operation if the client asked for verbose mode
+func (client *natsClient) ok() error {
+	if client.verbose && !client.send([]byte("+OK\r\n")) {
+		return client.ctx.Err()
+	}
+	return nil
+}
+
+//handle carries out the client's operation. Returns a natsError for the client to be sent
+// or any other error to close the connection
+func (client *natsClient) handle(op natsOp) error {
+	switch op.Name {
+	case "PING":
+		if !client.send([]byte("PONG\r\n")) {
+			return client.ctx.Err()
+		}
+		return nil
+	case "PONG":
+		return nil
+	case "CONNECT":
+		//options can only be set once
+		return client.ok()
+	case "PUB":
+		reply := ""
+		if len(op.Args) == 3 {
+			reply = op.Args[1]
+		}
+		if err := client.publish(op.Args[0], reply, op.Payload); err != nil {
+			return err
+		}
+		return client.ok()
+	case "SUB":
+		if len(op.Args) != 2 && len(op.Args) != 3 {
+			return natsError{Message: "Unknown Protocol Operation", Fatal: true}
+		}
+		queue := ""
+		if len(op.Args) == 3 {
+			queue = op.Args[1]
+		}
+		if err := client.subscribe(op.Args[0], queue, op.Args[len(op.Args)-1]); err != nil {
+			return err
+		}
+		return client.ok()
+	case "UNSUB":
+		if len(op.Args) != 1 && len(op.Args) != 2 {
+			return natsError{Message: "Unknown Protocol Operation", Fatal: true}
+		}
+		max := 0
+		if len(op.Args) == 2 {
+			var err error
+			if max, err = strconv.Atoi(op.Args[1]); err != nil || max < 0 {
+				return natsError{Message: "Unknown Protocol Operation", Fatal: true}
+			}
+		}
+		client.unsubscribe(op.Args[0], max)
+		return client.ok()
+	default:
+		return natsError{Message: "Unknown Protocol Operation", Fatal: true}
+	}
+}
+
+//publish writes the payload to the subject's Topic, creating the Topic if needed as the write
+// endpoint does. The reply subject is kept as an attribute of the Message.
+//
+//Inbox subjects are sent straight to the requester so replies do not create Topics
+func (client *natsClient) publish(subject, reply string, payload []byte) error {
+	if !validNATSSubject(subject) || (reply != "" && !validNATSSubject(reply)) {
+		return natsError{Message: "Invalid Publish Subject"}
+	}
+	client.broker.mu.RLock()
+	user := client.user
+	client.broker.mu.RUnlock()
+	violation := natsError{Message: fmt.Sprintf("Permissions Violation for Publish to %q", subject)}
+	if user == nil {
+		return violation
+	}
+	if !client.broker.claimInbox(client, reply) {
+		return natsError{Message: fmt.Sprintf("Permissions Violation for Publish with Reply of %q", reply)}
+	}
+	if strings.HasPrefix(subject, natsInboxPrefix) {
+		client.broker.route(subject, reply, payload, false)
+		return nil
+	}
+	topic, err := client.broker.pubsub.GetTopic(subject, user)
+	if err != nil {
+		return natsError{Message: err.Error()}
+	}
+	msg := Message{Data: string(payload)}
+	if reply != "" {
+		msg.Attributes = map[string]string{natsReplyAttribute: reply}
+	}
+	msg.AddCreatedDatestring(time.Now())
+	if _, err := user.WriteToTopic(topic, msg); err != nil {
+		return violation
+	}
+	return nil
+}
+
+//subscribe adds the subscription, replacing any with the same sid. Subjects without
+// wildcards must be readable by the User
+func (client *natsClient) subscribe(subject, queue, sid string) error {
+	if !validNATSFilter(subject) {
+		return natsError{Message: "Invalid Subject"}
+	}
+	client.broker.mu.RLock()
+	user := client.user
+	client.broker.mu.RUnlock()
+	wildcard := strings.Contains("."+subject+".", ".*.") || strings.HasSuffix("."+subject, ".>")
+	if !wildcard && !strings.HasPrefix(subject, natsInboxPrefix) && !client.broker.pubsub.streamable(subject, user) {
+		return natsError{Message: fmt.Sprintf("Permissions Violation for Subscription to %q", subject)}
+	}
+	client.broker.mu.Lock()
+	defer client.broker.mu.Unlock()
+	client.subscriptions[sid] = &natsSubscription{Subject: subject, Queue: queue, SID: sid}
+	return nil
+}
+
+//unsubscribe removes the subscription, or once it has been sent max Messages if max is set.
+// Unknown sids are ignored as in NATS
+func (client *natsClient) unsubscribe(sid string, max int) {
+	client.broker.mu.Lock()
+	defer client.broker.mu.Unlock()
+	sub, ok := client.subscriptions[sid]
+	if !ok {
+		return
+	}
+	if max > 0 && sub.delivered < max {
+		sub.Max = max
+		return
+	}
+	delete(client.subscriptions, sid)
+	client.freeInboxes()
+}
@@ -0,0 +1,193 @@
+package pubsub
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//natsMaxPayload caps the payload of a PUB. It is sent to clients in INFO
+	natsMaxPayload = 1 << 20
+	//natsMaxControlLine caps the length of a protocol line read from a client
+	natsMaxControlLine = 4096
+	//natsConnectTimeout is how long a client has to send CONNECT once connected
+	natsConnectTimeout = 10 * time.Second
+	//natsWriteTimeout is how long a client can take to accept a message before it is disconnected
+	natsWriteTimeout = 10 * time.Second
+	//natsPingInterval is how often clients are pinged. Clients that send nothing, not even
+	// a PONG, for two intervals are disconnected
+	natsPingInterval = 2 * time.Minute
+	//natsInboxPrefix starts the subjects of request-reply inboxes. They are passed between
+	// clients directly and are not Topics
+	natsInboxPrefix = "_INBOX."
+	//natsReplyAttribute holds the reply subject of Messages published with one
+	natsReplyAttribute = "nats_reply_to"
+	//natsProtocolVersion is the version of the NATS server the client protocol matches
+	natsProtocolVersion = "2.2.0"
+)
+
+//natsInfo is the INFO sent to clients when they connect
+type natsInfo struct {
+	ServerID     string `json:"server_id"`
+	ServerName   string `json:"server_name"`
+	Version      string `json:"version"`
+	Proto        int    `json:"proto"`
+	Headers      bool   `json:"headers"`
+	MaxPayload   int    `json:"max_payload"`
+	AuthRequired bool   `json:"auth_required"`
+	ClientID     uint64 `json:"client_id"`
+}
+
+//natsConnect is the CONNECT options sent by a client. Options not listed are ignored
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	User      string `json:"user"`
+	Pass      string `json:"pass"`
+	AuthToken string `json:"auth_token"`
+	Name      string `json:"name"`
+}
+
+//natsError is a protocol error sent to the client as `-ERR`. Fatal errors close the connection
+type natsError struct {
+	Message string
+	Fatal   bool
+}
+
+func (err natsError) Error() string {
+	return err.Message
+}
+
+//natsOp is a protocol operation read from a client. Payload is only read for PUB
+type natsOp struct {
+	Name    string
+	Args    []string
+	Payload []byte
+}
+
+//readNATSOp reads the next operation from the client
+func readNATSOp(reader *bufio.Reader) (natsOp, error) {
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull || len(line) > natsMaxControlLine {
+			return natsOp{}, natsError{Message: "Maximum Control Line Exceeded", Fatal: true}
+		}
+		if err != nil {
+			return natsOp{}, err
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			continue
+		}
+		op := natsOp{Name: strings.ToUpper(fields[0]), Args: fields[1:]}
+		//the CONNECT options are JSON that can hold spaces
+		if op.Name == "CONNECT" {
+			op.Args = []string{strings.TrimSpace(string(line))[len(fields[0]):]}
+		}
+		if op.Name != "PUB" {
+			return op, nil
+		}
+		if len(op.Args) < 2 || len(op.Args) > 3 {
+			return op, natsError{Message: "Unknown Protocol Operation", Fatal: true}
+		}
+		size, err := strconv.Atoi(op.Args[len(op.Args)-1])
+		if err != nil || size < 0 {
+			return op, natsError{Message: "Unknown Protocol Operation", Fatal: true}
+		}
+		if size > natsMaxPayload {
+			return op, natsError{Message: "Maximum Payload Violation", Fatal: true}
+		}
+		//the payload is followed by CRLF
+		op.Payload = make([]byte, size+2)
+		if _, err := io.ReadFull(reader, op.Payload); err != nil {
+			return op, err
+		}
+		if string(op.Payload[size:]) != "\r\n" {
+			return op, natsError{Message: "Unknown Protocol Operation", Fatal: true}
+		}
+		op.Payload = op.Payload[:size]
+		return op, nil
+	}
+}
+
+//natsMessage encodes a MSG for the subscription. The reply subject is left out if empty
+func natsMessage(subject, sid, reply string, payload []byte) []byte {
+	header := "MSG " + subject + " " + sid + " "
+	if reply != "" {
+		header += reply + " "
+	}
+	msg := make([]byte, 0, len(header)+len(payload)+16)
+	msg = append(msg, header+strconv.Itoa(len(payload))+"\r\n"...)
+	msg = append(msg, payload...)
+	return append(msg, "\r\n"...)
+}
+
+//------------------------------------------- subjects
+
+//validNATSSubject is whether the subject can be published to. Subjects are dot separated
+// tokens that can not be empty or hold wildcards
+func validNATSSubject(subject string) bool {
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" || token == "*" || token == ">" {
+			return false
+		}
+	}
+	return true
+}
+
+//validNATSFilter is whether the subject can be subscribed to. `*` must fill a whole token
+// and `>` must be the last token
+func validNATSFilter(subject string) bool {
+	tokens := strings.Split(subject, ".")
+	for i, token := range tokens {
+		if token == "" || (token == ">" && i != len(tokens)-1) {
+			return false
+		}
+	}
+	return true
+}
+
+//natsInbox is the `_INBOX.<id>` inbox of the subject, or empty if it is not an inbox subject.
+// Requests can use the inbox itself or subjects under it as their reply subject
+func natsInbox(subject string) string {
+	if !strings.HasPrefix(subject, natsInboxPrefix) {
+		return ""
+	}
+	tokens := strings.SplitN(subject, ".", 3)
+	return tokens[0] + "." + tokens[1]
+}
+
+//natsFilterCovers is whether the subscribed subject matches the subject or subjects under it
+func natsFilterCovers(filter, subject string) bool {
+	filterTokens := strings.Split(filter, ".")
+	for i, token := range strings.Split(subject, ".") {
+		if i >= len(filterTokens) {
+			return false
+		}
+		if filterTokens[i] == ">" {
+			return true
+		}
+		if filterTokens[i] != "*" && filterTokens[i] != token {
+			return false
+		}
+	}
+	return true
+}
+
+//natsMatch is whether the subject matches the subscribed subject. `*` matches a single
+// token and `>` one or more tokens
+func natsMatch(filter, subject string) bool {
+	filterTokens := strings.Split(filter, ".")
+	tokens := strings.Split(subject, ".")
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(tokens) > i
+		}
+		if i >= len(tokens) || (token != "*" && token != tokens[i]) {
+			return false
+		}
+	}
+	return len(filterTokens) == len(tokens)
+}
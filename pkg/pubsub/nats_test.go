@@ -0,0 +1,118 @@
+package pubsub
+
+import "testing"
+
+func TestNATSMatch(t *testing.T) {
+	tests := []struct {
+		filter  string
+		subject string
+		want    bool
+	}{
+		{filter: "orders", subject: "orders", want: true},
+		{filter: "orders", subject: "orders.eu", want: false},
+		{filter: "orders.eu", subject: "orders", want: false},
+		{filter: "orders.*", subject: "orders.eu", want: true},
+		{filter: "orders.*", subject: "orders", want: false},
+		{filter: "orders.*", subject: "orders.eu.paid", want: false},
+		{filter: "*.eu", subject: "orders.eu", want: true},
+		{filter: "*.eu", subject: "orders.us", want: false},
+		{filter: "orders.>", subject: "orders.eu", want: true},
+		{filter: "orders.>", subject: "orders.eu.paid", want: true},
+		{filter: "orders.>", subject: "orders", want: false},
+		{filter: ">", subject: "orders", want: true},
+		{filter: "*", subject: "orders.eu", want: false},
+		{filter: "*.*.>", subject: "a.b.c", want: true},
+		{filter: "*.*.>", subject: "a.b", want: false},
+	}
+	for _, test := range tests {
+		if got := natsMatch(test.filter, test.subject); got != test.want {
+			t.Errorf("natsMatch(%q, %q) = %v, want %v", test.filter, test.subject, got, test.want)
+		}
+	}
+}
+
+func TestValidNATSSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    bool
+	}{
+		{subject: "orders", want: true},
+		{subject: "orders.eu", want: true},
+		{subject: "_INBOX.abc.1", want: true},
+		{subject: "", want: false},
+		{subject: "orders.", want: false},
+		{subject: ".orders", want: false},
+		{subject: "orders..eu", want: false},
+		{subject: "orders.*", want: false},
+		{subject: "orders.>", want: false},
+		{subject: "orders.e*", want: true},
+	}
+	for _, test := range tests {
+		if got := validNATSSubject(test.subject); got != test.want {
+			t.Errorf("validNATSSubject(%q) = %v, want %v", test.subject, got, test.want)
+		}
+	}
+}
+
+func TestValidNATSFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{filter: "orders", want: true},
+		{filter: "orders.*", want: true},
+		{filter: "*.eu.>", want: true},
+		{filter: ">", want: true},
+		{filter: "", want: false},
+		{filter: "orders.", want: false},
+		{filter: "orders..eu", want: false},
+		{filter: "orders.>.eu", want: false},
+		{filter: ">.orders", want: false},
+	}
+	for _, test := range tests {
+		if got := validNATSFilter(test.filter); got != test.want {
+			t.Errorf("validNATSFilter(%q) = %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestNATSInbox(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{subject: "_INBOX.abc", want: "_INBOX.abc"},
+		{subject: "_INBOX.abc.1", want: "_INBOX.abc"},
+		{subject: "_INBOX.abc.1.2", want: "_INBOX.abc"},
+		{subject: "orders", want: ""},
+		{subject: "_INBOXES.abc", want: ""},
+	}
+	for _, test := range tests {
+		if got := natsInbox(test.subject); got != test.want {
+			t.Errorf("natsInbox(%q) = %q, want %q", test.subject, got, test.want)
+		}
+	}
+}
+
+func TestNATSFilterCovers(t *testing.T) {
+	tests := []struct {
+		filter  string
+		subject string
+		want    bool
+	}{
+		{filter: "_INBOX.abc", subject: "_INBOX.abc", want: true},
+		{filter: "_INBOX.abc.*", subject: "_INBOX.abc", want: true},
+		{filter: "_INBOX.abc.1.2", subject: "_INBOX.abc", want: true},
+		{filter: "_INBOX.>", subject: "_INBOX.abc", want: true},
+		{filter: "_INBOX.*", subject: "_INBOX.abc", want: true},
+		{filter: ">", subject: "_INBOX.abc", want: true},
+		{filter: "_INBOX", subject: "_INBOX.abc", want: false},
+		{filter: "_INBOX.xyz.*", subject: "_INBOX.abc", want: false},
+		{filter: "orders", subject: "_INBOX.abc", want: false},
+	}
+	for _, test := range tests {
+		if got := natsFilterCovers(test.filter, test.subject); got != test.want {
+			t.Errorf("natsFilterCovers(%q, %q) = %v, want %v", test.filter, test.subject, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	//SystemEventTombstoned is sent when a stale Subscription is marked for deletion
+	SystemEventTombstoned = "subscription.tombstoned"
+	//SystemEventDeleted is sent when a tombstoned Subscription is deleted
+	SystemEventDeleted = "subscription.deleted"
+	//HeaderEvent carries the SystemEvent name on system event push requests. It is absent on message pushes
+	HeaderEvent = "X-PubSub-Event"
+	//DeliveryTypeNotification is the DeliveryAttempt type of a SystemEvent sent to a webhook
+	DeliveryTypeNotification = "notification"
+)
+
+//SystemEvent tells a Subscriber about a change to its Subscription made by PubSub itself
+// such as garbage collection. It is pushed to the PushURL of push Subscribers and emitted
+// on the Topic's SSE stream as a named event
+type SystemEvent struct {
+	//Event is SystemEventTombstoned or SystemEventDeleted
+	Event      string `json:"event"`
+	Topic      string `json:"topic_id"`
+	Subscriber string `json:"subscriber_id"`
+	//Subscription is the name of the Subscription. Empty for the User's default Subscription
+	Subscription string `json:"subscription,omitempty"`
+	Reason       string `json:"reason"`
+	//MessageID is the pointer position the Subscription was stuck at
+	MessageID int    `json:"message_id"`
+	Timestamp string `json:"timestamp"`
+	//DeleteAfter is when a tombstoned Subscription will be deleted unless it shows activity
+	DeleteAfter string `json:"delete_after,omitempty"`
+	//Resubscribe is a hint on how to recover the Subscription
+	Resubscribe string `json:"resubscribe"`
+}
+
+//toJSON marshalls the response object to JSON binary
+func (event SystemEvent) toJSON() ([]byte, error) {
+	return json.MarshalIndent(event, " ", " ")
+}
+
+//subscriptionEvent builds the SystemEvent for the stale Subscriber at the pointer position of the Topic.
+// deleteAfter is only used for SystemEventTombstoned
+func subscriptionEvent(eventName string, topic *Topic, subscriber *Subscriber, pointer int, consideredStale time.Duration, deleteAfter time.Time) SystemEvent {
+	event := SystemEvent{
+		Event:        eventName,
+		Topic:        topic.Name,
+		Subscriber:   subscriber.ID,
+		Subscription: subscriber.Name,
+		Reason:       fmt.Sprintf("no messages acknowledged since message #%d which is older than %s", pointer, consideredStale),
+		MessageID:    pointer,
+		Timestamp:    time.Now().Format(time.RFC3339),
+	}
+	switch eventName {
+	case SystemEventTombstoned:
+		event.DeleteAfter = deleteAfter.Format(time.RFC3339)
+		event.Resubscribe = "acknowledge or pull a message before delete_after to keep the subscription, or resubscribe at /topics/topic/subscribe"
+	default:
+		event.Resubscribe = fmt.Sprintf("resubscribe at /topics/topic/subscribe with topic %s to receive new messages. Messages since #%d may no longer be available", topic.Name, pointer)
+	}
+	return event
+}
+
+//emitSystemEvent sends the SystemEvent to the Topic's SSE stream and, for push Subscribers,
+// to the PushURL. Neither is waited on so it can be called while holding locks
+func (pubsub *PubSub) emitSystemEvent(topic *Topic, subscriber *Subscriber, event SystemEvent) {
+	if topic.sseOut != nil {
+		go func(out chan SSEResponse) {
+			out <- SSEResponse{
+				TopicName: topic.Name,
+				Event:     event.Event,
+				System:    &event,
+			}
+		}(topic.sseOut)
+	}
+	if subscriber.PushURL != "" && pubsub.pushDispatcher != nil {
+		go pubsub.pushDispatcher.pushSystemEvent(subscriber, event)
+	}
+}
+
+//pushSystemEvent makes a single signed POST of the SystemEvent to the Subscriber's PushURL.
+// Failures are logged and recorded in the delivery history but not retried
+func (dispatcher *PushDispatcher) pushSystemEvent(subscriber *Subscriber, event SystemEvent) {
+	parcel, err := event.toJSON()
+	if err != nil {
+		log.Printf("error converting system event to JSON: %v\n", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, subscriber.PushURL, bytes.NewReader(parcel))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event.Event)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if subscriber.Secret != "" {
+		req.Header.Set(HeaderSignature, signPayload(subscriber.Secret, timestamp, parcel))
+	}
+	//wait for a free slot
+	dispatcher.slots <- struct{}{}
+	defer func() { <-dispatcher.slots }()
+
+	attempt := DeliveryAttempt{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Type:      DeliveryTypeNotification,
+		MessageID: event.MessageID,
+	}
+	started := time.Now()
+	resp, err := dispatcher.client.Do(req)
+	attempt.Latency = time.Since(started).Milliseconds()
+	if err == nil {
+		defer resp.Body.Close()
+		//drain so the connection can be reused
+		io.Copy(io.Discard, resp.Body)
+		attempt.StatusCode = resp.StatusCode
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			err = fmt.Errorf("webhook responded with status code %d", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+		log.Printf("could not send %s event to subscriber %s of topic %s: %v\n", event.Event, subscriber.ID, event.Topic, err)
+	}
+	subscriber.deliveries.record(attempt)
+}
@@ -2,6 +2,7 @@ package pubsub
 
 import (
 	"fmt"
+	"net/url"
 	"path"
 	"strconv"
 	"strings"
@@ -15,10 +16,14 @@ type PersistCore struct {
 	userWriter       chan User                    //userWriter used for saving User data in persistent layer
 	subscriberWriter chan PersistSubscriberStruct //subscriberWriter chan to persist layer for saving
 	messageWriter    chan PersistMessageStruct    // messageWriter chan to persist layer for saving
+	snapshotWriter   chan Snapshot                //snapshotWriter chan to persist layer for saving
+	accessWriter     chan TopicAccess             //accessWriter chan to persist layer for saving
 
 	userDeleter       chan string                  //userDeleter takes a user.UUID as input
 	subscriberDeleter chan PersistSubscriberStruct //subscriberDeleter takes data for sub deletion
 	messageDeleter    chan PersistMessageStruct    //messageDeleter takes data for msg deletion
+	snapshotDeleter   chan Snapshot                //snapshotDeleter takes the Snapshot to delete
+	accessDeleter     chan TopicAccess             //accessDeleter takes the TopicAccess to delete by its Topic
 }
 
 //Persist is the interface for adding persistent storage
@@ -63,8 +68,8 @@ type Persist interface {
 	StreamMessages() (chan Streamer, error)
 	//DeleteUser accepts UserID which is the userhash string
 	DeleteUser() error
-	//DeleteSubscriber accepts subscriberID (the userID of the subscription),
-	// topicName.
+	//DeleteSubscriber accepts subscriberID (the userID of the subscription,
+	// suffixed with `:{name}` for shared subscriptions), topicName.
 	//
 	//Add messageID as -1 if not available. Func will they cycle through the topic and delete matches to subscriberID
 	DeleteSubscriber() error
@@ -72,10 +77,37 @@ type Persist interface {
 	DeleteMessage() error
 }
 
+//SnapshotPersist is implemented by Persist layers that also store Snapshots. It is optional.
+// With a Persist layer that does not implement it Snapshots are lost on restart
+type SnapshotPersist interface {
+	//WriteSnapshot adds a snapshot to the persistence layer
+	// from a Snapshot chan
+	WriteSnapshot() error
+	//StreamSnapshots returns a chan through which it streams all
+	// Snapshots from the db
+	StreamSnapshots() (chan Streamer, error)
+	//DeleteSnapshot accepts the Snapshot to delete
+	DeleteSnapshot() error
+}
+
+//TopicAccessPersist is implemented by Persist layers that also store who can read Topics.
+// It is optional. With a Persist layer that does not implement it private Topics are public
+// again after a restart until their creator sets their access again
+type TopicAccessPersist interface {
+	//WriteTopicAccess adds the access settings of a Topic to
+	// the persistence layer from a TopicAccess chan
+	WriteTopicAccess() error
+	//StreamTopicAccess returns a chan through which it streams
+	// the TopicAccess of all non-public Topics from the db
+	StreamTopicAccess() (chan Streamer, error)
+	//DeleteTopicAccess accepts the TopicAccess to delete
+	DeleteTopicAccess() error
+}
+
 //Streamer is the response object from Stream restore methods of
 // the Persist interface
 type Streamer struct {
-	//Unit is User, Subscriber or Message. Topic can be
+	//Unit is User, Subscriber, Message, Snapshot or TopicAccess. Topic can be
 	// passed but is implicitly available in the Key
 	Unit tombstoner
 	//Key is the db key which contains id information for
@@ -85,15 +117,36 @@ type Streamer struct {
 	// {bucketName/}TopicName/MessageID[/SubscriberID]
 	//or just:
 	// {bucketName/}UserID
+	//
+	//TopicName is escaped with escapeTopicName as Topic names can contain `/`
 	Key string
 }
 
+//escapeTopicName escapes the Topic name for use as one part of a `/` separated persist
+// layer key or file path. MQTT topics and STOMP destinations contain `/`
+func escapeTopicName(topicName string) string {
+	return url.PathEscape(topicName)
+}
+
+//unescapeTopicName gives the Topic name from a persist layer key part made by escapeTopicName.
+// Parts that are not valid escapes, such as the unescaped `50%off` of stores written before
+// Topic names were escaped, are taken as the Topic name as is
+func unescapeTopicName(escaped string) string {
+	topicName, err := url.PathUnescape(escaped)
+	if err != nil {
+		return escaped
+	}
+	return topicName
+}
+
 //PersistSubscriberStruct is a channel object for sending // messages to be saved by the persist layer
 type PersistSubscriberStruct struct {
 	Subscriber   Subscriber //for saving
 	MessageID    int
 	TopicName    string
 	SubscriberID string //for deletions
+	//Move removes the Subscriber's keys at other positions in the Topic in the same write. For saving
+	Move bool
 }
 
 //PersistMessageStruct is a channel object for sending // messages to be saved by the persist layer
@@ -139,8 +192,7 @@ func restoreMessages(ping *User, pubsub *PubSub, persist Persist) error {
 		if err != nil {
 			return err
 		}
-		fmt.Println(pieces)
-		topicName := pieces[len(pieces)-2]
+		topicName := unescapeTopicName(pieces[len(pieces)-2])
 		//Create Topic if not yet existing
 		if _, ok := pubsub.Topics[topicName]; !ok {
 			pubsub.CreateTopic(topicName, ping) //need userID which is in subscriber.Creator -> bool. So default to `ping' and have this updated when restoring subscriptions.
@@ -166,13 +218,22 @@ func restoreSubscriptions(ping *User, pubsub *PubSub, persist Persist) error {
 			return fmt.Errorf("StreamSubscribers did not return *Subscriber")
 		}
 		sub.mu = &sync.RWMutex{}
+		sub.deliveries = newDeliveryHistory()
+		//pull consumers of shared Subscriptions rejoin on their next pull
+		if sub.Shared && sub.Members == nil {
+			sub.Members = make(map[string]*GroupMember)
+		}
+		//the parsed filter is not persisted
+		if sub.filter, err = ParseFilter(sub.Filter); err != nil {
+			return fmt.Errorf("could not restore filter of subscription %s: %v", subShell.Key, err)
+		}
 		pieces := strings.Split(subShell.Key, "/")
 		subID := pieces[len(pieces)-1]
 		msgID, err := strconv.Atoi(pieces[len(pieces)-2])
 		if err != nil {
 			return err
 		}
-		topicName := pieces[len(pieces)-3]
+		topicName := unescapeTopicName(pieces[len(pieces)-3])
 
 		//Do not restore topic if topic has no messages - otherwise a topic restore is done in restoreMessages
 		if _, ok := pubsub.Topics[topicName]; !ok {
@@ -183,8 +244,10 @@ func restoreSubscriptions(ping *User, pubsub *PubSub, persist Persist) error {
 			pubsub.Topics[topicName].PointerPositions[msgID] = make(Subscribers)
 		}
 		pubsub.Topics[topicName].PointerPositions[msgID][subID] = sub
+		//resume push deliveries
+		pubsub.pushDispatcher.Register(pubsub.Topics[topicName], sub)
 		//restore subscription reference to User subscription list
-		pubsub.Users[sub.UsernameHash].Subscriptions[topicName] = sub.PushURL
+		pubsub.Users[sub.UsernameHash].Subscriptions[userSubscriptionKey(topicName, sub.Name)] = sub.PushURL
 		//restore as creator of Topic if marked on subscription and not the default ping
 		if sub.Creator && sub.ID != ping.UUID {
 			pubsub.Topics[topicName].Creator = sub.ID
@@ -193,6 +256,52 @@ func restoreSubscriptions(ping *User, pubsub *PubSub, persist Persist) error {
 	return nil
 }
 
+//restoreSnapshots is a component of restore function
+func restoreSnapshots(pubsub *PubSub, persist SnapshotPersist) error {
+	snapStream, err := persist.StreamSnapshots()
+	if err != nil {
+		return err
+	}
+	for snapShell := range snapStream {
+		snapshot, ok := snapShell.Unit.(*Snapshot)
+		if !ok {
+			return fmt.Errorf("StreamSnapshots did not return *Snapshot")
+		}
+		//Do not restore to topics that were not restored or once expired
+		topic, ok := pubsub.Topics[snapshot.Topic]
+		if !ok || snapshot.expired() {
+			continue
+		}
+		topic.Snapshots[snapshot.Name] = snapshot
+	}
+	return nil
+}
+
+//restoreTopicAccess is a component of restore function
+func restoreTopicAccess(pubsub *PubSub, persist TopicAccessPersist) error {
+	accessStream, err := persist.StreamTopicAccess()
+	if err != nil {
+		return err
+	}
+	for accessShell := range accessStream {
+		access, ok := accessShell.Unit.(*TopicAccess)
+		if !ok {
+			return fmt.Errorf("StreamTopicAccess did not return *TopicAccess")
+		}
+		//Do not restore to topics that were not restored
+		topic, ok := pubsub.Topics[access.Topic]
+		if !ok {
+			continue
+		}
+		topic.Private = access.Private
+		topic.Readers = access.Readers
+		if topic.Readers == nil {
+			topic.Readers = make(map[string]bool)
+		}
+	}
+	return nil
+}
+
 //restore reinstates a snapshot back to memory if it exists
 func restore(pubsub *PubSub, persist Persist) error {
 	//get ping superuser as default Topic creator
@@ -209,6 +318,18 @@ func restore(pubsub *PubSub, persist Persist) error {
 	if err := restoreMessages(ping, pubsub, persist); err != nil {
 		return err
 	}
+	//restore snapshots of the restored Topics if the persist layer stores them
+	if snapshots, ok := persist.(SnapshotPersist); ok {
+		if err := restoreSnapshots(pubsub, snapshots); err != nil {
+			return err
+		}
+	}
+	//restore who can read the restored Topics before anyone subscribes
+	if access, ok := persist.(TopicAccessPersist); ok {
+		if err := restoreTopicAccess(pubsub, access); err != nil {
+			return err
+		}
+	}
 	//restore subscriptions last
 	if err := restoreSubscriptions(ping, pubsub, persist); err != nil {
 		return err
@@ -1,16 +1,17 @@
 package pubsub
 
 import (
-	"bytes"
 	"fmt"
 	"log"
-	"net/http"
 	"sync"
 	"time"
 )
 
 //Close is the tidy-up script that should be used as a defer after calling getReady function
 func (pubsub *PubSub) Close() error {
+	if err := pubsub.pushDispatcher.Close(); err != nil {
+		return err
+	}
 	if err := pubsub.persistLayer.TidyUp(); err != nil {
 		return err
 	}
@@ -89,6 +90,10 @@ func (pubsub *PubSub) CreateTopic(topicName string, user *User) (*Topic, error)
 		Messages:         make(map[int]Message),
 		mu:               &sync.RWMutex{},
 		sseOut:           pubsub.sseDistro.Intake,
+		dispatcher:       pubsub.pushDispatcher,
+		arrivals:         make(chan struct{}),
+		Snapshots:        make(map[string]*Snapshot),
+		Readers:          make(map[string]bool),
 	}
 	//Add the topic to the public topic list
 	pubsub.mu.Lock()
@@ -96,7 +101,7 @@ func (pubsub *PubSub) CreateTopic(topicName string, user *User) (*Topic, error)
 	pubsub.Topics[newTopic.Name] = newTopic
 	//subscribe the User
 	p := pubsub.Topics[topicName]
-	user.Subscribe(p, "")
+	user.Subscribe(p, SubscriptionOptions{})
 	//remove any tombstones on the user
 	if err := user.removeTombstone(); err != nil {
 		return nil, err
@@ -105,94 +110,6 @@ func (pubsub *PubSub) CreateTopic(topicName string, user *User) (*Topic, error)
 	return p, nil
 }
 
-//PushWebhooks runs through all topics and pushes messages to
-// the subscribers as a Webhook service. Exponential backoff for non 201/200 unacknoledged pushes up to 1 hour attempt intervals.
-//
-//Should run through continuously
-func (pubsub *PubSub) PushWebhooks() error {
-	//cycle through Topics
-	for _, topic := range pubsub.Topics {
-		//cycle through Messages
-		for msgID, message := range topic.Messages {
-			//cycle must complete before exit
-			wg := &sync.WaitGroup{}
-			//send message to all push subscribers
-			topic.mu.RLock()
-			for _, subscriber := range topic.PointerPositions[msgID] {
-				wg.Add(1)
-				go pubsub.webhookRoutine(topic, message, subscriber, wg)
-			}
-			topic.mu.RUnlock()
-			wg.Wait()
-		}
-	}
-	return nil
-}
-
-//webhookRoutine is the goroutine does the push via http.POST with built in exponential backoff from the default push cycle. Intended for use in PushWebhooks
-func (pubsub *PubSub) webhookRoutine(topic *Topic, message Message, subscriber *Subscriber, wg *sync.WaitGroup) {
-	defer wg.Done()
-	if subscriber.PushURL != "" {
-		subscriber.mu.Lock()
-		defer subscriber.mu.Unlock()
-		//exit it still need to backoff from last send
-		if !subscriber.lastpushAttempt.IsZero() && subscriber.lastpushAttempt.Add(subscriber.backoff).After(time.Now()) {
-			return
-		}
-		//push to url and await for 200/201 acknolegement
-		msgParcel := MessageResp{
-			Topic:   topic.Name,
-			Message: message,
-		}
-		parcel, err := msgParcel.toJSON()
-		if err != nil { //This needs logging for followup as not dealt with here
-			log.Printf("Error converting to JSON from webhookRoutine goroutine: %v", err)
-			return
-		} //?echo err and continue?
-		resp, err := http.Post(subscriber.PushURL, "application/json", bytes.NewReader(parcel))
-		if err != nil || (resp.StatusCode != 200 && resp.StatusCode != 201) {
-			//debug logging
-			log.Println(fmt.Errorf("could not deliver msg: error: %v (StatusCode: %d)\nSubscriber: %s, [Message: %+v]", err, resp.StatusCode, subscriber.ID, msgParcel))
-
-			pubsub.mu.RLock()
-			p := pubsub.Topics[topic.Name]
-			pubsub.mu.RUnlock()
-
-			p.mu.Lock()
-			//set backoff for next attempt
-			subscriber.lastpushAttempt = time.Now()
-			if subscriber.backoff == 0 {
-				subscriber.backoff = 80 * time.Millisecond
-			}
-			subscriber.backoff = subscriber.backoff * 2
-			//cap exponential backoff at 1 hour
-			if subscriber.backoff > (60 * time.Minute) {
-				subscriber.backoff = 60 * time.Minute
-			}
-			p.mu.Unlock()
-
-			return
-		}
-		//push subscriber pointer up an index place
-		pubsub.mu.RLock()
-		p := pubsub.Topics[topic.Name]
-		pubsub.mu.RUnlock()
-
-		p.mu.Lock()
-		//reset the backoff fields
-		subscriber.lastpushAttempt = time.Time{}
-		subscriber.backoff = 80 * time.Millisecond
-		//move up to next pointer position
-		if _, ok := pubsub.Topics[topic.Name].PointerPositions[message.ID+1]; !ok {
-			pubsub.Topics[topic.Name].PointerPositions[message.ID+1] = make(Subscribers)
-		}
-		pubsub.Topics[topic.Name].PointerPositions[message.ID+1][subscriber.ID] = subscriber
-		//delete previous pointer position record
-		delete(pubsub.Topics[topic.Name].PointerPositions[message.ID], subscriber.ID)
-		p.mu.Unlock()
-	}
-}
-
 //Tombstone cycles through and does tombstoning and deletion activities
 //
 //ConsideredStale is the time duration after which an item is considered stale and okay to tombstone
@@ -214,6 +131,10 @@ func (pubsub *PubSub) Tombstone(consideredStale, resurrectionOpportunity time.Du
 	if err := pubsub.messageTombstone(resurrectionOpportunity); err != nil {
 		return err
 	}
+	//snapshot tombstoning
+	if err := pubsub.snapshotTombstone(resurrectionOpportunity); err != nil {
+		return err
+	}
 	//topic tombstoning
 	if err := pubsub.topicTombstone(consideredStale); err != nil {
 		return err
@@ -228,58 +149,74 @@ func (pubsub *PubSub) Tombstone(consideredStale, resurrectionOpportunity time.Du
 
 //subscriptionTombstone used in tombstone for running tombstone and delete functions on Subscription objects
 func (pubsub *PubSub) subscriptionTombstone(consideredStale, resurrectionOpportunity time.Duration) error {
-
 	for _, topic := range pubsub.Topics {
-		//skip topic if has no subscribers or if topic has no messages
-		if len(topic.PointerPositions) < 1 || len(topic.Messages) < 1 {
+		if err := pubsub.topicSubscriptionTombstone(topic, consideredStale, resurrectionOpportunity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//topicSubscriptionTombstone runs subscriptionTombstone on the Subscribers of a single Topic.
+// The Topic is locked throughout as push workers move Subscribers at any time
+func (pubsub *PubSub) topicSubscriptionTombstone(topic *Topic, consideredStale, resurrectionOpportunity time.Duration) error {
+	topic.mu.Lock()
+	defer topic.mu.Unlock()
+	//skip topic if has no subscribers or if topic has no messages
+	if len(topic.PointerPositions) < 1 || len(topic.Messages) < 1 {
+		return nil
+	}
+	for pointer, subscribers := range topic.PointerPositions {
+		//skip pointer to head+1 message as these are queued awaiting the next added message
+		if pointer >= topic.PointerHead {
 			continue
 		}
-		for pointer, subscribers := range topic.PointerPositions {
-			//skip pointer to head+1 message as these are queued awaiting the next added message
-			if pointer >= topic.PointerHead {
-				continue
+		//if pointer is to a message less than `consideredStale` old - leave alone
+		if t, err := topic.Messages[pointer].GetCreatedDateTime(); !isStale(t, consideredStale) {
+			if err != nil {
+				//send debug info to std.out
+				log.Printf("{Error: \"GetCreatedDateTime from subscriptionTombstone\", Subscriber: %+v, Topic: \"%s\", Pointer: %d, Message Count: %d, Message: %+v}\n", topic.PointerPositions[pointer], topic.Name, pointer, len(topic.Messages), topic.Messages[pointer])
+
+				return err
 			}
-			//if pointer is to a message less than `consideredStale` old - leave alone
-			if t, err := topic.Messages[pointer].GetCreatedDateTime(); !isStale(t, consideredStale) {
+			continue
+		}
+		//else comb through subscriber list and tombstone
+		for _, subscriber := range subscribers {
+			if subscriber.tombstone != "" {
+				tombstoneDate, err := parseTombstoneDateString(subscriber.tombstone)
 				if err != nil {
-					//send debug info to std.out
-					log.Printf("{Error: \"GetCreatedDateTime from subscriptionTombstone\", Subscriber: %+v, Topic: \"%s\", Pointer: %d, Message Count: %d, Message: %+v}\n", topic.PointerPositions[pointer], topic.Name, pointer, len(topic.Messages), topic.Messages[pointer])
-
 					return err
 				}
-				continue
-			}
-			//else comb through subscriber list and tombstone
-			for _, subscriber := range subscribers {
-				if subscriber.tombstone != "" {
-					tombstoneDate, err := parseTombstoneDateString(subscriber.tombstone)
-					if err != nil {
-						return err
+				if tombstoneDate.Add(resurrectionOpportunity).Before(time.Now()) {
+					//delete subscription
+					delete(topic.PointerPositions[pointer], subscriber.key())
+					pubsub.pushDispatcher.Deregister(topic.Name, subscriber.key())
+					log.Printf("Deleted subscription %s from topic %s\n", subscriber.key(), topic.Name)
+					pubsub.emitSystemEvent(topic, subscriber, subscriptionEvent(SystemEventDeleted, topic, subscriber, pointer, consideredStale, time.Time{}))
+					//also delete User Subscriptions list
+					if user, ok := pubsub.Users[subscriber.UsernameHash]; ok {
+						user.mu.Lock()
+						delete(user.Subscriptions, userSubscriptionKey(topic.Name, subscriber.Name)) //need User.UsernameHash here instead of User.UUID
+						user.mu.Unlock()
+					} else {
+						log.Printf("Should be able to find user %s to delete topic.Name from Subscriptions but can not.", subscriber.UsernameHash)
 					}
-					if tombstoneDate.Add(resurrectionOpportunity).Before(time.Now()) {
-						//delete subscription
-						delete(topic.PointerPositions[pointer], subscriber.ID)
-						log.Printf("Deleted subscription %s from topic %s\n", subscriber.ID, topic.Name)
-						//also delete User Subscriptions list
-						if _, ok := pubsub.Users[subscriber.UsernameHash]; ok {
-							delete(pubsub.Users[subscriber.UsernameHash].Subscriptions, topic.Name) //need User.UsernameHash here instead of User.UUID
-						} else {
-							log.Printf("Should be able to find user %s to delete topic.Name from Subscriptions but can not.", subscriber.UsernameHash)
-						}
-						//delete from persist store
-						pubsub.persistLayer.Switchboard().subscriberDeleter <- PersistSubscriberStruct{
-							MessageID:    pointer,
-							TopicName:    topic.Name,
-							SubscriberID: subscriber.ID,
-						}
+					//delete from persist store
+					pubsub.persistLayer.Switchboard().subscriberDeleter <- PersistSubscriberStruct{
+						MessageID:    pointer,
+						TopicName:    topic.Name,
+						SubscriberID: subscriber.key(),
 					}
-					continue
-				}
-				//tombstone if no previous tombstone
-				if err := subscriber.addTombstone(); err != nil {
-					return err
 				}
+				continue
+			}
+			//tombstone if no previous tombstone
+			if err := subscriber.addTombstone(); err != nil {
+				return err
 			}
+			//give subscribers the chance to recover before deletion
+			pubsub.emitSystemEvent(topic, subscriber, subscriptionEvent(SystemEventTombstoned, topic, subscriber, pointer, consideredStale, time.Now().Add(resurrectionOpportunity)))
 		}
 	}
 	return nil
@@ -290,33 +227,52 @@ func (pubsub *PubSub) subscriptionTombstone(consideredStale, resurrectionOpportu
 //Definition of old is zero subscribers at or below messages in this pointer position
 func (pubsub *PubSub) messageTombstone(resurrectionOpportunity time.Duration) error {
 	//cycle through Topics
-	for topicName, topic := range pubsub.Topics {
-		//if topic has no messages then skip
-		if len(topic.Messages) == 0 {
+	for _, topic := range pubsub.Topics {
+		if err := pubsub.topicMessageTombstone(topic, resurrectionOpportunity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//topicMessageTombstone runs messageTombstone on the Messages of a single Topic. The Topic is
+// locked throughout as push workers move Subscribers at any time
+func (pubsub *PubSub) topicMessageTombstone(topic *Topic, resurrectionOpportunity time.Duration) error {
+	topic.mu.Lock()
+	defer topic.mu.Unlock()
+	//if topic has no messages then skip
+	if len(topic.Messages) == 0 {
+		return nil
+	}
+	//messages from the lowest snapshot position up are kept
+	pin, pinned := topic.pinned()
+	//as is the MQTT retained message however old it is
+	retained, hasRetained := topic.mqttRetainedID()
+	//delete messages from bottom up where subscriber length is 0. Seeks and acknowledgements
+	// move Subscribers past positions that were never in PointerPositions
+	for lowestPosition := topic.oldestRetained(); lowestPosition < topic.PointerHead && len(topic.PointerPositions[lowestPosition]) < 1 && !(pinned && lowestPosition >= pin); lowestPosition += 1 {
+		if _, ok := topic.Messages[lowestPosition]; !ok || (hasRetained && lowestPosition == retained) {
 			continue
 		}
-		//delete messages from bottom up where subscriber length is 0
-		for lowestPosition := (topic.PointerHead - len(topic.PointerPositions)); len(topic.PointerPositions[lowestPosition]) < 1 && topic.PointerPositions[lowestPosition] != nil; lowestPosition += 1 {
-			//tombstone if no tombstone already
-			if topic.Messages[lowestPosition].tombstone == "" {
-				m := pubsub.Topics[topicName].Messages[lowestPosition]
-				m.tombstone = tombstoneDateString()
-				pubsub.Topics[topicName].Messages[lowestPosition] = m
-			}
-			//get tombstone
-			tombstone, err := parseTombstoneDateString(topic.Messages[lowestPosition].tombstone)
-			if err != nil {
-				return err
-			}
-			//check if tombstone is older than resurrectionOpportunity duration
-			if isStale(tombstone, resurrectionOpportunity) {
-				delete(pubsub.Topics[topicName].Messages, lowestPosition)
-				log.Printf("Deleted message %d from topic %s\n", lowestPosition, topic.Name)
-				//remove from persist store
-				pubsub.persistLayer.Switchboard().messageDeleter <- PersistMessageStruct{
-					TopicName: topicName,
-					MessageID: lowestPosition,
-				}
+		//tombstone if no tombstone already
+		if topic.Messages[lowestPosition].tombstone == "" {
+			m := topic.Messages[lowestPosition]
+			m.tombstone = tombstoneDateString()
+			topic.Messages[lowestPosition] = m
+		}
+		//get tombstone
+		tombstone, err := parseTombstoneDateString(topic.Messages[lowestPosition].tombstone)
+		if err != nil {
+			return err
+		}
+		//check if tombstone is older than resurrectionOpportunity duration
+		if isStale(tombstone, resurrectionOpportunity) {
+			delete(topic.Messages, lowestPosition)
+			log.Printf("Deleted message %d from topic %s\n", lowestPosition, topic.Name)
+			//remove from persist store
+			pubsub.persistLayer.Switchboard().messageDeleter <- PersistMessageStruct{
+				TopicName: topic.Name,
+				MessageID: lowestPosition,
 			}
 		}
 	}
@@ -329,7 +285,10 @@ func (pubsub *PubSub) messageTombstone(resurrectionOpportunity time.Duration) er
 //AND older than `consideredStale` length of time
 func (pubsub *PubSub) topicTombstone(consideredStale time.Duration) error {
 	for topicName, topic := range pubsub.Topics {
-		if len(topic.Messages) < 1 {
+		topic.mu.RLock()
+		empty := len(topic.Messages) < 1
+		topic.mu.RUnlock()
+		if empty {
 			//check for existing topicTombstone
 			if topic.tombstone == "" {
 				//add tombstone if recently eligible
@@ -343,6 +302,11 @@ func (pubsub *PubSub) topicTombstone(consideredStale time.Duration) error {
 			}
 			if isStale(tdate, consideredStale) {
 				delete(pubsub.Topics, topicName)
+				pubsub.pushDispatcher.DeregisterTopic(topicName)
+				//a later Topic of the same name starts public
+				if topic.Private || len(topic.Readers) > 0 {
+					dropTopicAccess(pubsub.persistLayer, TopicAccess{Topic: topicName})
+				}
 				log.Printf("Deleted topic %s\n", topicName)
 			}
 		}
@@ -356,16 +320,19 @@ func (pubsub *PubSub) topicTombstone(consideredStale time.Duration) error {
 //Definition of stale is a user with no subscriptions and creator of no Topics
 func (pubsub *PubSub) userTombstone(resurrectionOpportunity time.Duration) error {
 	for usr, user := range pubsub.Users {
-		if len(user.Subscriptions) > 0 {
-			continue
+		//Users subscribe and write without the PubSub lock
+		user.mu.Lock()
+		subscribed, tombstone := len(user.Subscriptions) > 0, user.tombstone
+		//tombstone if not already tombstoned
+		if !subscribed && tombstone == "" {
+			user.tombstone = tombstoneDateString()
 		}
-		//check if they are already tombstoned
-		if user.tombstone == "" {
-			pubsub.Users[usr].tombstone = tombstoneDateString()
+		user.mu.Unlock()
+		if subscribed || tombstone == "" {
 			continue
 		}
 		//otherwise check if safe to delete
-		d, err := parseTombstoneDateString(user.tombstone)
+		d, err := parseTombstoneDateString(tombstone)
 		if err != nil {
 			return err
 		}
@@ -380,14 +347,13 @@ func (pubsub *PubSub) userTombstone(resurrectionOpportunity time.Duration) error
 }
 
 //metranome initiates regularly occurring activities
-// such as fullfilling push subscriptions, backing up
-// and garbage collection of messages
+// such as backing up and garbage collection of messages.
+// Push subscriptions are fulfilled by the PushDispatcher instead
 //
 //TODO: Errors need to be logged in kv-db and followed up to prevent errors going unchecked or panicking on non catastrophic errors
 func (pubsub *PubSub) metranome() {
 	//time intervals
 	sec := time.NewTicker(1 * time.Second)
-	milliSecs := time.NewTicker(80 * time.Millisecond)
 	min := time.NewTicker(1 * time.Second * 60)
 	//actions for each
 	go func() {
@@ -400,10 +366,6 @@ func (pubsub *PubSub) metranome() {
 
 			case <-sec.C:
 
-			case <-milliSecs.C:
-				if err := pubsub.PushWebhooks(); err != nil {
-					log.Println(err) //!Needs logging!
-				}
 			}
 		}
 	}()
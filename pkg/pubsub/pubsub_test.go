@@ -0,0 +1,176 @@
+package pubsub
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+//testPersist is a Persist layer that drops everything sent to it and restores nothing
+type testPersist struct {
+	*PersistCore
+}
+
+func newTestPersist(pubsub *PubSub) *testPersist {
+	return &testPersist{PersistCore: &PersistCore{
+		pubsub:            pubsub,
+		userWriter:        make(chan User),
+		userDeleter:       make(chan string),
+		subscriberWriter:  make(chan PersistSubscriberStruct),
+		subscriberDeleter: make(chan PersistSubscriberStruct),
+		messageWriter:     make(chan PersistMessageStruct),
+		messageDeleter:    make(chan PersistMessageStruct),
+		snapshotWriter:    make(chan Snapshot),
+		snapshotDeleter:   make(chan Snapshot),
+		accessWriter:      make(chan TopicAccess),
+		accessDeleter:     make(chan TopicAccess),
+	}}
+}
+
+func (persist *testPersist) Launch() error {
+	go func() {
+		for {
+			select {
+			case <-persist.userWriter:
+			case <-persist.userDeleter:
+			case <-persist.subscriberWriter:
+			case <-persist.subscriberDeleter:
+			case <-persist.messageWriter:
+			case <-persist.messageDeleter:
+			case <-persist.snapshotWriter:
+			case <-persist.snapshotDeleter:
+			case <-persist.accessWriter:
+			case <-persist.accessDeleter:
+			}
+		}
+	}()
+	return nil
+}
+
+func (persist *testPersist) Switchboard() PersistCore { return *persist.PersistCore }
+func (persist *testPersist) TidyUp() error            { return nil }
+func (persist *testPersist) WriteUser() error         { return nil }
+func (persist *testPersist) WriteSubscriber() error   { return nil }
+func (persist *testPersist) WriteMessage() error      { return nil }
+func (persist *testPersist) DeleteUser() error        { return nil }
+func (persist *testPersist) DeleteSubscriber() error  { return nil }
+func (persist *testPersist) DeleteMessage() error     { return nil }
+
+func (persist *testPersist) GetUser(string) (User, error) {
+	return User{}, fmt.Errorf("not stored")
+}
+
+func (persist *testPersist) GetSubscriber(string, int, string) (Subscriber, error) {
+	return Subscriber{}, fmt.Errorf("not stored")
+}
+
+func (persist *testPersist) GetMessage(int, string) (Message, error) {
+	return Message{}, fmt.Errorf("not stored")
+}
+
+func (persist *testPersist) StreamUsers() (chan Streamer, error)       { return closedStream(), nil }
+func (persist *testPersist) StreamSubscribers() (chan Streamer, error) { return closedStream(), nil }
+func (persist *testPersist) StreamMessages() (chan Streamer, error)    { return closedStream(), nil }
+
+func closedStream() chan Streamer {
+	stream := make(chan Streamer)
+	close(stream)
+	return stream
+}
+
+//newTestPubSub sets up a PubSub as getReady does but without a store, and the User
+// `creator` to create Topics with
+func newTestPubSub(t *testing.T) (*PubSub, *User) {
+	t.Helper()
+	pubsub := &PubSub{
+		Topics:    make(Topics),
+		Users:     make(Users),
+		mu:        &sync.RWMutex{},
+		sseDistro: SSENewDistro(16, SSEDropOldest),
+	}
+	pubsub.pushDispatcher = NewPushDispatcher(pubsub, 4)
+	t.Cleanup(func() { pubsub.pushDispatcher.Close() })
+	go pubsub.sseDistro.Routine()
+	persist := newTestPersist(pubsub)
+	persist.Launch()
+	pubsub.persistLayer = persist
+	creator, err := pubsub.GetUser("creator", "password")
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	return pubsub, creator
+}
+
+//writeMessages writes count Messages created at the given time to the Topic
+func writeMessages(t *testing.T, user *User, topic *Topic, count int, created time.Time) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		//AddCreatedDatestring always uses the current time
+		msg := Message{Data: fmt.Sprintf("message %d", i), Created: created.Format(time.RFC3339)}
+		if _, err := user.WriteToTopic(topic, msg); err != nil {
+			t.Fatalf("WriteToTopic() error = %v", err)
+		}
+	}
+}
+
+//TestTombstoneWithPushDispatcher runs Tombstone while push workers move their Subscribers.
+// Run with -race
+func TestTombstoneWithPushDispatcher(t *testing.T) {
+	pubsub, creator := newTestPubSub(t)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//echo the verification challenge and acknowledge pushes
+		io.WriteString(w, r.URL.Query().Get("hub.challenge"))
+	}))
+	defer endpoint.Close()
+
+	topic, err := pubsub.CreateTopic("orders", creator)
+	if err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	reader, err := pubsub.GetUser("reader", "password")
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	subscriber, err := reader.Subscribe(topic, SubscriptionOptions{PushURL: endpoint.URL})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	const count = 100
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i := 0; i < count; i++ {
+			//old enough for their Subscribers to be tombstoned
+			msg := Message{Data: fmt.Sprintf("message %d", i), Created: time.Now().Add(-time.Hour).Format(time.RFC3339)}
+			if _, err := creator.WriteToTopic(topic, msg); err != nil {
+				t.Errorf("WriteToTopic() error = %v", err)
+				return
+			}
+		}
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if err := pubsub.Tombstone(time.Minute, time.Hour); err != nil {
+			t.Fatalf("Tombstone() error = %v", err)
+		}
+		topic.mu.RLock()
+		position, ok := topic.subscriberPosition(subscriber)
+		topic.mu.RUnlock()
+		select {
+		case <-written:
+			if ok && position == count {
+				return
+			}
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("push subscriber reached position %d of %d", position, count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,4 @@
+//Package pubsubpb holds the Go stubs of the PubSub gRPC service, generated from pubsub.proto
+package pubsubpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pubsub.proto
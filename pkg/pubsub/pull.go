@@ -0,0 +1,188 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	//defaultPullMaxMessages is the number of messages a batch pull returns when max_messages is not given
+	defaultPullMaxMessages = 1
+	//maxPullMessages caps the number of messages returned by a batch pull
+	maxPullMessages = 1000
+	//maxPullWait caps how long a pull can wait for messages to arrive
+	maxPullWait = 30 * time.Second
+)
+
+//PullMessages leases up to maxMessages messages from the Consumer's Subscription pointer
+// position on the Topic. Leased messages are not handed out again until their lease expires,
+// after which they are redelivered unless acknowledged with Ack. Returns when the leases expire.
+//
+//Consumers of a shared Subscription are only handed messages not leased to the rest of the
+// group and, for Sticky Subscriptions, the keyed messages assigned to them. Messages the
+// Subscription's filter does not match are acknowledged as they are passed over.
+//
+//If there are no messages it waits up to wait for one to be written or a lease to expire,
+// returning an empty list if none become available in time. Waits are capped at 30 seconds
+func (user *User) PullMessages(ctx context.Context, topic *Topic, consumer Consumer, maxMessages int, wait time.Duration) ([]Message, time.Time, error) {
+	if maxMessages < 0 || wait < 0 {
+		return nil, time.Time{}, fmt.Errorf("max_messages and wait can not be negative")
+	}
+	if maxMessages == 0 {
+		maxMessages = defaultPullMaxMessages
+	}
+	if maxMessages > maxPullMessages {
+		maxMessages = maxPullMessages
+	}
+	if wait > maxPullWait {
+		wait = maxPullWait
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		topic.mu.Lock()
+		sub, position, err := topic.leaseSubscriber(user, consumer)
+		if err != nil {
+			topic.mu.Unlock()
+			return nil, time.Time{}, err
+		}
+		now := time.Now()
+		deadline := now.Add(sub.ackDeadline())
+		msgs := make([]Message, 0, maxMessages)
+		filtered := []int{}
+		for id := position; id < topic.PointerHead && len(msgs) < maxMessages; id++ {
+			msg, ok := topic.Messages[id]
+			if !ok || !sub.leases.available(id, now) {
+				continue
+			}
+			if !sub.matches(msg) {
+				filtered = append(filtered, id)
+				continue
+			}
+			if !sub.assigned(msg, consumer.Member) {
+				continue
+			}
+			sub.leases.lease(id, consumer.Member, deadline)
+			msgs = append(msgs, msg)
+		}
+		//messages the filter passes over are acknowledged without being handed out
+		topic.acknowledge(sub, position, filtered)
+		if len(msgs) > 0 {
+			topic.mu.Unlock()
+			return msgs, deadline, nil
+		}
+		//nothing yet so wait for the next write or lease expiry
+		arrival := topic.arrival()
+		next := sub.leases.nextExpiry(now)
+		topic.mu.Unlock()
+		if wait == 0 {
+			return msgs, time.Time{}, nil
+		}
+		if err := awaitPull(ctx, arrival, next, timeout.C); err != nil {
+			if err == errPullTimeout {
+				return msgs, time.Time{}, nil
+			}
+			return nil, time.Time{}, err
+		}
+	}
+}
+
+//errPullTimeout is returned by awaitPull when the pull wait is up
+var errPullTimeout = fmt.Errorf("pull wait timed out")
+
+//awaitPull blocks until a message arrives, the lease expiry time is reached (if not zero),
+// the timeout fires or the context is done
+func awaitPull(ctx context.Context, arrival <-chan struct{}, expiry time.Time, timeout <-chan time.Time) error {
+	var expired <-chan time.Time
+	if !expiry.IsZero() {
+		timer := time.NewTimer(time.Until(expiry))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-arrival:
+	case <-expired:
+	case <-timeout:
+		return errPullTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+//touchSubscription checks the Consumer can pull from the Topic and removes any tombstone
+// from its Subscription so it is kept alive while it is streamed. Returns the pointer position
+func (user *User) touchSubscription(topic *Topic, consumer Consumer) (int, error) {
+	topic.mu.Lock()
+	defer topic.mu.Unlock()
+	sub, position, err := topic.leaseSubscriber(user, consumer)
+	if err != nil {
+		return 0, err
+	}
+	return position, sub.removeTombstone()
+}
+
+//releaseStreamed releases the leases on Messages a subscription stream sent but that were not
+// acknowledged before it closed, so they are sent straight away when the client reconnects
+func (user *User) releaseStreamed(topic *Topic, consumer Consumer, messageIDs map[int]bool) {
+	topic.mu.Lock()
+	defer topic.mu.Unlock()
+	sub, position, err := topic.leaseSubscriber(user, consumer)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for id := range messageIDs {
+		if id < position || sub.leases.acked[id] || sub.leases.checkOwner(id, consumer.Member, now) != nil {
+			continue
+		}
+		delete(sub.leases.deadlines, id)
+		delete(sub.leases.owners, id)
+	}
+}
+
+//streamSubscription pulls the messages of the Consumer's Subscription from its pointer and
+// hands them to send until ctx is done or there is an error. Idle, if not nil, is called
+// whenever there was nothing to send for maxPullWait.
+//
+//The Subscription is kept from being garbage collected while it is streamed. Send is
+// responsible for acknowledging messages, and those not acknowledged by the time the
+// stream ends are released to be sent again
+func (user *User) streamSubscription(ctx context.Context, topic *Topic, consumer Consumer, send func([]Message) error, idle func() error) error {
+	streamed := make(map[int]bool)
+	defer func() {
+		user.releaseStreamed(topic, consumer, streamed)
+	}()
+	for {
+		//streaming keeps the subscription alive even while there is nothing to send
+		position, err := user.touchSubscription(topic, consumer)
+		if err != nil {
+			return err
+		}
+		for id := range streamed {
+			if id < position {
+				delete(streamed, id)
+			}
+		}
+		msgs, _, err := user.PullMessages(ctx, topic, consumer, sseSubscriptionBatch, maxPullWait)
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			if idle != nil {
+				if err := idle(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			streamed[msg.ID] = true
+		}
+		if err := send(msgs); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package pubsub
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//redisWriteTimeout is how long a client can take to accept a reply before it is disconnected
+	redisWriteTimeout = 10 * time.Second
+)
+
+//redisOutgoing is a reply queued for the client. Written is called once it has been written
+type redisOutgoing struct {
+	reply   []byte
+	written func()
+}
+
+//redisSession serves a Redis client connection. Channels are Topic names.
+//
+//Subscribed channels and patterns are sent Messages from the SSE fan-out as they are
+// written, so clients see Messages written over any protocol. As in Redis, Messages
+// written while a client is not subscribed are not sent to it
+type redisSession struct {
+	pubsub *PubSub
+	conn   net.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	out    chan redisOutgoing
+	//mu guards the user, channels and patterns
+	mu *sync.Mutex
+	//user is nil until the client sends AUTH. Anonymous clients can only subscribe to public Topics
+	user     *User
+	channels map[string]bool
+	patterns map[string]bool
+}
+
+//ServeRedis serves Redis clients connecting to the listener with the RESP2 publish and
+// subscribe commands. Only returns when the listener fails
+func (pubsub *PubSub) ServeRedis(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				log.Printf("error accepting Redis connection: %v\n", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go pubsub.serveRedis(conn)
+	}
+}
+
+//serveRedis runs the client connection until it is closed
+func (pubsub *PubSub) serveRedis(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &redisSession{
+		pubsub:   pubsub,
+		conn:     conn,
+		ctx:      ctx,
+		cancel:   cancel,
+		out:      make(chan redisOutgoing, pubsub.sseDistro.BufferSize),
+		mu:       &sync.Mutex{},
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+	}
+	defer cancel()
+	go session.writeLoop()
+	go session.streamLive()
+
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readRedisCommand(reader)
+		if err != nil {
+			if protocolErr, ok := err.(redisProtocolError); ok {
+				session.send(redisError("ERR " + protocolErr.Error()))
+				session.flush()
+			}
+			return
+		}
+		if !session.handle(args) {
+			session.flush()
+			return
+		}
+	}
+}
+
+//writeLoop writes queued replies to the client. The session is ended if a write fails
+func (session *redisSession) writeLoop() {
+	defer session.conn.Close()
+	for {
+		select {
+		case <-session.ctx.Done():
+			return
+		case outgoing := <-session.out:
+			session.conn.SetWriteDeadline(time.Now().Add(redisWriteTimeout))
+			if _, err := session.conn.Write(outgoing.reply); err != nil {
+				session.cancel()
+				return
+			}
+			if outgoing.written != nil {
+				outgoing.written()
+			}
+		}
+	}
+}
+
+//send queues the reply for the client, waiting while the queue is full.
+// Returns false if the session ended first
+func (session *redisSession) send(reply []byte) bool {
+	select {
+	case session.out <- redisOutgoing{reply: reply}:
+		return true
+	case <-session.ctx.Done():
+		return false
+	}
+}
+
+//flush waits for the queued replies to be written, or the session to end
+func (session *redisSession) flush() {
+	written := make(chan struct{})
+	select {
+	case session.out <- redisOutgoing{written: func() { close(written) }}:
+	case <-session.ctx.Done():
+		return
+	}
+	select {
+	case <-written:
+	case <-session.ctx.Done():
+	}
+}
+
+//subscribed is whether the client is subscribed to any channel or pattern. Subscribed
+// clients can only send the subscribe commands, PING and QUIT
+func (session *redisSession) subscribed() bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return len(session.channels)+len(session.patterns) > 0
+}
+
+//handle carries out the client's command. Returns false if the connection should be closed
+func (session *redisSession) handle(args [][]byte) bool {
+	command := strings.ToLower(string(args[0]))
+	params := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		params[i] = string(arg)
+	}
+	arity := map[string]int{"auth": 1, "publish": 2, "subscribe": 1, "psubscribe": 1}
+	if len(params) < arity[command] || (command == "publish" && len(params) != 2) {
+		return session.send(redisError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", command)))
+	}
+	switch command {
+	case "subscribe", "psubscribe", "unsubscribe", "punsubscribe", "ping", "quit":
+	default:
+		if session.subscribed() {
+			return session.send(redisError(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", command)))
+		}
+	}
+
+	switch command {
+	case "ping":
+		if session.subscribed() {
+			message := []byte{}
+			if len(params) > 0 {
+				message = args[1]
+			}
+			return session.send(redisArray(redisBulk([]byte("pong")), redisBulk(message)))
+		}
+		if len(params) > 0 {
+			return session.send(redisBulk(args[1]))
+		}
+		return session.send(redisSimple("PONG"))
+	case "quit":
+		session.send(redisSimple("OK"))
+		return false
+	case "auth":
+		return session.send(session.authenticate(params))
+	case "publish":
+		return session.send(session.publish(params[0], args[2]))
+	case "subscribe":
+		return session.subscribe("subscribe", params)
+	case "psubscribe":
+		return session.subscribe("psubscribe", params)
+	case "unsubscribe":
+		return session.unsubscribe("unsubscribe", params)
+	case "punsubscribe":
+		return session.unsubscribe("punsubscribe", params)
+	default:
+		return session.send(redisError(fmt.Sprintf("ERR unknown command '%s'", command)))
+	}
+}
+
+//authenticate logs the client in. `AUTH username password` logs in the User as the HTTP API
+// does and `AUTH token` the User of a token from `/users/user/token`
+func (session *redisSession) authenticate(params []string) []byte {
+	var user *User
+	var err error
+	switch len(params) {
+	case 1:
+		user, err = session.pubsub.TokenUser(params[0])
+	case 2:
+		user, err = session.pubsub.GetUser(params[0], params[1])
+	default:
+		return redisError("ERR syntax error")
+	}
+	if err != nil {
+		return redisError("WRONGPASS " + err.Error())
+	}
+	session.mu.Lock()
+	session.user = user
+	session.mu.Unlock()
+	return redisSimple("OK")
+}
+
+//publish writes the message to the channel's Topic, creating the Topic if needed as the
+// write endpoint does. Replies with the number of Subscriptions on the Topic
+func (session *redisSession) publish(channel string, payload []byte) []byte {
+	session.mu.Lock()
+	user := session.user
+	session.mu.Unlock()
+	if user == nil {
+		return redisError("NOAUTH Authentication required.")
+	}
+	topic, err := session.pubsub.GetTopic(channel, user)
+	if err != nil {
+		return redisError("ERR " + err.Error())
+	}
+	msg := Message{Data: string(payload)}
+	msg.AddCreatedDatestring(time.Now())
+	if _, err := user.WriteToTopic(topic, msg); err != nil {
+		return redisError("NOPERM " + err.Error())
+	}
+	topic.mu.RLock()
+	defer topic.mu.RUnlock()
+	count := 0
+	for _, subscribers := range topic.PointerPositions {
+		count += len(subscribers)
+	}
+	return redisInteger(count)
+}
+
+//subscribe adds the channels or patterns, confirming each with the number the client
+// is now subscribed to
+func (session *redisSession) subscribe(kind string, names []string) bool {
+	for _, name := range names {
+		session.mu.Lock()
+		user := session.user
+		session.mu.Unlock()
+		if kind == "subscribe" && !session.pubsub.streamable(name, user) {
+			if !session.send(redisError(fmt.Sprintf("NOPERM User can not read private Topic %s", name))) {
+				return false
+			}
+			continue
+		}
+		session.mu.Lock()
+		if kind == "subscribe" {
+			session.channels[name] = true
+		} else {
+			session.patterns[name] = true
+		}
+		count := len(session.channels) + len(session.patterns)
+		session.mu.Unlock()
+		if !session.send(redisArray(redisBulk([]byte(kind)), redisBulk([]byte(name)), redisInteger(count))) {
+			return false
+		}
+	}
+	return true
+}
+
+//unsubscribe removes the channels or patterns, or all of them if none are named, confirming
+// each with the number the client is still subscribed to
+func (session *redisSession) unsubscribe(kind string, names []string) bool {
+	session.mu.Lock()
+	subscriptions := session.channels
+	if kind == "punsubscribe" {
+		subscriptions = session.patterns
+	}
+	if len(names) == 0 {
+		for name := range subscriptions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	session.mu.Unlock()
+	if len(names) == 0 {
+		return session.send(redisArray(redisBulk([]byte(kind)), redisBulk(nil), redisInteger(0)))
+	}
+	for _, name := range names {
+		session.mu.Lock()
+		delete(subscriptions, name)
+		count := len(session.channels) + len(session.patterns)
+		session.mu.Unlock()
+		if !session.send(redisArray(redisBulk([]byte(kind)), redisBulk([]byte(name)), redisInteger(count))) {
+			return false
+		}
+	}
+	return true
+}
+
+//streamLive sends the Messages of the subscribed channels and patterns from the SSE fan-out
+// as they are written. A Message matching a channel and patterns is sent once for each
+func (session *redisSession) streamLive() {
+	clientName := RandomString(6)
+	receiver := make(chan SSEResponse, session.pubsub.sseDistro.BufferSize)
+	session.pubsub.sseDistro.Add <- SSEAddRequester{
+		ID:       clientName,
+		Receiver: receiver,
+		Match:    session.live,
+	}
+	defer func() {
+		session.pubsub.sseDistro.Cancel <- clientName
+	}()
+	for {
+		select {
+		case <-session.ctx.Done():
+			return
+		case item, ok := <-receiver:
+			//the SSEDistro closes the receiver if the client falls too far behind
+			if !ok {
+				log.Printf("Redis client %s fell behind and was disconnected\n", session.conn.RemoteAddr())
+				session.cancel()
+				return
+			}
+			if item.System != nil {
+				continue
+			}
+			session.mu.Lock()
+			user := session.user
+			channel := session.channels[item.TopicName]
+			patterns := []string{}
+			for pattern := range session.patterns {
+				if redisMatch(pattern, item.TopicName) {
+					patterns = append(patterns, pattern)
+				}
+			}
+			session.mu.Unlock()
+			if !session.pubsub.streamable(item.TopicName, user) {
+				continue
+			}
+			name, payload := redisBulk([]byte(item.TopicName)), redisBulk(item.Message.dataBytes())
+			if channel && !session.send(redisArray(redisBulk([]byte("message")), name, payload)) {
+				return
+			}
+			sort.Strings(patterns)
+			for _, pattern := range patterns {
+				if !session.send(redisArray(redisBulk([]byte("pmessage")), redisBulk([]byte(pattern)), name, payload)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+//live is whether the Topic's Messages should be sent to streamLive
+func (session *redisSession) live(topicName string) bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.channels[topicName] {
+		return true
+	}
+	for pattern := range session.patterns {
+		if redisMatch(pattern, topicName) {
+			return true
+		}
+	}
+	return false
+}
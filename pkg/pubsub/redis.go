@@ -0,0 +1,233 @@
+package pubsub
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	//redisMaxBulkSize caps the size of a bulk string read from a client
+	redisMaxBulkSize = 1 << 20
+	//redisMaxArgs caps the number of arguments of a command read from a client
+	redisMaxArgs = 1 << 16
+	//redisMaxPatternNesting caps the runs of stars a pattern is matched through, as Redis does
+	redisMaxPatternNesting = 1000
+)
+
+//redisProtocolError is returned when a client breaks RESP. The client is sent the error
+// and disconnected, as Redis does
+type redisProtocolError struct {
+	Reason string
+}
+
+func (err redisProtocolError) Error() string {
+	return "Protocol error: " + err.Reason
+}
+
+//readRedisCommand reads the next command from the client as its arguments. Commands are
+// RESP arrays of bulk strings, or inline commands of space separated words as typed into telnet
+func readRedisCommand(reader *bufio.Reader) ([][]byte, error) {
+	for {
+		line, err := readRedisLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "*") {
+			//empty inline commands are skipped as Redis does
+			if words := strings.Fields(line); len(words) > 0 {
+				args := make([][]byte, len(words))
+				for i, word := range words {
+					args[i] = []byte(word)
+				}
+				return args, nil
+			}
+			continue
+		}
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count > redisMaxArgs {
+			return nil, redisProtocolError{Reason: "invalid multibulk length"}
+		}
+		if count <= 0 {
+			continue
+		}
+		args := make([][]byte, count)
+		for i := range args {
+			line, err := readRedisLine(reader)
+			if err != nil {
+				return nil, err
+			}
+			if !strings.HasPrefix(line, "$") {
+				return nil, redisProtocolError{Reason: fmt.Sprintf("expected '$', got '%.1s'", line)}
+			}
+			length, err := strconv.Atoi(line[1:])
+			if err != nil || length < 0 || length > redisMaxBulkSize {
+				return nil, redisProtocolError{Reason: "invalid bulk length"}
+			}
+			//the bulk string is followed by CRLF
+			args[i] = make([]byte, length+2)
+			if _, err := io.ReadFull(reader, args[i]); err != nil {
+				return nil, err
+			}
+			if string(args[i][length:]) != "\r\n" {
+				return nil, redisProtocolError{Reason: "expected CRLF after bulk string"}
+			}
+			args[i] = args[i][:length]
+		}
+		return args, nil
+	}
+}
+
+//readRedisLine reads a CRLF terminated line, which is capped at redisMaxBulkSize
+func readRedisLine(reader *bufio.Reader) (string, error) {
+	line := []byte{}
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > redisMaxBulkSize {
+			return "", redisProtocolError{Reason: "too big inline request"}
+		}
+		if err == nil {
+			return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+		}
+		if err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+}
+
+//------------------------------------------- replies
+
+//redisSimple encodes a simple string reply
+func redisSimple(s string) []byte {
+	return []byte("+" + s + "\r\n")
+}
+
+//redisError encodes an error reply. Errors start with a code such as ERR
+func redisError(s string) []byte {
+	return []byte("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(s) + "\r\n")
+}
+
+//redisInteger encodes an integer reply
+func redisInteger(n int) []byte {
+	return []byte(":" + strconv.Itoa(n) + "\r\n")
+}
+
+//redisBulk encodes a bulk string reply. Nil is the null bulk string
+func redisBulk(b []byte) []byte {
+	if b == nil {
+		return []byte("$-1\r\n")
+	}
+	reply := make([]byte, 0, len(b)+16)
+	reply = append(reply, "$"+strconv.Itoa(len(b))+"\r\n"...)
+	reply = append(reply, b...)
+	return append(reply, "\r\n"...)
+}
+
+//redisArray encodes an array reply of the encoded items
+func redisArray(items ...[]byte) []byte {
+	reply := []byte("*" + strconv.Itoa(len(items)) + "\r\n")
+	for _, item := range items {
+		reply = append(reply, item...)
+	}
+	return reply
+}
+
+//------------------------------------------- patterns
+
+//redisMatch is whether the name matches the Redis glob pattern. `*` matches any sequence,
+// `?` any one character, `[abc]`, `[^abc]` and `[a-z]` sets of characters and `\` escapes
+func redisMatch(pattern, name string) bool {
+	skipLonger := false
+	return redisMatchFrom(pattern, name, 0, &skipLonger)
+}
+
+//redisMatchFrom matches the rest of the pattern against the rest of the name. Once the rest
+// after a star fails at every position, giving earlier stars longer matches can not help, so
+// skipLonger stops them trying and keeps patterns like `*a*a*a*b` from taking polynomial time
+func redisMatchFrom(pattern, name string, nesting int, skipLonger *bool) bool {
+	if nesting > redisMaxPatternNesting {
+		return false
+	}
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			//collapse runs of stars then try the rest of the pattern at every position
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if redisMatchFrom(pattern, name[i:], nesting+1, skipLonger) {
+					return true
+				}
+				if *skipLonger {
+					return false
+				}
+			}
+			*skipLonger = true
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		case '[':
+			if name == "" {
+				return false
+			}
+			end, matched := redisMatchSet(pattern, name[0])
+			if !matched {
+				return false
+			}
+			pattern, name = pattern[end:], name[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if name == "" || pattern[0] != name[0] {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		}
+	}
+	return name == ""
+}
+
+//redisMatchSet matches the character against the set starting the pattern. Returns the
+// length of the set in the pattern and whether the character is in it
+func redisMatchSet(pattern string, c byte) (int, bool) {
+	i := 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+	matched := false
+	for ; i < len(pattern) && pattern[i] != ']'; i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			matched = matched || pattern[i] == c
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			low, high := pattern[i], pattern[i+2]
+			if low > high {
+				low, high = high, low
+			}
+			matched = matched || (c >= low && c <= high)
+			i += 2
+		default:
+			matched = matched || pattern[i] == c
+		}
+	}
+	//an unclosed set runs to the end of the pattern, as in Redis
+	if i < len(pattern) {
+		i++
+	}
+	return i, matched != negate
+}
@@ -0,0 +1,92 @@
+package pubsub
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRedisCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "array", input: "*2\r\n$9\r\nSUBSCRIBE\r\n$6\r\norders\r\n", want: []string{"SUBSCRIBE", "orders"}},
+		{name: "binary safe bulk", input: "*1\r\n$4\r\na\r\nb\r\n", want: []string{"a\r\nb"}},
+		{name: "empty bulk", input: "*1\r\n$0\r\n\r\n", want: []string{""}},
+		{name: "empty arrays are skipped", input: "*0\r\n*-1\r\n*1\r\n$4\r\nPING\r\n", want: []string{"PING"}},
+		{name: "inline", input: "PUBLISH orders  hello\r\n", want: []string{"PUBLISH", "orders", "hello"}},
+		{name: "inline with bare newline", input: "PING\n", want: []string{"PING"}},
+		{name: "empty inline commands are skipped", input: "\r\n  \r\nPING\r\n", want: []string{"PING"}},
+		{name: "invalid multibulk length", input: "*x\r\n", wantErr: true},
+		{name: "too many arguments", input: "*70000\r\n", wantErr: true},
+		{name: "missing dollar", input: "*1\r\n:4\r\n", wantErr: true},
+		{name: "invalid bulk length", input: "*1\r\n$-1\r\n", wantErr: true},
+		{name: "bulk over the limit", input: "*1\r\n$2000000\r\n", wantErr: true},
+		{name: "missing CRLF after bulk", input: "*1\r\n$4\r\nPINGxx", wantErr: true},
+		{name: "truncated bulk", input: "*1\r\n$4\r\nPI", wantErr: true},
+		{name: "inline over the limit", input: strings.Repeat("a", redisMaxBulkSize+1) + "\r\n", wantErr: true},
+		{name: "end of input", input: "", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args, err := readRedisCommand(bufio.NewReader(strings.NewReader(test.input)))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("readRedisCommand() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			got := make([]string, len(args))
+			for i, arg := range args {
+				got[i] = string(arg)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("readRedisCommand() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRedisMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "orders", name: "orders", want: true},
+		{pattern: "orders", name: "order", want: false},
+		{pattern: "*", name: "", want: true},
+		{pattern: "order*", name: "orders.eu", want: true},
+		{pattern: "*.eu", name: "orders.eu", want: true},
+		{pattern: "*.eu", name: "orders.us", want: false},
+		{pattern: "o**s", name: "orders", want: true},
+		{pattern: "*a*b", name: "xaxxb", want: true},
+		{pattern: "*a*b", name: "xbxxa", want: false},
+		{pattern: "h?llo", name: "hello", want: true},
+		{pattern: "h?llo", name: "hllo", want: false},
+		{pattern: "h[ae]llo", name: "hallo", want: true},
+		{pattern: "h[ae]llo", name: "hillo", want: false},
+		{pattern: "h[^e]llo", name: "hallo", want: true},
+		{pattern: "h[^e]llo", name: "hello", want: false},
+		{pattern: "h[a-b]llo", name: "hbllo", want: true},
+		{pattern: "h[b-a]llo", name: "hbllo", want: true},
+		{pattern: "h[a-b]llo", name: "hcllo", want: false},
+		{pattern: "h[\\]]llo", name: "h]llo", want: true},
+		{pattern: "h[ab", name: "ha", want: true},
+		{pattern: "a\\*", name: "a*", want: true},
+		{pattern: "a\\*", name: "ab", want: false},
+		{pattern: "a\\", name: "a\\", want: true},
+		{pattern: strings.Repeat("*a", 30) + "*b", name: strings.Repeat("a", 5000), want: false},
+		{pattern: strings.Repeat("*a", 30) + "*b", name: strings.Repeat("a", 5000) + "b", want: true},
+		{pattern: strings.Repeat("a*", redisMaxPatternNesting+2), name: strings.Repeat("a", redisMaxPatternNesting+2), want: false},
+	}
+	for _, test := range tests {
+		if got := redisMatch(test.pattern, test.name); got != test.want {
+			t.Errorf("redisMatch(%.40q, %.40q) = %v, want %v", test.pattern, test.name, got, test.want)
+		}
+	}
+}
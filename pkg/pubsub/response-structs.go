@@ -28,6 +28,75 @@ type MessageResp struct {
 	Message Message `json:"message,omitempty"`
 }
 
+//BatchResp carries several Messages of a Topic. It is the response to batch pulls and
+// the body of a batched push request, where acknowledging it acknowledges every Message
+type BatchResp struct {
+	Error    string    `json:"error,omitempty"`
+	Topic    string    `json:"topic_id,omitempty"`
+	Messages []Message `json:"messages"`
+	//AckDeadline is when the leases of batch pulled messages expire
+	AckDeadline string `json:"ack_deadline,omitempty"`
+}
+
+//AckResp is the response form for acknowledgement requests on batch pulled messages
+type AckResp struct {
+	Error      string `json:"error,omitempty"`
+	Topic      string `json:"topic_id"`
+	MessageIDs []int  `json:"message_ids"`
+	Status     string `json:"status"`
+	//PointerPosition is the ID of the next message the subscription has not acknowledged. Given on ack
+	PointerPosition *int `json:"pointer_position,omitempty"`
+}
+
+//SnapshotResp is the response form for Snapshot orientated requests
+type SnapshotResp struct {
+	Error     string     `json:"error,omitempty"`
+	Topic     string     `json:"topic_name"`
+	Status    string     `json:"status"`
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+//TokenResp is the response form for User token requests
+type TokenResp struct {
+	Error   string `json:"error,omitempty"`
+	User    string `json:"user_id"`
+	Token   string `json:"token"`
+	Expires string `json:"expires"`
+}
+
+//AccessResp is the response form for Topic access requests
+type AccessResp struct {
+	Error   string `json:"error,omitempty"`
+	Topic   string `json:"topic_name"`
+	Private bool   `json:"private"`
+	//Readers is the number of Users granted read access. Usernames are not stored so can not be listed
+	Readers int `json:"readers"`
+}
+
+//SeekResp is the response form for seek requests
+type SeekResp struct {
+	Error  string `json:"error,omitempty"`
+	User   string `json:"user_id"`
+	Topic  string `json:"topic_name"`
+	Status string `json:"status"`
+	//Subscription is the name of the moved subscription. Empty for the User's default subscription
+	Subscription string `json:"subscription,omitempty"`
+	//PointerPosition is the ID of the next message to be delivered to the subscription
+	PointerPosition int `json:"pointer_position"`
+}
+
+//DeliveriesResp is the response form for a Subscription's push delivery history
+type DeliveriesResp struct {
+	Error string `json:"error,omitempty"`
+	User  string `json:"user_id"`
+	Topic string `json:"topic_name"`
+	//Subscription is the name of the subscription. Empty for the User's default subscription
+	Subscription string            `json:"subscription,omitempty"`
+	PushURL      string            `json:"webhook_url,omitempty"`
+	Status       string            `json:"status"`
+	Deliveries   []DeliveryAttempt `json:"deliveries"`
+}
+
 //TopicResp is the response form for Topic orientated requests
 type TopicResp struct {
 	Error       string `json:"error,omitempty"`
@@ -38,6 +107,8 @@ type TopicResp struct {
 	//CanWrite shows if requester User can write to the topic (userID
 	// matches topic.Creator.ID)
 	CanWrite bool `json:"writable"`
+	//Private topics can only be read by the creator and the users granted access
+	Private bool `json:"private"`
 }
 
 //SubscribeResp is the response form for Subscription orientated requests
@@ -49,6 +120,13 @@ type SubscribeResp struct {
 	//CanWrite shows if the requester User can write to the topic (userID
 	// matches topic.Creator.ID)
 	CanWrite bool `json:"writable"`
+	//Secret is the key push requests are signed with. Only given on subscribe
+	Secret string `json:"secret,omitempty"`
+	//Subscription is the name of the subscription. Consumer is given on join and leave of shared subscriptions
+	Subscription string `json:"subscription,omitempty"`
+	Consumer     string `json:"consumer,omitempty"`
+	//Filter is the subscription's message filter. Only given on subscribe
+	Filter string `json:"filter,omitempty"`
 }
 
 //------------------------------------------- Request Struct
@@ -60,10 +138,67 @@ type IncomingReq struct {
 	Topic    string `json:"topic,omitempty"`
 	//WebhookURL for push subscription to topic
 	WebhookURL string `json:"webhook_url,omitempty"`
+	//Secret used to sign push requests. Generated if not given for a push subscription
+	Secret string `json:"secret,omitempty"`
+	//DeadLetterTopic receives push messages that could not be delivered within MaxAttempts or MaxAge
+	DeadLetterTopic string `json:"dead_letter_topic,omitempty"`
+	MaxAttempts     int    `json:"max_attempts,omitempty"`
+	//MaxAge is a duration string such as "30m"
+	MaxAge string `json:"max_age,omitempty"`
+	//RetryMinBackoff and RetryMaxBackoff are duration strings bounding the wait between push retries
+	RetryMinBackoff string `json:"retry_min_backoff,omitempty"`
+	RetryMaxBackoff string `json:"retry_max_backoff,omitempty"`
+	//RetryMultiplier grows the wait after each failed push
+	RetryMultiplier float64 `json:"retry_multiplier,omitempty"`
+	//RetryJitter is the fraction (0 to 1) of each wait that is randomised
+	RetryJitter float64 `json:"retry_jitter,omitempty"`
+	//RetryStatusCodes are the status codes that acknowledge a push. Defaults to 200 and 201
+	RetryStatusCodes []int `json:"retry_status_codes,omitempty"`
+	//RetryAfter honours Retry-After headers from the webhook
+	RetryAfter bool `json:"retry_after,omitempty"`
+	//BatchMaxMessages and BatchMaxBytes cap the size of batched push requests
+	BatchMaxMessages int `json:"batch_max_messages,omitempty"`
+	BatchMaxBytes    int `json:"batch_max_bytes,omitempty"`
+	//BatchLinger is a duration string for how long to wait for a batch to fill
+	BatchLinger string `json:"batch_linger,omitempty"`
 	//Message used for writing messages to services
 	Message interface{} `json:"message,omitempty"`
 	//MessageID used for pulling messages from topics
 	MessageID int `json:"message_id,omitempty"`
+	//MaxMessages pulls up to this many messages from the subscription's pointer
+	MaxMessages int `json:"max_messages,omitempty"`
+	//Wait is a duration string for how long a pull waits for messages when there are none
+	Wait string `json:"wait,omitempty"`
+	//MessageIDs are the batch pulled messages to ack, nack or modify the deadline of
+	MessageIDs []int `json:"message_ids,omitempty"`
+	//Timestamp is an RFC3339 time to seek a subscription to
+	Timestamp string `json:"timestamp,omitempty"`
+	//Snapshot is the name of a snapshot to create, delete or seek a subscription to
+	Snapshot string `json:"snapshot,omitempty"`
+	//ExpireAfter is a duration string for how long a created snapshot lasts
+	ExpireAfter string `json:"expire_after,omitempty"`
+	//AckDeadline is a duration string. On subscribe it sets how long batch pulled messages are
+	// leased for. On modify_deadline it is the new lease from now
+	AckDeadline string `json:"ack_deadline,omitempty"`
+	//Subscription names one of the User's subscriptions to a topic. Empty for the default subscription
+	Subscription string `json:"subscription,omitempty"`
+	//Consumer names the consumer within a shared subscription
+	Consumer string `json:"consumer,omitempty"`
+	//Sticky keeps messages with the same key on one consumer of a shared subscription
+	Sticky bool `json:"sticky,omitempty"`
+	//Key is an optional key written with a message
+	Key string `json:"key,omitempty"`
+	//Attributes are optional labels written with a message. By URL query they are
+	// given as comma separated name=value pairs
+	Attributes map[string]string `json:"attributes,omitempty"`
+	//Filter is an expression picking the messages a subscription receives
+	Filter string `json:"filter,omitempty"`
+	//Private makes a topic readable only by its creator and the users granted access
+	Private *bool `json:"private,omitempty"`
+	//Grant and Revoke are usernames to give and take read access to a private topic.
+	// By URL query they are comma separated
+	Grant  []string `json:"grant,omitempty"`
+	Revoke []string `json:"revoke,omitempty"`
 }
 
 //------------------------------------------- interface
@@ -88,6 +223,41 @@ func (response MessageResp) toJSON() ([]byte, error) {
 	return json.MarshalIndent(response, " ", " ")
 }
 
+//toJSON marshalls the response object to JSON binary
+func (response BatchResp) toJSON() ([]byte, error) {
+	return json.MarshalIndent(response, " ", " ")
+}
+
+//toJSON marshalls the response object to JSON binary
+func (response DeliveriesResp) toJSON() ([]byte, error) {
+	return json.MarshalIndent(response, " ", " ")
+}
+
+//toJSON marshalls the response object to JSON binary
+func (response AckResp) toJSON() ([]byte, error) {
+	return json.MarshalIndent(response, " ", " ")
+}
+
+//toJSON marshalls the response object to JSON binary
+func (response SnapshotResp) toJSON() ([]byte, error) {
+	return json.MarshalIndent(response, " ", " ")
+}
+
+//toJSON marshalls the response object to JSON binary
+func (response TokenResp) toJSON() ([]byte, error) {
+	return json.MarshalIndent(response, " ", " ")
+}
+
+//toJSON marshalls the response object to JSON binary
+func (response AccessResp) toJSON() ([]byte, error) {
+	return json.MarshalIndent(response, " ", " ")
+}
+
+//toJSON marshalls the response object to JSON binary
+func (response SeekResp) toJSON() ([]byte, error) {
+	return json.MarshalIndent(response, " ", " ")
+}
+
 //toJSON marshalls the response object to JSON binary
 func (response TopicResp) toJSON() ([]byte, error) {
 	return json.MarshalIndent(response, " ", " ")
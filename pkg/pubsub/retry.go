@@ -0,0 +1,127 @@
+package pubsub
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//RetryPolicy controls how a push Subscription retries pushes that its endpoint does not acknowledge.
+//
+//Zero values are replaced by the defaults of DefaultRetryPolicy
+type RetryPolicy struct {
+	MinBackoff time.Duration //MinBackoff is the wait after the first failed push
+	MaxBackoff time.Duration //MaxBackoff caps the wait between push attempts
+	Multiplier float64       //Multiplier grows the wait after each consecutive failure
+	//Jitter is the fraction (0 to 1) of each wait that is randomised to spread out retries
+	Jitter float64
+	//AcceptedStatusCodes are the response status codes that acknowledge a push
+	AcceptedStatusCodes []int
+	//HonourRetryAfter waits for as long as a Retry-After response header asks, up to MaxBackoff
+	HonourRetryAfter bool
+}
+
+//DefaultRetryPolicy gives the policy used when a push Subscription does not set one:
+// starting at 80ms, doubling up to 1 hour, acknowledged by 200 or 201
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MinBackoff:          pushBackoffStart,
+		MaxBackoff:          pushBackoffCap,
+		Multiplier:          2,
+		AcceptedStatusCodes: []int{http.StatusOK, http.StatusCreated},
+	}
+}
+
+//withDefaults fills in any unset fields from DefaultRetryPolicy
+func (policy RetryPolicy) withDefaults() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	if policy.MinBackoff == 0 {
+		policy.MinBackoff = defaults.MinBackoff
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = defaults.MaxBackoff
+	}
+	if policy.MaxBackoff < policy.MinBackoff {
+		policy.MaxBackoff = policy.MinBackoff
+	}
+	if policy.Multiplier == 0 {
+		policy.Multiplier = defaults.Multiplier
+	}
+	if len(policy.AcceptedStatusCodes) == 0 {
+		policy.AcceptedStatusCodes = defaults.AcceptedStatusCodes
+	}
+	return policy
+}
+
+//validate checks the policy values are usable
+func (policy RetryPolicy) validate() error {
+	if policy.MinBackoff < 0 || policy.MaxBackoff < 0 {
+		return fmt.Errorf("retry backoff durations can not be negative")
+	}
+	if policy.MaxBackoff != 0 && policy.MaxBackoff < policy.MinBackoff {
+		return fmt.Errorf("retry_max_backoff must not be less than retry_min_backoff")
+	}
+	if policy.Multiplier != 0 && policy.Multiplier < 1 {
+		return fmt.Errorf("retry_multiplier must be at least 1")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return fmt.Errorf("retry_jitter must be between 0 and 1")
+	}
+	for _, code := range policy.AcceptedStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("%d is not an HTTP status code", code)
+		}
+	}
+	return nil
+}
+
+//accepts is whether the status code acknowledges a push
+func (policy RetryPolicy) accepts(statusCode int) bool {
+	for _, code := range policy.AcceptedStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+//next gives the backoff to use after another failure following the current backoff
+func (policy RetryPolicy) next(current time.Duration) time.Duration {
+	next := time.Duration(float64(current) * policy.Multiplier)
+	if next > policy.MaxBackoff || next < current { //guard against overflow
+		return policy.MaxBackoff
+	}
+	return next
+}
+
+//wait gives the time to sleep for the backoff with jitter applied.
+// A Retry-After wait from the endpoint is used instead if honoured
+func (policy RetryPolicy) wait(backoff, retryAfter time.Duration) time.Duration {
+	if policy.HonourRetryAfter && retryAfter > 0 {
+		if retryAfter > policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+		return retryAfter
+	}
+	if policy.Jitter > 0 {
+		spread := float64(backoff) * policy.Jitter
+		return backoff - time.Duration(spread) + time.Duration(rand.Float64()*2*spread)
+	}
+	return backoff
+}
+
+//parseRetryAfter reads a Retry-After header given in either seconds or as an HTTP date
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
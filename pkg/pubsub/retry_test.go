@@ -0,0 +1,99 @@
+package pubsub
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyNext(t *testing.T) {
+	policy := RetryPolicy{MinBackoff: time.Second, MaxBackoff: time.Minute, Multiplier: 3}.withDefaults()
+	tests := []struct {
+		current time.Duration
+		want    time.Duration
+	}{
+		{current: time.Second, want: 3 * time.Second},
+		{current: 9 * time.Second, want: 27 * time.Second},
+		{current: 27 * time.Second, want: time.Minute},
+		{current: time.Minute, want: time.Minute},
+		{current: time.Duration(1 << 62), want: time.Minute},
+	}
+	for _, test := range tests {
+		if got := policy.next(test.current); got != test.want {
+			t.Errorf("next(%s) = %s, want %s", test.current, got, test.want)
+		}
+	}
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     RetryPolicy
+		backoff    time.Duration
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{name: "backoff", policy: RetryPolicy{}, backoff: time.Second, min: time.Second, max: time.Second},
+		{name: "Retry-After not honoured", policy: RetryPolicy{}, backoff: time.Second, retryAfter: 5 * time.Second, min: time.Second, max: time.Second},
+		{name: "Retry-After honoured", policy: RetryPolicy{HonourRetryAfter: true}, backoff: time.Second, retryAfter: 5 * time.Second, min: 5 * time.Second, max: 5 * time.Second},
+		{name: "Retry-After capped", policy: RetryPolicy{HonourRetryAfter: true, MaxBackoff: 2 * time.Second}, backoff: time.Second, retryAfter: time.Hour, min: 2 * time.Second, max: 2 * time.Second},
+		{name: "Retry-After in the past", policy: RetryPolicy{HonourRetryAfter: true}, backoff: time.Second, retryAfter: -time.Second, min: time.Second, max: time.Second},
+		{name: "jitter", policy: RetryPolicy{Jitter: 0.5}, backoff: time.Second, min: 500 * time.Millisecond, max: 1500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		policy := test.policy.withDefaults()
+		for i := 0; i < 100; i++ {
+			if got := policy.wait(test.backoff, test.retryAfter); got < test.min || got > test.max {
+				t.Errorf("%s: wait(%s, %s) = %s, want between %s and %s", test.name, test.backoff, test.retryAfter, got, test.min, test.max)
+				break
+			}
+		}
+	}
+}
+
+func TestRetryPolicyWithDefaults(t *testing.T) {
+	got := RetryPolicy{MinBackoff: 2 * time.Hour}.withDefaults()
+	if got.MaxBackoff != 2*time.Hour {
+		t.Errorf("MaxBackoff = %s, want it raised to MinBackoff 2h0m0s", got.MaxBackoff)
+	}
+	if got.Multiplier != 2 || !got.accepts(http.StatusCreated) || got.accepts(http.StatusAccepted) {
+		t.Errorf("withDefaults() = %+v, want the DefaultRetryPolicy multiplier and status codes", got)
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	tests := []struct {
+		policy  RetryPolicy
+		wantErr bool
+	}{
+		{policy: RetryPolicy{}},
+		{policy: RetryPolicy{MinBackoff: time.Second, MaxBackoff: time.Minute, Multiplier: 1.5, Jitter: 1, AcceptedStatusCodes: []int{204}}},
+		{policy: RetryPolicy{MinBackoff: -time.Second}, wantErr: true},
+		{policy: RetryPolicy{MinBackoff: time.Minute, MaxBackoff: time.Second}, wantErr: true},
+		{policy: RetryPolicy{Multiplier: 0.5}, wantErr: true},
+		{policy: RetryPolicy{Jitter: 1.5}, wantErr: true},
+		{policy: RetryPolicy{AcceptedStatusCodes: []int{99}}, wantErr: true},
+	}
+	for _, test := range tests {
+		if err := test.policy.validate(); (err != nil) != test.wantErr {
+			t.Errorf("validate(%+v) error = %v, wantErr %v", test.policy, err, test.wantErr)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header   string
+		min, max time.Duration
+	}{
+		{header: "", min: 0, max: 0},
+		{header: "120", min: 2 * time.Minute, max: 2 * time.Minute},
+		{header: "soon", min: 0, max: 0},
+		{header: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), min: 59 * time.Minute, max: time.Hour},
+	}
+	for _, test := range tests {
+		if got := parseRetryAfter(test.header); got < test.min || got > test.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", test.header, got, test.min, test.max)
+		}
+	}
+}
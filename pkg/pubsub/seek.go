@@ -0,0 +1,83 @@
+package pubsub
+
+import (
+	"fmt"
+	"time"
+)
+
+//SeekToMessage moves the User's Subscription of the given name on the Topic so the
+// next message delivered is the one of the given ID. Seeking to the Topic's PointerHead skips
+// all existing messages. Only retained messages can be sought.
+//
+//Returns the new pointer position
+func (user *User) SeekToMessage(topic *Topic, name string, messageID int) (int, error) {
+	return user.seek(topic, name, func() (int, error) {
+		if _, ok := topic.Messages[messageID]; !ok && messageID != topic.PointerHead {
+			return 0, fmt.Errorf("message #%d is not retained - head point is %d so latest message is #%d", messageID, topic.PointerHead, topic.PointerHead-1)
+		}
+		return messageID, nil
+	})
+}
+
+//SeekToTime moves the User's Subscription of the given name on the Topic so the next message delivered
+// is the first created at or after the timestamp. If there is no such message the
+// Subscription is moved to the Topic's PointerHead to receive only new messages.
+//
+//Returns the new pointer position
+func (user *User) SeekToTime(topic *Topic, name string, timestamp time.Time) (int, error) {
+	return user.seek(topic, name, func() (int, error) {
+		oldest := topic.oldestRetained()
+		for id := oldest; id < topic.PointerHead; id++ {
+			msg, ok := topic.Messages[id]
+			if !ok {
+				continue
+			}
+			created, err := msg.GetCreatedDateTime()
+			if err != nil {
+				return 0, err
+			}
+			if created.Before(timestamp) {
+				continue
+			}
+			//garbage collected messages were created no later than the oldest so could only have
+			// matched if it was created after the timestamp
+			if id == oldest && oldest > 0 && created.After(timestamp) {
+				return 0, fmt.Errorf("messages from %s are no longer retained - oldest is #%d", timestamp.Format(time.RFC3339), oldest)
+			}
+			return id, nil
+		}
+		return topic.PointerHead, nil
+	})
+}
+
+//seek moves the User's Subscriber of the given name to the position given by locate and
+// persists the move. locate is called holding topic.mu
+func (user *User) seek(topic *Topic, name string, locate func() (int, error)) (int, error) {
+	topic.mu.Lock()
+	sub, from, ok := topic.findSubscriber(subscriptionKey(user.UUID, name))
+	if !ok {
+		topic.mu.Unlock()
+		return 0, fmt.Errorf("User not subscribed to Topic")
+	}
+	position, err := locate()
+	if err != nil {
+		topic.mu.Unlock()
+		return 0, err
+	}
+	topic.moveSubscriber(sub, from, position)
+	//outstanding leases belong to the old position
+	sub.leases.clear()
+	record := sub.record()
+	topic.mu.Unlock()
+
+	//restart any push deliveries from the new position
+	topic.dispatcher.Register(topic, sub)
+
+	user.persistLayer.Switchboard().subscriberWriter <- PersistSubscriberStruct{
+		Subscriber: record,
+		MessageID:  position,
+		TopicName:  topic.Name,
+		Move:       true,
+	}
+	return position, nil
+}
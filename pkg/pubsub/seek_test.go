@@ -0,0 +1,53 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeekToTime(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		//collected is the number of the oldest messages garbage collected before seeking
+		collected int
+		want      int
+		wantErr   bool
+	}{
+		{name: "before all messages", timestamp: base.Add(-time.Hour), want: 0},
+		{name: "at a message", timestamp: base.Add(time.Minute), want: 1},
+		{name: "between messages", timestamp: base.Add(90 * time.Second), want: 2},
+		{name: "after all messages", timestamp: base.Add(time.Hour), want: 4},
+		{name: "at the oldest retained", timestamp: base.Add(time.Minute), collected: 1, want: 1},
+		{name: "after the oldest retained", timestamp: base.Add(150 * time.Second), collected: 1, want: 3},
+		{name: "before the oldest retained", timestamp: base.Add(30 * time.Second), collected: 1, wantErr: true},
+		{name: "all collected", timestamp: base, collected: 4, want: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topic, reader := newPullTopic(t, 4, 0)
+			//a minute apart from base
+			for id, msg := range topic.Messages {
+				msg.Created = base.Add(time.Duration(id) * time.Minute).Format(time.RFC3339)
+				topic.Messages[id] = msg
+			}
+			for id := 0; id < test.collected; id++ {
+				delete(topic.Messages, id)
+			}
+			got, err := reader.SeekToTime(topic, "", test.timestamp)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("SeekToTime() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if got != test.want {
+				t.Errorf("SeekToTime() = %d, want %d", got, test.want)
+			}
+			if _, position, _ := topic.findSubscriber(reader.UUID); position != test.want {
+				t.Errorf("Subscriber position = %d, want %d", position, test.want)
+			}
+		})
+	}
+}
@@ -36,7 +36,7 @@ func CreateServer(port int, stype ServerType, mux *http.ServeMux) *http.Server {
 	if stype == ServerSSE {
 		server.WriteTimeout = 0 //disable timeout with zero if using for SSE to avoid closing connections between messages
 	} else if stype == ServerAPI {
-		server.WriteTimeout = 5 * time.Second
+		server.WriteTimeout = 5*time.Second + maxPullWait //leave room for long polling pulls
 	}
 
 	return server
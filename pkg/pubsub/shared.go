@@ -1,7 +1,9 @@
 package pubsub
 
 import (
+	crand "crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -85,6 +87,113 @@ func getHTTPData(req *http.Request) (IncomingReq, error) {
 			m.Topic = v[0]
 		case "webhook_url":
 			m.WebhookURL = v[0]
+		case "secret":
+			m.Secret = v[0]
+		case "dead_letter_topic":
+			m.DeadLetterTopic = v[0]
+		case "max_attempts":
+			m.MaxAttempts, err = strconv.Atoi(v[0])
+			if err != nil {
+				return IncomingReq{}, err
+			}
+		case "max_age":
+			m.MaxAge = v[0]
+		case "retry_min_backoff":
+			m.RetryMinBackoff = v[0]
+		case "retry_max_backoff":
+			m.RetryMaxBackoff = v[0]
+		case "retry_multiplier":
+			m.RetryMultiplier, err = strconv.ParseFloat(v[0], 64)
+			if err != nil {
+				return IncomingReq{}, err
+			}
+		case "retry_jitter":
+			m.RetryJitter, err = strconv.ParseFloat(v[0], 64)
+			if err != nil {
+				return IncomingReq{}, err
+			}
+		case "retry_status_codes":
+			m.RetryStatusCodes = nil
+			for _, code := range strings.Split(v[0], ",") {
+				c, err := strconv.Atoi(strings.TrimSpace(code))
+				if err != nil {
+					return IncomingReq{}, err
+				}
+				m.RetryStatusCodes = append(m.RetryStatusCodes, c)
+			}
+		case "retry_after":
+			m.RetryAfter, err = strconv.ParseBool(v[0])
+			if err != nil {
+				return IncomingReq{}, err
+			}
+		case "batch_max_messages":
+			m.BatchMaxMessages, err = strconv.Atoi(v[0])
+			if err != nil {
+				return IncomingReq{}, err
+			}
+		case "batch_max_bytes":
+			m.BatchMaxBytes, err = strconv.Atoi(v[0])
+			if err != nil {
+				return IncomingReq{}, err
+			}
+		case "batch_linger":
+			m.BatchLinger = v[0]
+		case "max_messages":
+			m.MaxMessages, err = strconv.Atoi(v[0])
+			if err != nil {
+				return IncomingReq{}, err
+			}
+		case "wait":
+			m.Wait = v[0]
+		case "timestamp":
+			m.Timestamp = v[0]
+		case "snapshot":
+			m.Snapshot = v[0]
+		case "expire_after":
+			m.ExpireAfter = v[0]
+		case "ack_deadline":
+			m.AckDeadline = v[0]
+		case "subscription":
+			m.Subscription = v[0]
+		case "consumer":
+			m.Consumer = v[0]
+		case "sticky":
+			m.Sticky, err = strconv.ParseBool(v[0])
+			if err != nil {
+				return IncomingReq{}, err
+			}
+		case "key":
+			m.Key = v[0]
+		case "attributes":
+			m.Attributes = make(map[string]string)
+			for _, pair := range strings.Split(v[0], ",") {
+				kv := strings.SplitN(pair, "=", 2)
+				if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+					return IncomingReq{}, fmt.Errorf("attributes must be name=value pairs: %q", pair)
+				}
+				m.Attributes[strings.TrimSpace(kv[0])] = kv[1]
+			}
+		case "filter":
+			m.Filter = v[0]
+		case "private":
+			private, err := strconv.ParseBool(v[0])
+			if err != nil {
+				return IncomingReq{}, err
+			}
+			m.Private = &private
+		case "grant":
+			m.Grant = strings.Split(v[0], ",")
+		case "revoke":
+			m.Revoke = strings.Split(v[0], ",")
+		case "message_ids":
+			m.MessageIDs = nil
+			for _, id := range strings.Split(v[0], ",") {
+				i, err := strconv.Atoi(strings.TrimSpace(id))
+				if err != nil {
+					return IncomingReq{}, err
+				}
+				m.MessageIDs = append(m.MessageIDs, i)
+			}
 		case "message_id":
 			m.MessageID, err = strconv.Atoi(v[0])
 			if err != nil {
@@ -95,6 +204,75 @@ func getHTTPData(req *http.Request) (IncomingReq, error) {
 	return m, nil
 }
 
+//subscriptionOptions collects the Subscription settings from the request
+func (payload IncomingReq) subscriptionOptions() (SubscriptionOptions, error) {
+	options := SubscriptionOptions{
+		Name:            payload.Subscription,
+		PushURL:         payload.WebhookURL,
+		Secret:          payload.Secret,
+		DeadLetterTopic: payload.DeadLetterTopic,
+		MaxAttempts:     payload.MaxAttempts,
+		//batching
+		BatchMaxMessages: payload.BatchMaxMessages,
+		BatchMaxBytes:    payload.BatchMaxBytes,
+		//consumer groups
+		Sticky: payload.Sticky,
+		//filtering
+		Filter: payload.Filter,
+	}
+	if payload.AckDeadline != "" {
+		deadline, err := time.ParseDuration(payload.AckDeadline)
+		if err != nil {
+			return SubscriptionOptions{}, fmt.Errorf("ack_deadline is not a valid duration: %v", err)
+		}
+		options.AckDeadline = deadline
+	}
+	if payload.BatchLinger != "" {
+		linger, err := time.ParseDuration(payload.BatchLinger)
+		if err != nil {
+			return SubscriptionOptions{}, fmt.Errorf("batch_linger is not a valid duration: %v", err)
+		}
+		options.BatchLinger = linger
+	}
+	if payload.MaxAge != "" {
+		maxAge, err := time.ParseDuration(payload.MaxAge)
+		if err != nil {
+			return SubscriptionOptions{}, fmt.Errorf("max_age is not a valid duration: %v", err)
+		}
+		options.MaxAge = maxAge
+	}
+	//retry policy
+	options.RetryPolicy = RetryPolicy{
+		Multiplier:          payload.RetryMultiplier,
+		Jitter:              payload.RetryJitter,
+		AcceptedStatusCodes: payload.RetryStatusCodes,
+		HonourRetryAfter:    payload.RetryAfter,
+	}
+	if payload.RetryMinBackoff != "" {
+		minBackoff, err := time.ParseDuration(payload.RetryMinBackoff)
+		if err != nil {
+			return SubscriptionOptions{}, fmt.Errorf("retry_min_backoff is not a valid duration: %v", err)
+		}
+		options.RetryPolicy.MinBackoff = minBackoff
+	}
+	if payload.RetryMaxBackoff != "" {
+		maxBackoff, err := time.ParseDuration(payload.RetryMaxBackoff)
+		if err != nil {
+			return SubscriptionOptions{}, fmt.Errorf("retry_max_backoff is not a valid duration: %v", err)
+		}
+		options.RetryPolicy.MaxBackoff = maxBackoff
+	}
+	return options, nil
+}
+
+//consumer gives who is pulling or acknowledging from the request
+func (payload IncomingReq) consumer() Consumer {
+	return Consumer{
+		Subscription: payload.Subscription,
+		Member:       payload.Consumer,
+	}
+}
+
 //HTTPErrorResponse responds correctly to http request
 // errors in the handler function
 func HTTPErrorResponse(err error, errType int, rw http.ResponseWriter) error {
@@ -185,6 +363,16 @@ func RandomString(n int) string {
 	return string(b)
 }
 
+//randomHex generates a cryptographically random hex string from the given number of bytes.
+// For secrets and IDs that must not be guessable
+func randomHex(byteLength int) (string, error) {
+	b := make([]byte, byteLength)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 //envarOrDefault pulls the environment variable for a variable name. If empty it returns the default value
 func envarOrDefault(environmentVariable string, defaultString string) string {
 	v, ok := os.LookupEnv(environmentVariable)
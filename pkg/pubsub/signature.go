@@ -0,0 +1,56 @@
+package pubsub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//HeaderSignature carries the HMAC-SHA256 signature of a push request as `sha256={hex digest}`
+	HeaderSignature = "X-PubSub-Signature"
+	//HeaderTimestamp carries the unix time in seconds at which a push request was signed
+	HeaderTimestamp = "X-PubSub-Timestamp"
+	//HeaderDelivery carries an ID unique to a message delivery. It is kept the same across retries of the same delivery
+	HeaderDelivery = "X-PubSub-Delivery"
+)
+
+//signPayload creates the HeaderSignature value for a push request body.
+//
+//The signed content is the timestamp and the body joined by a full stop so
+// that a captured body can not be replayed under a fresh timestamp
+func signPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//VerifySignature is a helper for Go webhook receivers to check a push request
+// came from PubSub. Pass in the subscription secret, the HeaderTimestamp and
+// HeaderSignature values and the raw request body.
+//
+//Requests signed longer ago than tolerance are rejected to limit replays. Receivers
+// should also reject HeaderDelivery IDs they have already processed
+func VerifySignature(secret, timestamp, signature string, body []byte, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %v", err)
+	}
+	signed := time.Unix(unix, 0)
+	if signed.Add(tolerance).Before(time.Now()) || signed.Add(-tolerance).After(time.Now()) {
+		return fmt.Errorf("timestamp outside of tolerance")
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		return fmt.Errorf("unsupported signature scheme")
+	}
+	if !hmac.Equal([]byte(signPayload(secret, timestamp, body)), []byte(signature)) {
+		return fmt.Errorf("signature does not match")
+	}
+	return nil
+}
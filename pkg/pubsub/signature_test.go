@@ -0,0 +1,37 @@
+package pubsub
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"id":0,"data":"hello"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		wantErr   bool
+	}{
+		{name: "valid", secret: "secret", timestamp: now, signature: signPayload("secret", now, body), body: body},
+		{name: "wrong secret", secret: "other", timestamp: now, signature: signPayload("secret", now, body), body: body, wantErr: true},
+		{name: "changed body", secret: "secret", timestamp: now, signature: signPayload("secret", now, body), body: []byte(`{}`), wantErr: true},
+		{name: "replayed under a fresh timestamp", secret: "secret", timestamp: now, signature: signPayload("secret", old, body), body: body, wantErr: true},
+		{name: "signed too long ago", secret: "secret", timestamp: old, signature: signPayload("secret", old, body), body: body, wantErr: true},
+		{name: "signed in the future", secret: "secret", timestamp: future, signature: signPayload("secret", future, body), body: body, wantErr: true},
+		{name: "invalid timestamp", secret: "secret", timestamp: "yesterday", signature: signPayload("secret", "yesterday", body), body: body, wantErr: true},
+		{name: "other scheme", secret: "secret", timestamp: now, signature: "sha1=" + signPayload("secret", now, body)[len("sha256="):], body: body, wantErr: true},
+	}
+	for _, test := range tests {
+		err := VerifySignature(test.secret, test.timestamp, test.signature, test.body, 5*time.Minute)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: VerifySignature() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
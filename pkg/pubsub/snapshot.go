@@ -0,0 +1,181 @@
+package pubsub
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	//defaultSnapshotExpiry is how long a Snapshot lasts when created without an expiry
+	defaultSnapshotExpiry = 7 * 24 * time.Hour
+	//maxSnapshotExpiry is the longest a Snapshot can last
+	maxSnapshotExpiry = 30 * 24 * time.Hour
+)
+
+//Snapshot is a named capture of a Subscription's pointer position on a Topic.
+// Any Subscription to the Topic can seek to it. Messages from the Snapshot's
+// position onwards are kept until the Snapshot expires or is deleted
+type Snapshot struct {
+	Name      string `json:"name"`
+	Topic     string `json:"topic_name"`
+	MessageID int    `json:"message_id"` //MessageID is the pointer position captured
+	Creator   string `json:"creator_id"` //Creator is the ID of the User that took the Snapshot
+	Created   string `json:"created"`
+	Expires   string `json:"expires"`
+	tombstone string //tombstone is set once expired - deleted after the resurrection opportunity
+}
+
+//expired is whether the Snapshot is past its expiry or tombstoned
+func (snapshot *Snapshot) expired() bool {
+	if snapshot.tombstone != "" {
+		return true
+	}
+	expires, err := time.Parse(time.RFC3339, snapshot.Expires)
+	return err != nil || !expires.After(time.Now())
+}
+
+//CreateSnapshot captures the position of the User's Subscription of the given subscription
+// name on the Topic under the given snapshot name. The name must not already be in use on the Topic
+func (user *User) CreateSnapshot(topic *Topic, subscription, name string, expireAfter time.Duration) (*Snapshot, error) {
+	if name == "" {
+		return nil, fmt.Errorf("snapshot name is required")
+	}
+	if expireAfter < 0 || expireAfter > maxSnapshotExpiry {
+		return nil, fmt.Errorf("expire_after must be between 0s and %s", maxSnapshotExpiry)
+	}
+	if expireAfter == 0 {
+		expireAfter = defaultSnapshotExpiry
+	}
+	topic.mu.Lock()
+	_, position, ok := topic.findSubscriber(subscriptionKey(user.UUID, subscription))
+	if !ok {
+		topic.mu.Unlock()
+		return nil, fmt.Errorf("User not subscribed to Topic")
+	}
+	if existing, ok := topic.Snapshots[name]; ok && !existing.expired() {
+		topic.mu.Unlock()
+		return nil, fmt.Errorf("snapshot %s already exists on topic %s", name, topic.Name)
+	}
+	now := time.Now()
+	snapshot := &Snapshot{
+		Name:      name,
+		Topic:     topic.Name,
+		MessageID: position,
+		Creator:   user.UUID,
+		Created:   now.Format(time.RFC3339),
+		Expires:   now.Add(expireAfter).Format(time.RFC3339),
+	}
+	topic.Snapshots[name] = snapshot
+	topic.mu.Unlock()
+
+	saveSnapshot(user.persistLayer, *snapshot)
+	return snapshot, nil
+}
+
+//saveSnapshot sends the Snapshot to be saved by the persist layer if it implements SnapshotPersist
+func saveSnapshot(persist Persist, snapshot Snapshot) {
+	if _, ok := persist.(SnapshotPersist); ok {
+		persist.Switchboard().snapshotWriter <- snapshot
+	}
+}
+
+//dropSnapshot sends the Snapshot to be deleted by the persist layer if it implements SnapshotPersist
+func dropSnapshot(persist Persist, snapshot Snapshot) {
+	if _, ok := persist.(SnapshotPersist); ok {
+		persist.Switchboard().snapshotDeleter <- snapshot
+	}
+}
+
+//ListSnapshots gives the unexpired Snapshots of the Topic
+func (topic *Topic) ListSnapshots() []Snapshot {
+	topic.mu.RLock()
+	defer topic.mu.RUnlock()
+	list := make([]Snapshot, 0, len(topic.Snapshots))
+	for _, snapshot := range topic.Snapshots {
+		if !snapshot.expired() {
+			list = append(list, *snapshot)
+		}
+	}
+	return list
+}
+
+//DeleteSnapshot removes the named Snapshot from the Topic, releasing the messages it kept.
+// Only the Snapshot or Topic creator can delete it
+func (user *User) DeleteSnapshot(topic *Topic, name string) error {
+	topic.mu.Lock()
+	snapshot, ok := topic.Snapshots[name]
+	if !ok {
+		topic.mu.Unlock()
+		return fmt.Errorf("snapshot %s does not exist on topic %s", name, topic.Name)
+	}
+	if snapshot.Creator != user.UUID && topic.Creator != user.UUID {
+		topic.mu.Unlock()
+		return fmt.Errorf("User does not have the authorisation to delete this snapshot")
+	}
+	delete(topic.Snapshots, name)
+	topic.mu.Unlock()
+
+	dropSnapshot(user.persistLayer, *snapshot)
+	return nil
+}
+
+//SeekToSnapshot moves the User's Subscription of the given subscription name on the Topic
+// to the position captured by the named Snapshot.
+//
+//Returns the new pointer position
+func (user *User) SeekToSnapshot(topic *Topic, subscription, name string) (int, error) {
+	return user.seek(topic, subscription, func() (int, error) {
+		snapshot, ok := topic.Snapshots[name]
+		if !ok || snapshot.expired() {
+			return 0, fmt.Errorf("snapshot %s does not exist on topic %s", name, topic.Name)
+		}
+		return snapshot.MessageID, nil
+	})
+}
+
+//pinned gives the lowest message ID kept by the Topic's unexpired Snapshots and whether there is one.
+// Caller must hold topic.mu
+func (topic *Topic) pinned() (int, bool) {
+	lowest, ok := 0, false
+	for _, snapshot := range topic.Snapshots {
+		if snapshot.expired() {
+			continue
+		}
+		if !ok || snapshot.MessageID < lowest {
+			lowest, ok = snapshot.MessageID, true
+		}
+	}
+	return lowest, ok
+}
+
+//snapshotTombstone used in tombstone for tombstoning expired Snapshots and deleting them after the resurrectionOpportunity
+func (pubsub *PubSub) snapshotTombstone(resurrectionOpportunity time.Duration) error {
+	for _, topic := range pubsub.Topics {
+		topic.mu.Lock()
+		for name, snapshot := range topic.Snapshots {
+			if !snapshot.expired() {
+				continue
+			}
+			if snapshot.tombstone == "" {
+				if err := snapshot.addTombstone(); err != nil {
+					topic.mu.Unlock()
+					return err
+				}
+				continue
+			}
+			tombstone, err := parseTombstoneDateString(snapshot.tombstone)
+			if err != nil {
+				topic.mu.Unlock()
+				return err
+			}
+			if isStale(tombstone, resurrectionOpportunity) {
+				delete(topic.Snapshots, name)
+				log.Printf("Deleted snapshot %s from topic %s\n", name, topic.Name)
+				dropSnapshot(pubsub.persistLayer, *snapshot)
+			}
+		}
+		topic.mu.Unlock()
+	}
+	return nil
+}
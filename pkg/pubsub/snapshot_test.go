@@ -0,0 +1,68 @@
+package pubsub
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMessageTombstoneKeepsSnapshotMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		//snapshots are the positions Snapshots are taken at before the Subscription moves to #3
+		snapshots []int
+		expired   bool
+		want      []int
+	}{
+		{name: "no snapshot", want: []int{3}},
+		{name: "snapshot", snapshots: []int{1}, want: []int{1, 2, 3}},
+		{name: "lowest of snapshots", snapshots: []int{2, 0}, want: []int{0, 1, 2, 3}},
+		{name: "snapshot at the subscription", snapshots: []int{3}, want: []int{3}},
+		{name: "expired snapshot", snapshots: []int{1}, expired: true, want: []int{3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pubsub, creator := newTestPubSub(t)
+			topic, err := pubsub.CreateTopic("orders", creator)
+			if err != nil {
+				t.Fatalf("CreateTopic() error = %v", err)
+			}
+			reader, err := pubsub.GetUser("reader", "password")
+			if err != nil {
+				t.Fatalf("GetUser() error = %v", err)
+			}
+			if _, err := reader.Subscribe(topic, SubscriptionOptions{}); err != nil {
+				t.Fatalf("Subscribe() error = %v", err)
+			}
+			writeMessages(t, creator, topic, 4, time.Now())
+			for i, position := range test.snapshots {
+				if _, err := reader.SeekToMessage(topic, "", position); err != nil {
+					t.Fatalf("SeekToMessage() error = %v", err)
+				}
+				snapshot, err := reader.CreateSnapshot(topic, "", string(rune('a'+i)), time.Hour)
+				if err != nil {
+					t.Fatalf("CreateSnapshot() error = %v", err)
+				}
+				if test.expired {
+					snapshot.Expires = time.Now().Add(-time.Minute).Format(time.RFC3339)
+				}
+			}
+			if _, err := reader.SeekToMessage(topic, "", 3); err != nil {
+				t.Fatalf("SeekToMessage() error = %v", err)
+			}
+			//a negative resurrection opportunity deletes messages as soon as they are tombstoned
+			if err := pubsub.messageTombstone(-time.Second); err != nil {
+				t.Fatalf("messageTombstone() error = %v", err)
+			}
+			got := []int{}
+			for id := range topic.Messages {
+				got = append(got, id)
+			}
+			sort.Ints(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("retained messages %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -4,30 +4,86 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-//SSEDistro is the object that fans out Messages to SSE requesting clients
+const (
+	//sseIntakeBuffer is how many Messages can queue for the SSEDistro before publishers wait on it
+	sseIntakeBuffer = 1024
+	//sseSubscriptionBatch is the most Messages a subscription stream pulls at a time
+	sseSubscriptionBatch = 100
+)
+
+//SSEAckMode is how a subscription stream acknowledges the Messages it sends
+type SSEAckMode string
+
+const (
+	//SSEAckAuto acknowledges Messages once they have been flushed to the client
+	SSEAckAuto SSEAckMode = "auto"
+	//SSEAckManual leaves the client to acknowledge Messages at `/sse/ack`. Messages not
+	// acknowledged within the Subscription's ack deadline are sent again
+	SSEAckManual SSEAckMode = "manual"
+)
+
+//SSEOverflowPolicy is what the SSEDistro does when a client's buffer is full
+type SSEOverflowPolicy string
+
+const (
+	//SSEDropOldest discards the oldest buffered Message to make room for the new one
+	SSEDropOldest SSEOverflowPolicy = "drop_oldest"
+	//SSEDisconnect closes the client's stream with an error event. Browsers reconnect and
+	// resume from their Last-Event-ID, so nothing retained is lost
+	SSEDisconnect SSEOverflowPolicy = "disconnect"
+)
+
+//SSEDistro is the object that fans out Messages to SSE requesting clients.
+//
+//Each client has a bounded buffer. The SSEDistro never waits on a client, so a stalled
+// browser can not hold up the Intake or the publishers writing to it. When a client's
+// buffer is full the Overflow policy is applied
 type SSEDistro struct {
 	//Intake is the incoming message chan that needs to be fanned out to the requesters
 	Intake chan SSEResponse
-	//Requesters has a clientID as key
-	Requesters map[string]chan SSEResponse
+	//Requesters indexes the client Receivers by topic name then clientID
+	Requesters map[string]map[string]chan SSEResponse
+	//clients holds the registered clients by clientID so they can be removed from Requesters
+	clients map[string]SSEAddRequester
+	//matchers holds the clients that pick their topics with Match by clientID
+	matchers map[string]SSEAddRequester
 	//Add channels is the communication of clients looking to be added o the Requesters map to receive live updates
 	Add chan SSEAddRequester
 	//Cancel receives ClientID and is used to identify clients that have closed connection and needs removing from Requesters map
 	Cancel chan string
+	//BufferSize is the capacity clients should give their Receiver
+	BufferSize int
+	//Overflow is applied when a client's Receiver is full
+	Overflow SSEOverflowPolicy
 }
 
-//SSEAddRequester is the struct sent to SSEDistro to add the client to the message updater. Used by mux to register itself for all message streams
+//SSEAddRequester is the struct sent to SSEDistro to add the client to the message updater. Used by mux to register itself for its topic streams
 type SSEAddRequester struct {
-	ID       string //randomstring hash
+	ID     string   //randomstring hash
+	Topics []string //Topics are the names of the topics streamed to the client
+	//Match, if set, is used in place of Topics to pick the topics streamed to the client.
+	// It is called from the SSEDistro's goroutine for every Message so must not block
+	Match func(topicName string) bool
+	//Receiver gets the client's Messages. Should be buffered to SSEDistro.BufferSize.
+	// It is closed if the client is disconnected for falling behind
 	Receiver chan SSEResponse
 }
 
 //SSEResponse is the object sent to the client and identifies which topic the message came from
 type SSEResponse struct {
-	TopicName string  `json:"topic_name,omitempty"`
-	Message   Message `json:"message"`
+	TopicName string   `json:"topic_name,omitempty"`
+	Message   *Message `json:"message,omitempty"`
+	//Event names the SSE event type. Empty for messages, which use the default `message` event
+	Event string `json:"-"`
+	//System is set instead of Message for system events
+	System *SystemEvent `json:"system,omitempty"`
 }
 
 //String implements stringer to allow for proper formatting for SSE
@@ -37,35 +93,217 @@ func (sse SSEResponse) String() string {
 		log.Panicln(err)
 	}
 	//set retry to every 2 seconds as standard
+	if sse.Event != "" {
+		return fmt.Sprintf("retry: 2000\nevent: %s\ndata: %s\n\n", sse.Event, string(marsh))
+	}
 	return fmt.Sprintf("retry: 2000\ndata: %s\n\n", string(marsh))
 }
 
-//SSENewDistro creates a new SSEDistro
-func SSENewDistro() SSEDistro {
+//SSENewDistro creates a new SSEDistro giving clients buffers of bufferSize Messages
+func SSENewDistro(bufferSize int, overflow SSEOverflowPolicy) SSEDistro {
 	return SSEDistro{
-		Intake:     make(chan SSEResponse),
-		Requesters: make(map[string]chan SSEResponse),
+		Intake:     make(chan SSEResponse, sseIntakeBuffer),
+		Requesters: make(map[string]map[string]chan SSEResponse),
+		clients:    make(map[string]SSEAddRequester),
+		matchers:   make(map[string]SSEAddRequester),
 		Add:        make(chan SSEAddRequester),
 		Cancel:     make(chan string),
+		BufferSize: bufferSize,
+		Overflow:   overflow,
 	}
 }
 
 //Routine is the goroutine that fans out Messages to SSE connections and deals with new fanout receipiants and client removals
 //
-//Fans out ALL messages to SSE clients. Must be filtered at mux.
+//Messages only go to the clients streaming their topic, or whose Match picks it
 func (distro *SSEDistro) Routine() {
 	for {
 		select {
 		case client := <-distro.Add:
-			distro.Requesters[client.ID] = client.Receiver
+			distro.clients[client.ID] = client
+			if client.Match != nil {
+				distro.matchers[client.ID] = client
+				continue
+			}
+			for _, topicName := range client.Topics {
+				if _, ok := distro.Requesters[topicName]; !ok {
+					distro.Requesters[topicName] = make(map[string]chan SSEResponse)
+				}
+				distro.Requesters[topicName][client.ID] = client.Receiver
+			}
 
 		case msg := <-distro.Intake:
-			for _, client := range distro.Requesters {
-				client <- msg
+			for clientID, receiver := range distro.Requesters[msg.TopicName] {
+				distro.deliver(clientID, receiver, msg)
+			}
+			for clientID, client := range distro.matchers {
+				if client.Match(msg.TopicName) {
+					distro.deliver(clientID, client.Receiver, msg)
+				}
 			}
 
 		case toDelete := <-distro.Cancel:
-			delete(distro.Requesters, toDelete)
+			distro.remove(toDelete)
 		}
 	}
 }
+
+//deliver hands the Message to the client without waiting, applying the Overflow policy if
+// the client's buffer is full
+func (distro *SSEDistro) deliver(clientID string, receiver chan SSEResponse, msg SSEResponse) {
+	select {
+	case receiver <- msg:
+		return
+	default:
+	}
+	switch distro.Overflow {
+	case SSEDropOldest:
+		//the SSEDistro is the only sender so room made here stays free for the new message
+		select {
+		case <-receiver:
+		default:
+		}
+		select {
+		case receiver <- msg:
+		default:
+		}
+	default:
+		log.Printf("SSE client %s fell behind and is being disconnected\n", clientID)
+		distro.remove(clientID)
+		close(receiver)
+	}
+}
+
+//remove takes the client out of the topic indexes
+func (distro *SSEDistro) remove(clientID string) {
+	client, ok := distro.clients[clientID]
+	if !ok {
+		return
+	}
+	delete(distro.clients, clientID)
+	delete(distro.matchers, clientID)
+	for _, topicName := range client.Topics {
+		delete(distro.Requesters[topicName], clientID)
+		if len(distro.Requesters[topicName]) == 0 {
+			delete(distro.Requesters, topicName)
+		}
+	}
+}
+
+//sseErrorEvent formats an `error` event to send to a client before closing its stream
+func sseErrorEvent(err error) string {
+	marsh, errMarshal := json.Marshal(map[string]string{"error": err.Error()})
+	if errMarshal != nil {
+		log.Panicln(errMarshal)
+	}
+	return fmt.Sprintf("event: error\ndata: %s\n\n", string(marsh))
+}
+
+//SSECursor holds the ID of the last Message sent to an SSE client from each Topic.
+//
+//It is sent as the SSE event ID so that the Last-Event-ID header of a reconnecting browser
+// tells the server where to resume each Topic of the stream
+type SSECursor map[string]int
+
+//String encodes the cursor as comma separated `topic:messageID` pairs, with the topic names
+// query escaped, in topic name order
+func (cursor SSECursor) String() string {
+	pairs := make([]string, 0, len(cursor))
+	for topicName, messageID := range cursor {
+		pairs = append(pairs, fmt.Sprintf("%s:%d", url.QueryEscape(topicName), messageID))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+//ParseSSECursor decodes an SSE event ID made by SSECursor.String. Malformed pairs are
+// skipped as browsers send back whatever ID they were last given
+func ParseSSECursor(eventID string) SSECursor {
+	cursor := make(SSECursor)
+	for _, pair := range strings.Split(eventID, ",") {
+		split := strings.LastIndex(pair, ":")
+		if split < 0 {
+			continue
+		}
+		topicName, err := url.QueryUnescape(pair[:split])
+		if err != nil {
+			continue
+		}
+		messageID, err := strconv.Atoi(pair[split+1:])
+		if err != nil {
+			continue
+		}
+		cursor[topicName] = messageID
+	}
+	return cursor
+}
+
+//sseBacklog gathers the retained Messages of the Topic to replay to an SSE client, in order.
+// These are the Messages after the cursor position for the Topic, or from the from
+// message ID if the cursor has none. Nothing is replayed if neither is set (from < 0)
+func (pubsub *PubSub) sseBacklog(topicName string, cursor SSECursor, from int) []SSEResponse {
+	if last, ok := cursor[topicName]; ok {
+		from = last + 1
+	}
+	if from < 0 {
+		return nil
+	}
+	topic, err := pubsub.FetchTopic(topicName, nil)
+	if err != nil {
+		return nil
+	}
+	topic.mu.RLock()
+	defer topic.mu.RUnlock()
+	backlog := []SSEResponse{}
+	for id := from; id < topic.PointerHead; id++ {
+		//skip messages that have been garbage collected
+		if message, ok := topic.Messages[id]; ok {
+			backlog = append(backlog, SSEResponse{TopicName: topicName, Message: &message})
+		}
+	}
+	return backlog
+}
+
+//sseAllowOrigin sets the CORS headers for an SSE request from the given Origin.
+// Returns false if the Origin is not one of PS_SSE_ORIGINS.
+//
+//Specific origins are echoed back with credentials allowed so browsers send the token
+// cookie. Requests without an Origin are not cross-origin and are always allowed
+func sseAllowOrigin(rw http.ResponseWriter, origin string) bool {
+	rw.Header().Set("Access-Control-Allow-Headers", "Content-Type, Last-Event-ID")
+	if sseOrigins["*"] {
+		rw.Header().Set("Access-Control-Allow-Origin", "*")
+		return true
+	}
+	rw.Header().Add("Vary", "Origin")
+	if origin == "" {
+		return true
+	}
+	if !originAllowed(origin) {
+		return false
+	}
+	rw.Header().Set("Access-Control-Allow-Origin", origin)
+	rw.Header().Set("Access-Control-Allow-Credentials", "true")
+	return true
+}
+
+//originAllowed is whether pages from the Origin can open SSE streams and WebSockets.
+// Requests without an Origin are not from a browser page and are always allowed
+func originAllowed(origin string) bool {
+	return origin == "" || sseOrigins["*"] || sseOrigins[origin]
+}
+
+//sseUser identifies the User of an SSE request from the token under the `token` url query
+// or the TokenCookie, as EventSource can not set headers. Returns nil if no token was sent
+func (pubsub *PubSub) sseUser(r *http.Request) (*User, error) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		if cookie, err := r.Cookie(TokenCookie); err == nil {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		return nil, nil
+	}
+	return pubsub.TokenUser(token)
+}
@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSSECursor(t *testing.T) {
+	tests := []struct {
+		eventID string
+		want    SSECursor
+	}{
+		{eventID: "", want: SSECursor{}},
+		{eventID: "orders:4", want: SSECursor{"orders": 4}},
+		{eventID: "orders:4,payments:0", want: SSECursor{"orders": 4, "payments": 0}},
+		{eventID: "sensors%2Fkitchen:2", want: SSECursor{"sensors/kitchen": 2}},
+		{eventID: "a%3Ab:7", want: SSECursor{"a:b": 7}},
+		{eventID: "orders:4,garbage,payments:x,%zz:1,lost:", want: SSECursor{"orders": 4}},
+		{eventID: "orders:1,orders:3", want: SSECursor{"orders": 3}},
+	}
+	for _, test := range tests {
+		if got := ParseSSECursor(test.eventID); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseSSECursor(%q) = %v, want %v", test.eventID, got, test.want)
+		}
+	}
+}
+
+func TestSSECursorRoundTrip(t *testing.T) {
+	cursor := SSECursor{"orders": 4, "sensors/kitchen": 2, "a:b,c": 7, "50% off": 0}
+	eventID := cursor.String()
+	if got := ParseSSECursor(eventID); !reflect.DeepEqual(got, cursor) {
+		t.Errorf("ParseSSECursor(%q) = %v, want %v", eventID, got, cursor)
+	}
+}
+
+//drainSSE gives the Message IDs buffered in the receiver and whether it was closed
+func drainSSE(receiver chan SSEResponse) ([]int, bool) {
+	ids := []int{}
+	for {
+		select {
+		case msg, ok := <-receiver:
+			if !ok {
+				return ids, true
+			}
+			ids = append(ids, msg.Message.ID)
+		default:
+			return ids, false
+		}
+	}
+}
+
+func TestSSEDistroOverflow(t *testing.T) {
+	tests := []struct {
+		overflow SSEOverflowPolicy
+		//want is the message IDs left buffered for the client
+		want       []int
+		wantClosed bool
+	}{
+		{overflow: SSEDropOldest, want: []int{2, 3}},
+		{overflow: SSEDisconnect, want: []int{0, 1}, wantClosed: true},
+	}
+	for _, test := range tests {
+		distro := SSENewDistro(2, test.overflow)
+		client := SSEAddRequester{ID: "client", Topics: []string{"orders"}, Receiver: make(chan SSEResponse, distro.BufferSize)}
+		distro.clients[client.ID] = client
+		distro.Requesters["orders"] = map[string]chan SSEResponse{client.ID: client.Receiver}
+		for id := 0; id < 4; id++ {
+			//a disconnected client is no longer delivered to
+			for clientID, receiver := range distro.Requesters["orders"] {
+				distro.deliver(clientID, receiver, SSEResponse{TopicName: "orders", Message: &Message{ID: id}})
+			}
+		}
+		got, closed := drainSSE(client.Receiver)
+		if !reflect.DeepEqual(got, test.want) || closed != test.wantClosed {
+			t.Errorf("%s: buffered %v closed %v, want %v closed %v", test.overflow, got, closed, test.want, test.wantClosed)
+		}
+		if _, ok := distro.clients[client.ID]; ok == test.wantClosed {
+			t.Errorf("%s: client registered = %v, want %v", test.overflow, ok, !test.wantClosed)
+		}
+		if _, ok := distro.Requesters["orders"]; ok == test.wantClosed {
+			t.Errorf("%s: topic index kept = %v, want %v", test.overflow, ok, !test.wantClosed)
+		}
+	}
+}
@@ -0,0 +1,592 @@
+package pubsub
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//stompConnectTimeout is how long a client has to send CONNECT once connected
+	stompConnectTimeout = 10 * time.Second
+	//stompWriteTimeout is how long a client can take to accept a frame before it is disconnected
+	stompWriteTimeout = 10 * time.Second
+	//stompHeartBeatInterval is the shortest heart-beat interval the server sends and expects
+	stompHeartBeatInterval = 10 * time.Second
+)
+
+//STOMP subscription ack modes
+const (
+	stompAckAuto             = "auto"
+	stompAckClient           = "client"
+	stompAckClientIndividual = "client-individual"
+)
+
+//stompReservedHeaders are the frame headers PubSub sets or reads itself. They are not copied
+// from SEND headers to Message attributes, nor from Message attributes to MESSAGE headers, so
+// an attribute can not pose as the ack or message-id of a frame
+var stompReservedHeaders = map[string]bool{
+	"destination":    true,
+	"subscription":   true,
+	"message-id":     true,
+	"ack":            true,
+	"content-type":   true,
+	"content-length": true,
+	"receipt":        true,
+	"transaction":    true,
+	"key":            true,
+}
+
+//stompSubscription is a SUBSCRIBE of a STOMP session
+type stompSubscription struct {
+	ID          string
+	Destination string
+	Ack         string
+	//consumer is the pull Subscription streamed in the client ack modes
+	consumer Consumer
+	topic    *Topic
+	cancel   context.CancelFunc
+}
+
+//stompPending is a Message sent in a client ack mode that is awaiting ACK or NACK
+type stompPending struct {
+	subscription *stompSubscription
+	messageID    int
+}
+
+//stompOutgoing is a frame queued for the client. Written is called once it has been written
+type stompOutgoing struct {
+	data    []byte
+	written func()
+}
+
+//stompSession serves a STOMP 1.2 client connection.
+//
+//Subscriptions with `ack:auto` are sent Messages from the SSE fan-out as they are written.
+// The client ack modes stream one of the User's pull Subscriptions from its pointer, which
+// only moves on when the client sends ACK. NACKed Messages are sent again
+type stompSession struct {
+	pubsub *PubSub
+	conn   net.Conn
+	user   *User
+	ctx    context.Context
+	cancel context.CancelFunc
+	out    chan stompOutgoing
+	//heartBeat is how often the server sends heart-beats. Zero if the client does not want them
+	heartBeat time.Duration
+	//streaming waits on the subscription streams
+	streaming *sync.WaitGroup
+	//mu guards the subscriptions, pending Messages and transactions
+	mu            *sync.Mutex
+	subscriptions map[string]*stompSubscription
+	//pending holds the Messages awaiting ACK or NACK by ack ID
+	pending map[int]stompPending
+	nextAck int
+	//transactions holds the SEND, ACK and NACK frames of the open transactions by name
+	transactions map[string][]stompFrame
+}
+
+//ServeSTOMP serves STOMP 1.2 clients connecting to the listener. Only returns when
+// the listener fails
+func (pubsub *PubSub) ServeSTOMP(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				log.Printf("error accepting STOMP connection: %v\n", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go pubsub.serveSTOMP(conn)
+	}
+}
+
+//serveSTOMP runs the client connection from CONNECT until it is closed
+func (pubsub *PubSub) serveSTOMP(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(stompConnectTimeout))
+	frame, err := readStompFrame(reader)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &stompSession{
+		pubsub:        pubsub,
+		conn:          conn,
+		ctx:           ctx,
+		cancel:        cancel,
+		out:           make(chan stompOutgoing, pubsub.sseDistro.BufferSize),
+		streaming:     &sync.WaitGroup{},
+		mu:            &sync.Mutex{},
+		subscriptions: make(map[string]*stompSubscription),
+		pending:       make(map[int]stompPending),
+		transactions:  make(map[string][]stompFrame),
+	}
+	defer session.end()
+	expect, err := session.connect(frame)
+	if err != nil {
+		//the writeLoop is not running yet so the ERROR is written straight to the connection
+		conn.SetWriteDeadline(time.Now().Add(stompWriteTimeout))
+		conn.Write(stompError(frame, err).bytes())
+		return
+	}
+	go session.writeLoop()
+
+	for {
+		//clients that send heart-beats must send something within twice their interval
+		if expect > 0 {
+			conn.SetReadDeadline(time.Now().Add(2 * expect))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+		frame, err := readStompFrame(reader)
+		if err != nil {
+			if session.ctx.Err() == nil && err != io.EOF {
+				session.fail(stompFrame{}, err)
+			}
+			return
+		}
+		if frame.Command == "DISCONNECT" {
+			session.receipt(frame)
+			session.flush()
+			return
+		}
+		if err := session.handle(frame); err != nil {
+			session.fail(frame, err)
+			return
+		}
+		session.receipt(frame)
+	}
+}
+
+//connect logs the client in and replies CONNECTED, which is written straight to the connection
+// ahead of the writeLoop. Returns how often the client will send heart-beats
+func (session *stompSession) connect(frame stompFrame) (time.Duration, error) {
+	if frame.Command != "CONNECT" && frame.Command != "STOMP" {
+		return 0, fmt.Errorf("expected CONNECT but got %s", frame.Command)
+	}
+	supported := false
+	for _, version := range strings.Split(frame.Headers["accept-version"], ",") {
+		if strings.TrimSpace(version) == "1.2" {
+			supported = true
+		}
+	}
+	if !supported {
+		return 0, fmt.Errorf("supported protocol versions are 1.2")
+	}
+	clientSends, clientWants, err := stompHeartBeat(frame.Headers["heart-beat"])
+	if err != nil {
+		return 0, err
+	}
+	if frame.Headers["login"] == "" || frame.Headers["passcode"] == "" {
+		return 0, fmt.Errorf("login and passcode headers are required")
+	}
+	user, err := session.pubsub.GetUser(frame.Headers["login"], frame.Headers["passcode"])
+	if err != nil {
+		return 0, err
+	}
+	session.user = user
+
+	//heart-beats go at the slower of the rate one side can manage and the other wants
+	interval := int(stompHeartBeatInterval / time.Millisecond)
+	var expect time.Duration
+	if clientSends > 0 {
+		expect = time.Duration(maxInt(clientSends, interval)) * time.Millisecond
+	}
+	if clientWants > 0 {
+		session.heartBeat = time.Duration(maxInt(clientWants, interval)) * time.Millisecond
+	}
+	connected := stompFrame{Command: "CONNECTED", Headers: map[string]string{
+		"version":    "1.2",
+		"heart-beat": fmt.Sprintf("%d,%d", interval, interval),
+		"server":     "PubSub",
+		"user-name":  frame.Headers["login"],
+	}}
+	session.conn.SetWriteDeadline(time.Now().Add(stompWriteTimeout))
+	if _, err := session.conn.Write(connected.bytes()); err != nil {
+		return 0, err
+	}
+	return expect, nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+//end stops the subscriptions and closes the connection. Messages that were not
+// acknowledged are released to be sent again
+func (session *stompSession) end() {
+	session.cancel()
+	session.streaming.Wait()
+	session.conn.Close()
+}
+
+//writeLoop writes queued frames to the client and a heart-beat every heartBeat interval.
+// The session is ended if a write fails
+func (session *stompSession) writeLoop() {
+	defer session.conn.Close()
+	var beat <-chan time.Time
+	if session.heartBeat > 0 {
+		ticker := time.NewTicker(session.heartBeat)
+		defer ticker.Stop()
+		beat = ticker.C
+	}
+	for {
+		outgoing := stompOutgoing{}
+		select {
+		case <-session.ctx.Done():
+			return
+		case <-beat:
+			outgoing.data = []byte("\n")
+		case outgoing = <-session.out:
+		}
+		session.conn.SetWriteDeadline(time.Now().Add(stompWriteTimeout))
+		if _, err := session.conn.Write(outgoing.data); err != nil {
+			session.cancel()
+			return
+		}
+		if outgoing.written != nil {
+			outgoing.written()
+		}
+	}
+}
+
+//send queues the frame for the client, waiting while the queue is full.
+// Returns false if the session ended first
+func (session *stompSession) send(frame stompFrame) bool {
+	select {
+	case session.out <- stompOutgoing{data: frame.bytes()}:
+		return true
+	case <-session.ctx.Done():
+		return false
+	}
+}
+
+//flush waits for the queued frames to be written, or the session to end
+func (session *stompSession) flush() {
+	written := make(chan struct{})
+	select {
+	case session.out <- stompOutgoing{written: func() { close(written) }}:
+	case <-session.ctx.Done():
+		return
+	}
+	select {
+	case <-written:
+	case <-session.ctx.Done():
+	}
+}
+
+//receipt confirms the frame if it asked for a receipt
+func (session *stompSession) receipt(frame stompFrame) {
+	if id, ok := frame.Headers["receipt"]; ok {
+		session.send(stompFrame{Command: "RECEIPT", Headers: map[string]string{"receipt-id": id}})
+	}
+}
+
+//stompError builds the ERROR frame about the client frame
+func stompError(frame stompFrame, err error) stompFrame {
+	errorFrame := stompFrame{Command: "ERROR", Headers: map[string]string{"message": err.Error()}}
+	if id, ok := frame.Headers["receipt"]; ok {
+		errorFrame.Headers["receipt-id"] = id
+	}
+	return errorFrame
+}
+
+//fail sends an ERROR frame about the client frame and ends the session, as STOMP
+// closes the connection after an ERROR
+func (session *stompSession) fail(frame stompFrame, err error) {
+	if session.send(stompError(frame, err)) {
+		session.flush()
+	}
+	session.cancel()
+}
+
+//handle carries out a frame from the client. Errors end the session
+func (session *stompSession) handle(frame stompFrame) error {
+	switch frame.Command {
+	case "SEND", "ACK", "NACK":
+		//frames of a transaction are held until it is committed
+		if name, ok := frame.Headers["transaction"]; ok {
+			session.mu.Lock()
+			defer session.mu.Unlock()
+			if _, ok := session.transactions[name]; !ok {
+				return fmt.Errorf("transaction %s has not begun", name)
+			}
+			session.transactions[name] = append(session.transactions[name], frame)
+			return nil
+		}
+		return session.execute(frame)
+	case "SUBSCRIBE":
+		return session.subscribe(frame)
+	case "UNSUBSCRIBE":
+		session.mu.Lock()
+		subscription, ok := session.subscriptions[frame.Headers["id"]]
+		delete(session.subscriptions, frame.Headers["id"])
+		session.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("there is no subscription with id %q", frame.Headers["id"])
+		}
+		subscription.cancel()
+		return nil
+	case "BEGIN", "COMMIT", "ABORT":
+		return session.transaction(frame)
+	case "CONNECT", "STOMP":
+		return fmt.Errorf("already connected")
+	default:
+		return fmt.Errorf("unknown command %s", frame.Command)
+	}
+}
+
+//transaction begins, commits or aborts the transaction named by the frame
+func (session *stompSession) transaction(frame stompFrame) error {
+	name := frame.Headers["transaction"]
+	if name == "" {
+		return fmt.Errorf("transaction header is required")
+	}
+	session.mu.Lock()
+	frames, ok := session.transactions[name]
+	if frame.Command == "BEGIN" {
+		session.transactions[name] = []stompFrame{}
+		session.mu.Unlock()
+		if ok {
+			return fmt.Errorf("transaction %s has already begun", name)
+		}
+		return nil
+	}
+	delete(session.transactions, name)
+	session.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("transaction %s has not begun", name)
+	}
+	if frame.Command == "ABORT" {
+		return nil
+	}
+	for _, held := range frames {
+		if err := session.execute(held); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//execute carries out a SEND, ACK or NACK frame
+func (session *stompSession) execute(frame stompFrame) error {
+	if frame.Command == "SEND" {
+		return session.publish(frame)
+	}
+	return session.acknowledge(frame)
+}
+
+//publish writes the frame body to the destination Topic, creating the Topic if needed as
+// the write endpoint does. Headers other than the standard ones become Message attributes
+// and the `key` header the Message key
+func (session *stompSession) publish(frame stompFrame) error {
+	destination := frame.Headers["destination"]
+	if destination == "" {
+		return fmt.Errorf("destination header is required")
+	}
+	topic, err := session.pubsub.GetTopic(destination, session.user)
+	if err != nil {
+		return err
+	}
+	msg := Message{Data: string(frame.Body), Key: frame.Headers["key"]}
+	for name, value := range frame.Headers {
+		if stompReservedHeaders[name] {
+			continue
+		}
+		if msg.Attributes == nil {
+			msg.Attributes = make(map[string]string)
+		}
+		msg.Attributes[name] = value
+	}
+	msg.AddCreatedDatestring(time.Now())
+	_, err = session.user.WriteToTopic(topic, msg)
+	return err
+}
+
+//subscribe starts sending the destination Topic's Messages to the client
+func (session *stompSession) subscribe(frame stompFrame) error {
+	subscription := &stompSubscription{
+		ID:          frame.Headers["id"],
+		Destination: frame.Headers["destination"],
+		Ack:         frame.Headers["ack"],
+	}
+	if subscription.ID == "" || subscription.Destination == "" {
+		return fmt.Errorf("id and destination headers are required")
+	}
+	if subscription.Ack == "" {
+		subscription.Ack = stompAckAuto
+	}
+	if subscription.Ack != stompAckAuto && subscription.Ack != stompAckClient && subscription.Ack != stompAckClientIndividual {
+		return fmt.Errorf("ack must be %s, %s or %s", stompAckAuto, stompAckClient, stompAckClientIndividual)
+	}
+	session.mu.Lock()
+	_, exists := session.subscriptions[subscription.ID]
+	session.mu.Unlock()
+	if exists {
+		return fmt.Errorf("subscription id %q is already in use", subscription.ID)
+	}
+
+	if subscription.Ack == stompAckAuto {
+		if !session.pubsub.streamable(subscription.Destination, session.user) {
+			return fmt.Errorf("User can not read private Topic %s", subscription.Destination)
+		}
+	} else {
+		//the client ack modes stream a pull Subscription, created at the head if needed
+		topic, err := session.pubsub.FetchTopic(subscription.Destination, session.user)
+		if err != nil {
+			return err
+		}
+		name, ok := frame.Headers["subscription"]
+		if !ok {
+			name = subscription.ID
+		}
+		subscription.topic = topic
+		subscription.consumer = Consumer{Subscription: name}
+		if _, err := session.user.touchSubscription(topic, subscription.consumer); err != nil {
+			if _, err := session.user.Subscribe(topic, SubscriptionOptions{Name: name}); err != nil {
+				return err
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(session.ctx)
+	subscription.cancel = cancel
+	session.mu.Lock()
+	session.subscriptions[subscription.ID] = subscription
+	session.mu.Unlock()
+	session.streaming.Add(1)
+	go func() {
+		defer session.streaming.Done()
+		if subscription.Ack == stompAckAuto {
+			session.streamLive(ctx, subscription)
+		} else {
+			session.streamSubscription(ctx, subscription)
+		}
+	}()
+	return nil
+}
+
+//message builds the MESSAGE frame of the Message sent for the subscription. The Message
+// key and attributes are sent as headers
+func (session *stompSession) message(subscription *stompSubscription, msg Message) stompFrame {
+	frame := stompFrame{Command: "MESSAGE", Headers: make(map[string]string), Body: msg.dataBytes()}
+	for name, value := range msg.Attributes {
+		if stompReservedHeaders[name] {
+			continue
+		}
+		frame.Headers[name] = value
+	}
+	if msg.Key != "" {
+		frame.Headers["key"] = msg.Key
+	}
+	if _, ok := msg.Data.(string); !ok && msg.Data != nil {
+		frame.Headers["content-type"] = "application/json"
+	}
+	frame.Headers["destination"] = subscription.Destination
+	frame.Headers["subscription"] = subscription.ID
+	frame.Headers["message-id"] = strconv.Itoa(msg.ID)
+	return frame
+}
+
+//streamLive sends the Topic's Messages from the SSE fan-out as they are written
+func (session *stompSession) streamLive(ctx context.Context, subscription *stompSubscription) {
+	clientName := RandomString(6)
+	receiver := make(chan SSEResponse, session.pubsub.sseDistro.BufferSize)
+	session.pubsub.sseDistro.Add <- SSEAddRequester{
+		ID:       clientName,
+		Topics:   []string{subscription.Destination},
+		Receiver: receiver,
+	}
+	defer func() {
+		session.pubsub.sseDistro.Cancel <- clientName
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item, ok := <-receiver:
+			//the SSEDistro closes the receiver if the client falls too far behind
+			if !ok {
+				session.fail(stompFrame{}, fmt.Errorf("subscription %s fell behind and was stopped", subscription.ID))
+				return
+			}
+			if !session.pubsub.streamable(subscription.Destination, session.user) {
+				session.fail(stompFrame{}, fmt.Errorf("read access to Topic %s was revoked", subscription.Destination))
+				return
+			}
+			if item.System != nil {
+				continue
+			}
+			if !session.send(session.message(subscription, *item.Message)) {
+				return
+			}
+		}
+	}
+}
+
+//streamSubscription sends the Messages of the subscription's pull Subscription from its
+// pointer. They are acknowledged when the client sends ACK
+func (session *stompSession) streamSubscription(ctx context.Context, subscription *stompSubscription) {
+	err := session.user.streamSubscription(ctx, subscription.topic, subscription.consumer, func(msgs []Message) error {
+		for _, msg := range msgs {
+			frame := session.message(subscription, msg)
+			session.mu.Lock()
+			session.nextAck++
+			session.pending[session.nextAck] = stompPending{subscription: subscription, messageID: msg.ID}
+			frame.Headers["ack"] = strconv.Itoa(session.nextAck)
+			session.mu.Unlock()
+			if !session.send(frame) {
+				return session.ctx.Err()
+			}
+		}
+		return nil
+	}, nil)
+	if ctx.Err() == nil {
+		session.fail(stompFrame{}, fmt.Errorf("subscription %s stopped: %v", subscription.ID, err))
+	}
+}
+
+//acknowledge carries out an ACK or NACK. In the `client` ack mode they apply to every
+// Message sent on the subscription up to the one acknowledged
+func (session *stompSession) acknowledge(frame stompFrame) error {
+	ackID, err := strconv.Atoi(frame.Headers["id"])
+	session.mu.Lock()
+	pending, ok := session.pending[ackID]
+	if err != nil || !ok {
+		session.mu.Unlock()
+		return fmt.Errorf("no message with ack id %q is awaiting acknowledgement", frame.Headers["id"])
+	}
+	messageIDs := []int{}
+	for id, other := range session.pending {
+		if id == ackID || (pending.subscription.Ack == stompAckClient && other.subscription == pending.subscription && id < ackID) {
+			messageIDs = append(messageIDs, other.messageID)
+			delete(session.pending, id)
+		}
+	}
+	session.mu.Unlock()
+
+	subscription := pending.subscription
+	if frame.Command == "NACK" {
+		err = session.user.Nack(subscription.topic, subscription.consumer, messageIDs)
+	} else {
+		_, err = session.user.Ack(subscription.topic, subscription.consumer, messageIDs)
+	}
+	if err != nil {
+		log.Printf("error acknowledging messages sent to STOMP subscription %s from Topic %s: %v\n", subscription.ID, subscription.topic.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package pubsub
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	//stompMaxFrameSize caps the headers and body of a frame read from a client
+	stompMaxFrameSize = 1 << 20
+)
+
+//stompFrame is a STOMP frame. Headers keep the first value of repeated headers, as STOMP 1.2 requires
+type stompFrame struct {
+	Command string
+	Headers map[string]string
+	Body    []byte
+}
+
+//stompHeaderEscaper and stompHeaderUnescaper apply the STOMP 1.2 header value escapes
+var (
+	stompHeaderEscaper   = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+	stompHeaderUnescaper = strings.NewReplacer("\\\\", "\\", "\\r", "\r", "\\n", "\n", "\\c", ":")
+)
+
+//readStompFrame reads the next frame from the client, skipping heart-beats. Header values
+// are unescaped except in CONNECT frames, as STOMP 1.2 requires
+func readStompFrame(reader *bufio.Reader) (stompFrame, error) {
+	frame := stompFrame{Headers: make(map[string]string)}
+	size := 0
+	//lines are read a buffer at a time so the limit applies before a long line is held in full
+	readLine := func() (string, error) {
+		line := []byte{}
+		for {
+			chunk, err := reader.ReadSlice('\n')
+			line = append(line, chunk...)
+			if size+len(line) > stompMaxFrameSize {
+				return "", fmt.Errorf("frame is over the %d byte limit", stompMaxFrameSize)
+			}
+			if err == nil {
+				break
+			}
+			if err != bufio.ErrBufferFull {
+				return "", err
+			}
+		}
+		size += len(line)
+		return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+	}
+	//empty lines between frames are heart-beats
+	for {
+		line, err := readLine()
+		if err != nil {
+			return frame, err
+		}
+		if line != "" {
+			frame.Command = line
+			break
+		}
+		size = 0
+	}
+	for {
+		line, err := readLine()
+		if err != nil {
+			return frame, err
+		}
+		if line == "" {
+			break
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return frame, fmt.Errorf("malformed header %q", line)
+		}
+		name, value := parts[0], parts[1]
+		if frame.Command != "CONNECT" && frame.Command != "STOMP" {
+			if name, err = unescapeStompHeader(name); err != nil {
+				return frame, err
+			}
+			if value, err = unescapeStompHeader(value); err != nil {
+				return frame, err
+			}
+		}
+		if _, ok := frame.Headers[name]; !ok {
+			frame.Headers[name] = value
+		}
+	}
+	//the body runs for content-length bytes if given, otherwise up to the NUL
+	if lengthHeader, ok := frame.Headers["content-length"]; ok {
+		length, err := strconv.Atoi(lengthHeader)
+		if err != nil || length < 0 {
+			return frame, fmt.Errorf("invalid content-length %q", lengthHeader)
+		}
+		if size+length > stompMaxFrameSize {
+			return frame, fmt.Errorf("frame is over the %d byte limit", stompMaxFrameSize)
+		}
+		frame.Body = make([]byte, length+1)
+		if _, err := io.ReadFull(reader, frame.Body); err != nil {
+			return frame, err
+		}
+		if frame.Body[length] != 0 {
+			return frame, fmt.Errorf("frame body is longer than its content-length")
+		}
+		frame.Body = frame.Body[:length]
+		return frame, nil
+	}
+	body := []byte{}
+	for {
+		chunk, err := reader.ReadSlice(0)
+		if err != nil && err != bufio.ErrBufferFull {
+			return frame, err
+		}
+		body = append(body, chunk...)
+		if size+len(body) > stompMaxFrameSize {
+			return frame, fmt.Errorf("frame is over the %d byte limit", stompMaxFrameSize)
+		}
+		if err == nil {
+			frame.Body = body[:len(body)-1]
+			return frame, nil
+		}
+	}
+}
+
+//unescapeStompHeader undoes the STOMP 1.2 header escapes, erroring on undefined escapes
+func unescapeStompHeader(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			continue
+		}
+		if i+1 == len(s) || !strings.ContainsRune(`\rnc`, rune(s[i+1])) {
+			return "", fmt.Errorf("undefined escape sequence in header %q", s)
+		}
+		i++
+	}
+	return stompHeaderUnescaper.Replace(s), nil
+}
+
+//bytes encodes the frame. The content-length header is set from the body. Header values
+// are escaped except in CONNECTED frames, as STOMP 1.2 requires
+func (frame stompFrame) bytes() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(frame.Command)
+	buf.WriteByte('\n')
+	names := make([]string, 0, len(frame.Headers))
+	for name := range frame.Headers {
+		if name != "content-length" {
+			names = append(names, name)
+		}
+	}
+	//headers are written in a fixed order to keep frames readable
+	sort.Strings(names)
+	for _, name := range names {
+		value := frame.Headers[name]
+		if frame.Command != "CONNECTED" {
+			name, value = stompHeaderEscaper.Replace(name), stompHeaderEscaper.Replace(value)
+		}
+		fmt.Fprintf(buf, "%s:%s\n", name, value)
+	}
+	if frame.Body != nil {
+		fmt.Fprintf(buf, "content-length:%d\n", len(frame.Body))
+	}
+	buf.WriteByte('\n')
+	buf.Write(frame.Body)
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
+
+//stompHeartBeat reads a heart-beat header of the two intervals in milliseconds
+func stompHeartBeat(header string) (int, int, error) {
+	if header == "" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(header, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid heart-beat %q", header)
+	}
+	first, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || first < 0 {
+		return 0, 0, fmt.Errorf("invalid heart-beat %q", header)
+	}
+	second, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || second < 0 {
+		return 0, 0, fmt.Errorf("invalid heart-beat %q", header)
+	}
+	return first, second, nil
+}
@@ -0,0 +1,118 @@
+package pubsub
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadStompFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    stompFrame
+		wantErr bool
+	}{
+		{
+			name:  "body up to the NUL",
+			input: "SEND\ndestination:orders\n\nhello\x00",
+			want:  stompFrame{Command: "SEND", Headers: map[string]string{"destination": "orders"}, Body: []byte("hello")},
+		},
+		{
+			name:  "heart-beats and carriage returns",
+			input: "\n\r\n\nSEND\r\ndestination:orders\r\n\r\nhi\x00",
+			want:  stompFrame{Command: "SEND", Headers: map[string]string{"destination": "orders"}, Body: []byte("hi")},
+		},
+		{
+			name:  "empty body",
+			input: "DISCONNECT\nreceipt:77\n\n\x00",
+			want:  stompFrame{Command: "DISCONNECT", Headers: map[string]string{"receipt": "77"}, Body: []byte{}},
+		},
+		{
+			name:  "content-length body can hold NUL",
+			input: "SEND\ncontent-length:3\n\na\x00b\x00",
+			want:  stompFrame{Command: "SEND", Headers: map[string]string{"content-length": "3"}, Body: []byte("a\x00b")},
+		},
+		{
+			name:  "escaped header",
+			input: "SEND\na\\cb:c\\\\d\\ne\\r\n\n\x00",
+			want:  stompFrame{Command: "SEND", Headers: map[string]string{"a:b": "c\\d\ne\r"}, Body: []byte{}},
+		},
+		{
+			name:  "CONNECT headers are not unescaped",
+			input: "CONNECT\npasscode:a\\cb\n\n\x00",
+			want:  stompFrame{Command: "CONNECT", Headers: map[string]string{"passcode": "a\\cb"}, Body: []byte{}},
+		},
+		{
+			name:  "first repeated header wins",
+			input: "SEND\nkey:first\nkey:second\n\n\x00",
+			want:  stompFrame{Command: "SEND", Headers: map[string]string{"key": "first"}, Body: []byte{}},
+		},
+		{
+			name:  "value can hold colons",
+			input: "CONNECT\nhost:a:b\n\n\x00",
+			want:  stompFrame{Command: "CONNECT", Headers: map[string]string{"host": "a:b"}, Body: []byte{}},
+		},
+		{name: "malformed header", input: "SEND\ndestination\n\n\x00", wantErr: true},
+		{name: "undefined escape", input: "SEND\nkey:a\\tb\n\n\x00", wantErr: true},
+		{name: "invalid content-length", input: "SEND\ncontent-length:-1\n\n\x00", wantErr: true},
+		{name: "body longer than content-length", input: "SEND\ncontent-length:1\n\nab\x00", wantErr: true},
+		{name: "content-length over the limit", input: "SEND\ncontent-length:2000000\n\n", wantErr: true},
+		{name: "header line over the limit", input: "SEND\nkey:" + strings.Repeat("a", stompMaxFrameSize) + "\n\n\x00", wantErr: true},
+		{name: "body over the limit", input: "SEND\n\n" + strings.Repeat("a", stompMaxFrameSize) + "\x00", wantErr: true},
+		{name: "missing NUL", input: "SEND\n\nhello", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := readStompFrame(bufio.NewReader(strings.NewReader(test.input)))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("readStompFrame() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("readStompFrame() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadStompFrameSequence(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("SEND\n\none\x00\n\nSEND\n\ntwo\x00"))
+	for _, want := range []string{"one", "two"} {
+		frame, err := readStompFrame(reader)
+		if err != nil {
+			t.Fatalf("readStompFrame() error = %v", err)
+		}
+		if string(frame.Body) != want {
+			t.Errorf("readStompFrame() body = %q, want %q", frame.Body, want)
+		}
+	}
+}
+
+func TestUnescapeStompHeader(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "plain", want: "plain"},
+		{input: "", want: ""},
+		{input: "a\\cb", want: "a:b"},
+		{input: "\\\\n", want: "\\n"},
+		{input: "line\\nbreak\\r", want: "line\nbreak\r"},
+		{input: "\\\\\\c", want: "\\:"},
+		{input: "a\\tb", wantErr: true},
+		{input: "trailing\\", wantErr: true},
+		{input: "\\C", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := unescapeStompHeader(test.input)
+		if (err != nil) != test.wantErr {
+			t.Errorf("unescapeStompHeader(%q) error = %v, wantErr %v", test.input, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("unescapeStompHeader(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package pubsub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//TokenCookie is the cookie a User's token is set under so browsers send it with SSE requests
+	TokenCookie = "pubsub_token"
+)
+
+//IssueToken creates a signed token identifying the User that lasts for the given duration.
+//
+//Tokens stand in for the username and password where they can not be sent, such as SSE
+// streams opened by a browser's EventSource. They are signed with PS_TOKEN_SECRET so
+// do not need to be stored, but can not be revoked before they expire other than by
+// changing the secret
+func (user *User) IssueToken(ttl time.Duration) (string, time.Time) {
+	expires := time.Now().Add(ttl)
+	payload := fmt.Sprintf("%s.%d", user.UsernameHash, expires.Unix())
+	return payload + "." + signToken(payload), expires
+}
+
+//TokenUser finds the User a token made by IssueToken was issued to.
+// Errors if the token is malformed, forged or expired
+func (pubsub *PubSub) TokenUser(token string) (*User, error) {
+	pieces := strings.Split(token, ".")
+	if len(pieces) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	payload := pieces[0] + "." + pieces[1]
+	if !hmac.Equal([]byte(signToken(payload)), []byte(pieces[2])) {
+		return nil, fmt.Errorf("invalid token")
+	}
+	expires, err := strconv.ParseInt(pieces[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+	if time.Unix(expires, 0).Before(time.Now()) {
+		return nil, fmt.Errorf("token has expired")
+	}
+	pubsub.mu.RLock()
+	defer pubsub.mu.RUnlock()
+	user, ok := pubsub.Users[pieces[0]]
+	if !ok {
+		return nil, fmt.Errorf("token User no longer exists")
+	}
+	return user, nil
+}
+
+//signToken gives the hex HMAC-SHA256 of the token payload under the token secret
+func signToken(payload string) string {
+	mac := hmac.New(sha256.New, tokenSecret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,44 @@
+package pubsub
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenUser(t *testing.T) {
+	defer func(secret []byte) { tokenSecret = secret }(tokenSecret)
+	tokenSecret = []byte("secret")
+	pubsub, creator := newTestPubSub(t)
+	valid, _ := creator.IssueToken(time.Hour)
+	expired, _ := creator.IssueToken(-time.Second)
+	pieces := strings.Split(valid, ".")
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: valid},
+		{name: "expired", token: expired, wantErr: true},
+		{name: "extended expiry", token: pieces[0] + ".9999999999." + pieces[2], wantErr: true},
+		{name: "other User", token: strings.Repeat("0", 64) + "." + pieces[1] + "." + pieces[2], wantErr: true},
+		{name: "malformed", token: pieces[0] + "." + pieces[1], wantErr: true},
+		{name: "empty", token: "", wantErr: true},
+	}
+	for _, test := range tests {
+		user, err := pubsub.TokenUser(test.token)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: TokenUser() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && user != creator {
+			t.Errorf("%s: TokenUser() = %v, want the issuing User", test.name, user)
+		}
+	}
+
+	//tokens signed under another secret are forged
+	tokenSecret = []byte("changed")
+	if _, err := pubsub.TokenUser(valid); err == nil {
+		t.Errorf("TokenUser() after the secret changed error = nil, want an error")
+	}
+}
@@ -70,6 +70,28 @@ func (message *Message) removeTombstone() error {
 	return nil
 }
 
+//addTombstone exists to implement tombstoner
+func (snapshot *Snapshot) addTombstone() error {
+	snapshot.tombstone = tombstoneDateString()
+	return nil
+}
+
+//removeTombstone exists to implement tombstoner
+func (snapshot *Snapshot) removeTombstone() error {
+	snapshot.tombstone = ""
+	return nil
+}
+
+//addTombstone exists to implement tombstoner
+func (access *TopicAccess) addTombstone() error {
+	return nil
+}
+
+//removeTombstone exists to implement tombstoner
+func (access *TopicAccess) removeTombstone() error {
+	return nil
+}
+
 //-------------------Helper functions
 
 //tombstoneDateString creates a formatted RFC3339 date
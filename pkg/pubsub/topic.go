@@ -0,0 +1,62 @@
+package pubsub
+
+//subscriberPosition finds the pointer position of the Subscriber on the Topic.
+// Caller must hold topic.mu
+func (topic *Topic) subscriberPosition(subscriber *Subscriber) (int, bool) {
+	for position, subscribers := range topic.PointerPositions {
+		if sub, ok := subscribers[subscriber.key()]; ok && sub == subscriber {
+			return position, true
+		}
+	}
+	return 0, false
+}
+
+//moveSubscriber moves the Subscriber between pointer positions.
+// Caller must hold topic.mu
+func (topic *Topic) moveSubscriber(subscriber *Subscriber, from, to int) {
+	if from == to {
+		return
+	}
+	if _, ok := topic.PointerPositions[to]; !ok {
+		topic.PointerPositions[to] = make(Subscribers)
+	}
+	topic.PointerPositions[to][subscriber.key()] = subscriber
+	delete(topic.PointerPositions[from], subscriber.key())
+	//leases behind the pointer are acknowledged
+	subscriber.leases.forget(to)
+}
+
+//findSubscriber finds the Subscriber of the given key on the Topic and its pointer position.
+// Caller must hold topic.mu
+func (topic *Topic) findSubscriber(key string) (*Subscriber, int, bool) {
+	for position, subscribers := range topic.PointerPositions {
+		if sub, ok := subscribers[key]; ok {
+			return sub, position, true
+		}
+	}
+	return nil, 0, false
+}
+
+//arrival gives a channel that is closed when the next message is written to the Topic.
+// Caller must hold topic.mu
+func (topic *Topic) arrival() <-chan struct{} {
+	return topic.arrivals
+}
+
+//announce wakes everything waiting on arrival. Caller must hold topic.mu for writing
+func (topic *Topic) announce() {
+	close(topic.arrivals)
+	topic.arrivals = make(chan struct{})
+}
+
+//oldestRetained gives the lowest message ID still held by the Topic or the PointerHead
+// if there are no messages. Caller must hold topic.mu
+func (topic *Topic) oldestRetained() int {
+	oldest := topic.PointerHead
+	for id := range topic.Messages {
+		if id < oldest {
+			oldest = id
+		}
+	}
+	return oldest
+}
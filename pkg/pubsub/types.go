@@ -14,6 +14,8 @@ type PubSub struct {
 	persistLayer Persist
 	//sseDistro is unit that supplies Server Sent Events to the mux frontend
 	sseDistro SSEDistro
+	//pushDispatcher runs the delivery workers for push Subscribers
+	pushDispatcher *PushDispatcher
 }
 
 //Topic is the setup for topics
@@ -27,6 +29,16 @@ type Topic struct {
 	tombstone        string //timestamp - deleted in 10 minutes
 	//sseOut is the channel ALL messages can be sent to to fan out to sse requests
 	sseOut chan SSEResponse
+	//dispatcher is woken on writes to deliver messages to push Subscribers
+	dispatcher *PushDispatcher
+	//arrivals is closed and replaced on every write to wake long polling pulls
+	arrivals chan struct{}
+	//Snapshots are the named captures of Subscription positions on the Topic
+	Snapshots map[string]*Snapshot
+	//Private Topics can only be read by the Creator and Readers. See TopicAccess
+	Private bool
+	//Readers holds the UsernameHash of the Users granted read access to a Private Topic
+	Readers map[string]bool
 }
 
 //Topics is a map of topics with key as topic name
@@ -34,25 +46,90 @@ type Topics map[string]*Topic
 
 //Subscriber is the setup of a subscriber to a topic
 type Subscriber struct {
-	ID              string //ID is the User.UUID
-	UsernameHash    string //UsernameHash is the User.UsernameHash to help access the user in Subscription based functions
-	PushURL         string //PushURL is the webhook URL to which to push messages
-	mu              *sync.RWMutex
-	tombstone       string        //tombstone is a timestamp - deleted in 10 minutes
-	lastpushAttempt time.Time     //lastpushAttempt is the last attempt to push the message via webhook
-	backoff         time.Duration //backoff duration to allow for exponential backoff
-	Creator         bool          //Creator is whether or not the subscriber is the creator. Used for `restore`
+	ID           string //ID is the User.UUID
+	Name         string //Name tells apart a User's Subscriptions to the same Topic. Keys the Subscriber together with ID
+	UsernameHash string //UsernameHash is the User.UsernameHash to help access the user in Subscription based functions
+	PushURL      string //PushURL is the webhook URL to which to push messages
+	Secret       string //Secret is the HMAC key used to sign push requests
+	mu           *sync.RWMutex
+	tombstone    string //tombstone is a timestamp - deleted in 10 minutes
+	Creator      bool   //Creator is whether or not the subscriber is the creator. Used for `restore`
+	//Status is SubscriptionPending until a push Subscriber's webhook is verified, then SubscriptionActive
+	Status string
+	//DeadLetterTopic is the name of the Topic undeliverable push messages are moved to
+	DeadLetterTopic string
+	MaxAttempts     int           //MaxAttempts is the number of failed pushes before a message is dead-lettered
+	MaxAge          time.Duration //MaxAge is how old a message can get while failing before it is dead-lettered
+	RetryPolicy     RetryPolicy   //RetryPolicy controls push retries. Zero fields use the DefaultRetryPolicy values
+	//BatchMaxMessages, BatchMaxBytes and BatchLinger opt a push Subscriber into
+	// batched delivery. See SubscriptionOptions
+	BatchMaxMessages int
+	BatchMaxBytes    int
+	BatchLinger      time.Duration
+	//AckDeadline is how long messages pulled in batches are leased for before redelivery
+	AckDeadline time.Duration
+	//deliveries holds the recent push attempts to PushURL. Not persisted
+	deliveries *deliveryHistory
+	//leases tracks unacknowledged batch pulled messages. Guarded by the Topic's mu. Not persisted
+	leases *leaseTable
+	//Shared Subscriptions spread their messages across the consumers in Members
+	// instead of delivering to the PushURL or pulling User. Members is guarded by the Topic's mu
+	Shared  bool
+	Members map[string]*GroupMember
+	//Sticky sends messages with the same Message.Key to the same consumer of a shared Subscription
+	Sticky bool
+	//Filter is the filter expression picking the messages the Subscriber receives. See Filter
+	Filter string
+	//filter is the parsed Filter. Messages it does not match are acknowledged without delivery. Not persisted
+	filter *Filter
+}
+
+//SubscriptionOptions are the settings a User can give when subscribing to a Topic
+type SubscriptionOptions struct {
+	//Name lets a User hold several Subscriptions to the same Topic. Empty for the User's default Subscription
+	Name string
+	//PushURL is the webhook URL for push subscriptions. Empty for pull subscriptions
+	PushURL string
+	//Secret signs push requests. One is generated for push subscriptions if empty
+	Secret string
+	//DeadLetterTopic receives push messages that exceed MaxAttempts or MaxAge.
+	// It must be created by the subscribing User
+	DeadLetterTopic string
+	MaxAttempts     int
+	MaxAge          time.Duration
+	//RetryPolicy controls how push requests are retried
+	RetryPolicy RetryPolicy
+	//Setting any of BatchMaxMessages, BatchMaxBytes or BatchLinger sends push messages
+	// in batches of up to BatchMaxMessages messages or BatchMaxBytes bytes, waiting up
+	// to BatchLinger for a partial batch to fill. Unset limits use the defaults
+	BatchMaxMessages int
+	BatchMaxBytes    int
+	BatchLinger      time.Duration
+	//AckDeadline is how long batch pulled messages are leased for before being redelivered
+	// unless acknowledged. Pull subscriptions only. Defaults to 10 seconds
+	AckDeadline time.Duration
+	//Sticky assigns messages of a shared Subscription to consumers by Message.Key
+	Sticky bool
+	//Filter only delivers the messages matching the filter expression. The rest are
+	// acknowledged as they reach the Subscription. See Filter for the syntax
+	Filter string
+	//filter is the parsed Filter, set by validate
+	filter *Filter
 }
 
 //Subscribers is a map of subscribers
-type Subscribers map[string]*Subscriber //Subscriber.ID against subscriber
+type Subscribers map[string]*Subscriber //Subscriber.key() against subscriber
 
 //Message is a single message structure
 type Message struct {
-	ID        int         `json:"id"` //sequence number
-	Data      interface{} `json:"data"`
-	Created   string      `json:"created"`
-	tombstone string      //timestamp - deleted in 10 minutes
+	ID      int         `json:"id"` //sequence number
+	Data    interface{} `json:"data"`
+	Created string      `json:"created"`
+	//Key is an optional publisher given key. Shared Subscriptions can use it to keep related messages on one consumer
+	Key string `json:"key,omitempty"`
+	//Attributes are optional publisher given labels that Subscriptions can filter on
+	Attributes map[string]string `json:"attributes,omitempty"`
+	tombstone  string            //timestamp - deleted in 10 minutes
 }
 
 //User is the struct of a user able to make a subscription
@@ -60,7 +137,7 @@ type User struct {
 	UUID          string //hash of Username+Password
 	UsernameHash  string
 	PasswordHash  string
-	Subscriptions map[string]string //Topic Names key against pushURL
+	Subscriptions map[string]string //Topic Names, with `%` and `:` escaped and suffixed with `:{name}` for named Subscriptions, key against pushURL
 	Created       string            //Created is date user was created
 	mu            *sync.RWMutex
 	tombstone     string //timestamp - deleted in 10 minutes
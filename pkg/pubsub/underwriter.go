@@ -40,8 +40,17 @@ func NewUnderwriter(pubsub *PubSub) (*Underwriter, error) {
 		if _, err := tx.CreateBucketIfNotExists([]byte("sub")); err != nil {
 			return nil
 		}
+		if _, err := tx.CreateBucketIfNotExists([]byte("snapshot")); err != nil {
+			return nil
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte("topic")); err != nil {
+			return nil
+		}
 		return nil
 	})
+	if err := migrateTopicNames(db); err != nil {
+		return nil, fmt.Errorf("error escaping topic names of the store: %v", err)
+	}
 	return &Underwriter{
 		db: db,
 		PersistCore: &PersistCore{
@@ -52,6 +61,10 @@ func NewUnderwriter(pubsub *PubSub) (*Underwriter, error) {
 			subscriberDeleter: make(chan PersistSubscriberStruct),
 			messageWriter:     make(chan PersistMessageStruct),
 			messageDeleter:    make(chan PersistMessageStruct),
+			snapshotWriter:    make(chan Snapshot),
+			snapshotDeleter:   make(chan Snapshot),
+			accessWriter:      make(chan TopicAccess),
+			accessDeleter:     make(chan TopicAccess),
 		},
 	}, nil
 }
@@ -88,6 +101,26 @@ func (uw *Underwriter) Launch() error {
 			log.Panicln(err)
 		}
 	}()
+	go func() {
+		if err := uw.WriteSnapshot(); err != nil {
+			log.Panicln(err)
+		}
+	}()
+	go func() {
+		if err := uw.DeleteSnapshot(); err != nil {
+			log.Panicln(err)
+		}
+	}()
+	go func() {
+		if err := uw.WriteTopicAccess(); err != nil {
+			log.Panicln(err)
+		}
+	}()
+	go func() {
+		if err := uw.DeleteTopicAccess(); err != nil {
+			log.Panicln(err)
+		}
+	}()
 	return nil
 }
 
@@ -142,7 +175,14 @@ func (uw *Underwriter) WriteSubscriber() error {
 		//Save to DB
 		if err := uw.db.Batch(func(tx *bolt.Tx) error {
 			b := tx.Bucket([]byte("sub"))
-			err := b.Put([]byte(fmt.Sprintf("%s/%d/%s", subscriberStruct.TopicName, subscriberStruct.MessageID, subscriberStruct.Subscriber.ID)), encSubscriber.Bytes())
+			key := []byte(fmt.Sprintf("%s/%d/%s", escapeTopicName(subscriberStruct.TopicName), subscriberStruct.MessageID, subscriberStruct.Subscriber.key()))
+			//clear the old position when moving
+			if subscriberStruct.Move {
+				if err := deleteSubscriberKeys(b, subscriberStruct.TopicName, subscriberStruct.Subscriber.key(), key); err != nil {
+					return err
+				}
+			}
+			err := b.Put(key, encSubscriber.Bytes())
 			return err
 		}); err != nil {
 			return err
@@ -155,7 +195,7 @@ func (uw *Underwriter) WriteSubscriber() error {
 func (uw *Underwriter) WriteMessage() error {
 	for messageStruct := range uw.messageWriter {
 		//store as file in `/store` directory
-		dirStructure := path.Join(persistToDirPath, "messages", messageStruct.TopicName)
+		dirStructure := path.Join(persistToDirPath, "messages", escapeTopicName(messageStruct.TopicName))
 		loc := path.Join(dirStructure, fmt.Sprintf("/%d.json", messageStruct.Message.ID))
 
 		if err := os.MkdirAll(dirStructure, 0766); err != nil {
@@ -177,6 +217,48 @@ func (uw *Underwriter) WriteMessage() error {
 	return nil
 }
 
+//WriteSnapshot adds a snapshot to the persistence layer
+func (uw *Underwriter) WriteSnapshot() error {
+	for snapshot := range uw.snapshotWriter {
+		//GOB encode snapshot
+		var encSnapshot bytes.Buffer
+		enc := gob.NewEncoder(&encSnapshot)
+		if err := enc.Encode(snapshot); err != nil {
+			return err
+		}
+		//Save to DB
+		if err := uw.db.Batch(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("snapshot"))
+			err := b.Put([]byte(fmt.Sprintf("%s/%s", escapeTopicName(snapshot.Topic), snapshot.Name)), encSnapshot.Bytes())
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//WriteTopicAccess adds the access settings of a Topic to the persistence layer
+func (uw *Underwriter) WriteTopicAccess() error {
+	for access := range uw.accessWriter {
+		//GOB encode access
+		var encAccess bytes.Buffer
+		enc := gob.NewEncoder(&encAccess)
+		if err := enc.Encode(access); err != nil {
+			return err
+		}
+		//Save to DB
+		if err := uw.db.Batch(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("topic"))
+			err := b.Put([]byte(access.Topic), encAccess.Bytes())
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 //GetUseret returns a single user by userID string
 // (Which is also UsernameHash of the user)
 func (uw *Underwriter) GetUser(userID string) (User, error) {
@@ -208,7 +290,7 @@ func (uw *Underwriter) GetSubscriber(subscriberID string, messageID int, topicNa
 	//get User
 	if err := uw.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("sub"))
-		encSub := b.Get([]byte(fmt.Sprintf("%s/%d/%s", topicName, messageID, subscriberID)))
+		encSub := b.Get([]byte(fmt.Sprintf("%s/%d/%s", escapeTopicName(topicName), messageID, subscriberID)))
 		//GOB decode user
 		dec := gob.NewDecoder(bytes.NewReader(encSub))
 		if err := dec.Decode(&decSubscriber); err != nil {
@@ -223,7 +305,7 @@ func (uw *Underwriter) GetSubscriber(subscriberID string, messageID int, topicNa
 
 //GetMessage returns a single message by messageID and topicName
 func (uw *Underwriter) GetMessage(messageID int, topicName string) (Message, error) {
-	file, err := os.Open(path.Join(persistToDirPath, fmt.Sprintf("%s/%d.json", topicName, messageID)))
+	file, err := os.Open(path.Join(persistToDirPath, fmt.Sprintf("%s/%d.json", escapeTopicName(topicName), messageID)))
 	if err != nil {
 		return Message{}, err
 	}
@@ -248,6 +330,18 @@ func (uw *Underwriter) StreamSubscribers() (chan Streamer, error) {
 	return uw.streamBucket(PersistSubscriber)
 }
 
+//StreamSnapshots returns a chan through which it streams all
+// Snapshots from the db
+func (uw *Underwriter) StreamSnapshots() (chan Streamer, error) {
+	return uw.streamBucket(PersistSnapshot)
+}
+
+//StreamTopicAccess returns a chan through which it streams the
+// TopicAccess of all non-public Topics from the db
+func (uw *Underwriter) StreamTopicAccess() (chan Streamer, error) {
+	return uw.streamBucket(PersistTopicAccess)
+}
+
 //StreamMessages returns a chan through which it streams all
 // Messages from the db
 func (uw *Underwriter) StreamMessages() (chan Streamer, error) {
@@ -255,7 +349,6 @@ func (uw *Underwriter) StreamMessages() (chan Streamer, error) {
 	go func() {
 		messageStreamer(path.Join(persistToDirPath, "messages"), streamer)
 		close(streamer)
-		streamer = nil
 	}()
 
 	return streamer, nil
@@ -284,26 +377,41 @@ func (uw *Underwriter) DeleteSubscriber() error {
 		if err := uw.db.Batch(func(tx *bolt.Tx) error {
 			b := tx.Bucket([]byte("sub"))
 			if subsc.MessageID >= 0 {
-				if err := b.Delete([]byte(fmt.Sprintf("%s/%d/%s", subsc.TopicName, subsc.MessageID, subsc.SubscriberID))); err != nil {
+				if err := b.Delete([]byte(fmt.Sprintf("%s/%d/%s", escapeTopicName(subsc.TopicName), subsc.MessageID, subsc.SubscriberID))); err != nil {
 					return fmt.Errorf("error issuing Subscriber Delete in BoltDB:%v", err)
 				}
 				return nil
 			}
-			c := b.Cursor()
-
 			//cycle through all messages in topic and delete matching subscriberID
-			prefix := []byte(fmt.Sprintf("%s/", subsc.TopicName))
-			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
-				//check suffix
-				if strings.HasSuffix(string(k), subsc.SubscriberID) {
-					if err := b.Delete(k); err != nil {
-						return fmt.Errorf("error doing delete of prefix/suffix match in Subscriber Delete in BoltDB :%v", err)
-					}
-				}
+			return deleteSubscriberKeys(b, subsc.TopicName, subsc.SubscriberID, nil)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			}
+//DeleteSnapshot accepts the Snapshot to delete by its topic and name
+func (uw *Underwriter) DeleteSnapshot() error {
+	for snapshot := range uw.snapshotDeleter {
+		if err := uw.db.Batch(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("snapshot"))
+			err := b.Delete([]byte(fmt.Sprintf("%s/%s", escapeTopicName(snapshot.Topic), snapshot.Name)))
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			return nil
+//DeleteTopicAccess accepts the TopicAccess to delete by its topic
+func (uw *Underwriter) DeleteTopicAccess() error {
+	for access := range uw.accessDeleter {
+		if err := uw.db.Batch(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("topic"))
+			err := b.Delete([]byte(access.Topic))
+			return err
 		}); err != nil {
 			return err
 		}
@@ -314,7 +422,7 @@ func (uw *Underwriter) DeleteSubscriber() error {
 //DeleteMessage accepts messageID and topicName
 func (uw *Underwriter) DeleteMessage() error {
 	for msg := range uw.messageDeleter {
-		if err := os.Remove(path.Join(persistToDirPath, fmt.Sprintf("messages/%s/%d.json", msg.TopicName, msg.MessageID))); err != nil {
+		if err := os.Remove(path.Join(persistToDirPath, fmt.Sprintf("messages/%s/%d.json", escapeTopicName(msg.TopicName), msg.MessageID))); err != nil {
 			if errors.Is(err, os.ErrNotExist) {
 				log.Printf("Error of type 'does not exist' when deleting message #%d from %s", msg.MessageID, msg.TopicName)
 				continue
@@ -327,6 +435,121 @@ func (uw *Underwriter) DeleteMessage() error {
 
 //-----------------------------------Helpers
 
+//migrateTopicNames moves the Subscriber keys and message files of stores written before Topic
+// names were escaped to the escaped Topic names. It runs once per store and is marked done
+// in the meta bucket
+func migrateTopicNames(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		if meta.Get([]byte("escapedTopicNames")) != nil {
+			return nil
+		}
+		b := tx.Bucket([]byte("sub"))
+		c := b.Cursor()
+		//collect first as writing while iterating can skip keys
+		oldKeys, newKeys, values := [][]byte{}, [][]byte{}, [][]byte{}
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			//TopicName/MessageID/SubscriberID where the unescaped TopicName can hold `/`
+			pieces := strings.Split(string(k), "/")
+			if len(pieces) < 3 {
+				continue
+			}
+			topicName := strings.Join(pieces[:len(pieces)-2], "/")
+			if escapeTopicName(topicName) == topicName {
+				continue
+			}
+			oldKeys = append(oldKeys, append([]byte{}, k...))
+			newKeys = append(newKeys, []byte(strings.Join(append([]string{escapeTopicName(topicName)}, pieces[len(pieces)-2:]...), "/")))
+			values = append(values, append([]byte{}, v...))
+		}
+		//delete all first as an escaped name can be the unescaped name of another Topic
+		for _, k := range oldKeys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		for i, k := range newKeys {
+			if err := b.Put(k, values[i]); err != nil {
+				return err
+			}
+		}
+		if err := migrateMessages(path.Join(persistToDirPath, "messages")); err != nil {
+			return err
+		}
+		return meta.Put([]byte("escapedTopicNames"), []byte(time.Now().Format(time.RFC3339)))
+	})
+}
+
+//migrateMessages moves the message files of the messages directory to directories of the
+// escaped Topic names. The unescaped directories are first moved aside, as an escaped name can
+// be the unescaped name of another Topic, and are picked up again if a move is interrupted
+func migrateMessages(messagesPath string) error {
+	unescapedPath := messagesPath + "-unescaped"
+	if _, err := os.Stat(unescapedPath); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(messagesPath, unescapedPath); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(messagesPath, 0766); err != nil {
+		return err
+	}
+	if err := migrateMessageDir(unescapedPath, messagesPath, ""); err != nil {
+		return err
+	}
+	return os.RemoveAll(unescapedPath)
+}
+
+//migrateMessageDir moves the message files of the unescaped topicName directory under from,
+// and of the directories below it, to the escaped Topic name directory under to
+func migrateMessageDir(from, to, topicName string) error {
+	files, err := os.ReadDir(path.Join(from, topicName))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		//unescaped Topic names holding `/` made nested directories
+		if file.IsDir() {
+			if err := migrateMessageDir(from, to, path.Join(topicName, file.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		if topicName == "" {
+			continue
+		}
+		if err := os.MkdirAll(path.Join(to, escapeTopicName(topicName)), 0766); err != nil {
+			return err
+		}
+		if err := os.Rename(path.Join(from, topicName, file.Name()), path.Join(to, escapeTopicName(topicName), file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//deleteSubscriberKeys deletes all keys of the subscriberID in the topic from the sub bucket except keep
+func deleteSubscriberKeys(b *bolt.Bucket, topicName, subscriberID string, keep []byte) error {
+	c := b.Cursor()
+	prefix := []byte(fmt.Sprintf("%s/", escapeTopicName(topicName)))
+	//collect first as deleting while iterating can skip keys
+	matches := [][]byte{}
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		//check suffix
+		if strings.HasSuffix(string(k), "/"+subscriberID) && !bytes.Equal(k, keep) {
+			matches = append(matches, append([]byte{}, k...))
+		}
+	}
+	for _, k := range matches {
+		if err := b.Delete(k); err != nil {
+			return fmt.Errorf("error doing delete of prefix/suffix match in Subscriber Delete in BoltDB :%v", err)
+		}
+	}
+	return nil
+}
+
 // messageStreamer is the recursive function used to walk messages in blob storage and stream them to the application
 func messageStreamer(basePath string, streamer chan Streamer) {
 	files, err := os.ReadDir(basePath)
@@ -381,8 +604,14 @@ func (uw Underwriter) streamBucket(streamType PersistUnit) (chan Streamer, error
 	case PersistSubscriber:
 		bucketName = "sub"
 		s.Unit = &Subscriber{}
+	case PersistSnapshot:
+		bucketName = "snapshot"
+		s.Unit = &Snapshot{}
+	case PersistTopicAccess:
+		bucketName = "topic"
+		s.Unit = &TopicAccess{}
 	default:
-		return nil, fmt.Errorf("streamType must be either PersistUser or PersistSubscriber")
+		return nil, fmt.Errorf("streamType must be either PersistUser, PersistSubscriber, PersistSnapshot or PersistTopicAccess")
 	}
 	go func(bucketName string) {
 		if err := uw.db.View(func(tx *bolt.Tx) error {
@@ -403,6 +632,18 @@ func (uw Underwriter) streamBucket(streamType PersistUnit) (chan Streamer, error
 						return err
 					}
 					s.Unit = usr
+				case *Snapshot:
+					snapshot := &Snapshot{}
+					if err := dec.Decode(snapshot); err != nil {
+						return err
+					}
+					s.Unit = snapshot
+				case *TopicAccess:
+					access := &TopicAccess{}
+					if err := dec.Decode(access); err != nil {
+						return err
+					}
+					s.Unit = access
 				}
 				s.Key = string(k)
 				streamer <- s
@@ -413,7 +654,6 @@ func (uw Underwriter) streamBucket(streamType PersistUnit) (chan Streamer, error
 			log.Println(err)
 		}
 		close(streamer)
-		streamer = nil
 	}(bucketName)
 	return streamer, nil
 }
@@ -0,0 +1,107 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+//writeBaselineStore writes a store the way it was written before Topic names were escaped.
+// Each Topic gets message 0 and a Subscriber of reader at it
+func writeBaselineStore(t *testing.T, reader *User, topicNames []string) {
+	t.Helper()
+	db, err := bolt.Open(path.Join(persistToDirPath, "underwriter.db"), 0766, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("bolt.Open() error = %v", err)
+	}
+	defer db.Close()
+	put := func(tx *bolt.Tx, bucket, key string, value interface{}) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		var enc bytes.Buffer
+		if err := gob.NewEncoder(&enc).Encode(value); err != nil {
+			return err
+		}
+		return b.Put([]byte(key), enc.Bytes())
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, topicName := range topicNames {
+			reader.Subscriptions[topicName] = ""
+			subscriber := Subscriber{ID: reader.UUID, UsernameHash: reader.UsernameHash, Status: SubscriptionActive}
+			if err := put(tx, "sub", topicName+"/0/"+reader.UUID, subscriber); err != nil {
+				return err
+			}
+		}
+		return put(tx, "user", reader.UsernameHash, *reader)
+	}); err != nil {
+		t.Fatalf("db.Update() error = %v", err)
+	}
+	for _, topicName := range topicNames {
+		dir := path.Join(persistToDirPath, "messages", topicName)
+		if err := os.MkdirAll(dir, 0766); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		content, err := json.Marshal(Message{ID: 0, Data: topicName, Created: time.Now().Format(time.RFC3339)})
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		if err := os.WriteFile(path.Join(dir, "0.json"), content, 0766); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+}
+
+func TestRestoreBaselineStore(t *testing.T) {
+	defer func(dir string) { persistToDirPath = dir }(persistToDirPath)
+	persistToDirPath = t.TempDir()
+	reader, err := createNewUser("reader", "password")
+	if err != nil {
+		t.Fatalf("createNewUser() error = %v", err)
+	}
+	topicNames := []string{"orders", "50%off", "a b", "what?", "a%20b", "sensors/kitchen"}
+	writeBaselineStore(t, reader, topicNames)
+
+	//restore twice as the second start must not escape the names again
+	for start := 1; start <= 2; start++ {
+		pubsub, _ := newTestPubSub(t)
+		uw, err := NewUnderwriter(pubsub)
+		if err != nil {
+			t.Fatalf("start %d: NewUnderwriter() error = %v", start, err)
+		}
+		if err := restore(pubsub, uw); err != nil {
+			uw.TidyUp()
+			t.Fatalf("start %d: restore() error = %v", start, err)
+		}
+		for _, topicName := range topicNames {
+			topic, ok := pubsub.Topics[topicName]
+			if !ok {
+				t.Errorf("start %d: Topic %q was not restored", start, topicName)
+				continue
+			}
+			if msg, ok := topic.Messages[0]; !ok || msg.Data != topicName {
+				t.Errorf("start %d: Topic %q message 0 = %v, want data %q", start, topicName, msg.Data, topicName)
+			}
+			if _, ok := topic.PointerPositions[0][reader.UUID]; !ok {
+				t.Errorf("start %d: Topic %q Subscriber was not restored", start, topicName)
+			}
+			if _, err := uw.GetSubscriber(reader.UUID, 0, topicName); err != nil {
+				t.Errorf("start %d: GetSubscriber(%q) error = %v", start, topicName, err)
+			}
+			if _, err := os.Stat(path.Join(persistToDirPath, "messages", escapeTopicName(topicName), "0.json")); err != nil {
+				t.Errorf("start %d: message file of %q was not moved: %v", start, topicName, err)
+			}
+		}
+		if len(pubsub.Topics) != len(topicNames) {
+			t.Errorf("start %d: restored %d Topics, want %d", start, len(pubsub.Topics), len(topicNames))
+		}
+		uw.TidyUp()
+	}
+}
@@ -7,35 +7,87 @@ import (
 )
 
 //Subscribe method subscribes the user to the given topic using
-// the given pushURL. If no pushURL, subscription is pull type
-// using the topic ID.
-func (user *User) Subscribe(topic *Topic, pushURL string) error {
-	//check pushURL is valid
+// the given options. If no PushURL, subscription is pull type
+// using the topic ID. Giving a Name in the options adds a named
+// Subscription alongside the User's others on the Topic.
+//
+//Returns the created Subscriber
+func (user *User) Subscribe(topic *Topic, options SubscriptionOptions) (*Subscriber, error) {
+	if !topic.CanRead(user) {
+		return nil, fmt.Errorf("User can not read private Topic %s", topic.Name)
+	}
+	if err := options.validate(topic, false); err != nil {
+		return nil, err
+	}
+	if options.Name != "" {
+		if err := checkName("subscription", options.Name); err != nil {
+			return nil, err
+		}
+	}
+	//push requests are always signed
+	if options.PushURL != "" && options.Secret == "" {
+		secret, err := randomHex(32)
+		if err != nil {
+			return nil, err
+		}
+		options.Secret = secret
+	}
 	//Create Subsriber Object
 	sub := &Subscriber{
 		ID:           user.UUID,
+		Name:         options.Name,
 		UsernameHash: user.UsernameHash,
-		PushURL:      pushURL,
+		PushURL:      options.PushURL,
+		Secret:       options.Secret,
 		mu:           &sync.RWMutex{},
-		backoff:      80 * time.Millisecond,
+		deliveries:   newDeliveryHistory(),
 		Creator:      topic.Creator == user.UUID,
+		Status:       SubscriptionActive,
+		//dead-lettering
+		DeadLetterTopic: options.DeadLetterTopic,
+		MaxAttempts:     options.MaxAttempts,
+		MaxAge:          options.MaxAge,
+		RetryPolicy:     options.RetryPolicy,
+		//batching
+		BatchMaxMessages: options.BatchMaxMessages,
+		BatchMaxBytes:    options.BatchMaxBytes,
+		BatchLinger:      options.BatchLinger,
+		//leasing
+		AckDeadline: options.AckDeadline,
+		//filtering
+		Filter: options.Filter,
+		filter: options.filter,
+	}
+
+	//push subscriptions wait on the webhook to confirm before activating
+	if sub.PushURL != "" {
+		sub.Status = SubscriptionPending
+	}
+
+	//shared Subscriptions are not replaced as their consumers would be lost
+	topic.mu.RLock()
+	existing, _, ok := topic.findSubscriber(sub.key())
+	topic.mu.RUnlock()
+	if ok && existing.Shared {
+		return nil, fmt.Errorf("subscription %s is shared - join it or unsubscribe first", options.Name)
 	}
 
 	//unsubscribe from topic first if already a subscriber.
 	//This will ensure there are no multiple subscriptions in // various pointer positions. Will also give consistent
 	// expected performance for Subscription to be at the
-	// head position from the last point at which it was called
-	if err := user.Unsubscribe(topic); err != nil {
-		return fmt.Errorf("error when unsubscribing before resubscribing: %v", err)
+	// head position from the last point at which it was called.
+	// The old persisted record is replaced by the Move write below
+	if err := user.detach(topic, options.Name); err != nil {
+		return nil, fmt.Errorf("error when unsubscribing before resubscribing: %v", err)
 	}
 
 	user.mu.Lock()
 	//add to User subscriber list
-	user.Subscriptions[topic.Name] = pushURL
+	user.Subscriptions[userSubscriptionKey(topic.Name, options.Name)] = options.PushURL
 	//remove any user tombstones
 	if err := user.removeTombstone(); err != nil {
 		user.mu.Unlock()
-		return err
+		return nil, err
 	}
 	user.mu.Unlock()
 
@@ -45,29 +97,54 @@ func (user *User) Subscribe(topic *Topic, pushURL string) error {
 	if _, ok := topic.PointerPositions[topic.PointerHead]; !ok {
 		topic.PointerPositions[topic.PointerHead] = make(Subscribers)
 	}
-	topic.PointerPositions[topic.PointerHead][sub.ID] = sub
+	topic.PointerPositions[topic.PointerHead][sub.key()] = sub
 	//remove any topic tombstones
 	if err := topic.removeTombstone(); err != nil {
 		topic.mu.Unlock()
-		return err
+		return nil, err
 	}
 	topic.mu.Unlock()
+	//start delivering if push subscription
+	topic.dispatcher.Register(topic, sub)
 
-	//persist the Subscriptions
+	//persist the Subscriptions. Moving clears the record of any previous Subscription in
+	// the same write so that a separate delete can not land after it
 	user.persistLayer.Switchboard().subscriberWriter <- PersistSubscriberStruct{
 		Subscriber: *sub,
 		MessageID:  topic.PointerHead,
 		TopicName:  topic.Name,
+		Move:       true,
+	}
+
+	return sub, nil
+}
+
+//Unsubscribe helper function to unsubscribe a user from a topic.
+//
+//Name picks which of the User's Subscriptions to remove. The empty
+// name is the User's default Subscription. Shared Subscriptions are
+// removed with all their consumers
+func (user *User) Unsubscribe(topic *Topic, name string) error {
+	if err := user.detach(topic, name); err != nil {
+		return err
+	}
+	//delete from persist layer
+	user.persistLayer.Switchboard().subscriberDeleter <- PersistSubscriberStruct{
+		TopicName:    topic.Name,
+		MessageID:    -1,
+		SubscriberID: subscriptionKey(user.UUID, name),
 	}
 
 	return nil
 }
 
-//Unsubscribe helper function to unsubscribe a user from a topic
-func (user *User) Unsubscribe(topic *Topic) error {
+//detach removes the User's Subscription of the given name from the User and Topic and
+// stops its push deliveries. The persisted record is left for the caller to deal with
+func (user *User) detach(topic *Topic, name string) error {
+	key := subscriptionKey(user.UUID, name)
 	user.mu.Lock()
 	//remove from User subscriber list
-	delete(user.Subscriptions, topic.Name)
+	delete(user.Subscriptions, userSubscriptionKey(topic.Name, name))
 	//remove from topic pointerPosition list to no
 	// longer receive messages
 	//remove any user tombstones
@@ -78,18 +155,13 @@ func (user *User) Unsubscribe(topic *Topic) error {
 	user.mu.Unlock()
 
 	topic.mu.Lock()
-	//may have subscription loc other than head position or subscribed more than once
+	//may have subscription loc other than head position
 	for pos := range topic.PointerPositions {
-		delete(topic.PointerPositions[pos], user.UUID)
+		delete(topic.PointerPositions[pos], key)
 	}
 	topic.mu.Unlock()
-
-	//delete from persist layer
-	user.persistLayer.Switchboard().subscriberDeleter <- PersistSubscriberStruct{
-		TopicName:    topic.Name,
-		MessageID:    -1,
-		SubscriberID: user.UUID,
-	}
+	//stop any push deliveries
+	topic.dispatcher.Deregister(topic.Name, key)
 
 	return nil
 }
@@ -105,15 +177,37 @@ func (user *User) WriteToTopic(topic *Topic, message Message) (Message, error) {
 	message.ID = topic.PointerHead
 	topic.Messages[topic.PointerHead] = message
 	topic.PointerHead += 1
+	//wake long polling pulls
+	topic.announce()
 	//remove any topic tombstones
 	if err := topic.removeTombstone(); err != nil {
 		topic.mu.Unlock()
 		return Message{}, err
 	}
+	//move the creator's auto subscription up to the PointerHead with no tombstones, keeping
+	// any settings it has been given
+	sub, from, subscribed := topic.findSubscriber(subscriptionKey(user.UUID, ""))
+	var record Subscriber
+	head := topic.PointerHead
+	if subscribed {
+		topic.moveSubscriber(sub, from, head)
+		if err := sub.removeTombstone(); err != nil {
+			topic.mu.Unlock()
+			return Message{}, err
+		}
+		record = sub.record()
+	}
 	topic.mu.Unlock()
-
-	//move the creator's auto subscription up to the PinterHead with no tombstones
-	user.Subscribe(topic, "") //removes any existing subscriptions
+	if subscribed {
+		user.persistLayer.Switchboard().subscriberWriter <- PersistSubscriberStruct{
+			Subscriber: record,
+			MessageID:  head,
+			TopicName:  topic.Name,
+			Move:       true,
+		}
+	} else {
+		user.Subscribe(topic, SubscriptionOptions{})
+	}
 
 	user.mu.Lock()
 	if err := user.removeTombstone(); err != nil {
@@ -128,22 +222,26 @@ func (user *User) WriteToTopic(topic *Topic, message Message) (Message, error) {
 		TopicName: topic.Name,
 	}
 
+	//wake push subscribers
+	topic.dispatcher.Notify(topic.Name)
+
 	//Write to SSE distro box
 	sseMsg := SSEResponse{
-		Message:   message,
+		Message:   &message,
 		TopicName: topic.Name,
 	}
-	fmt.Println("May hang here in user.WriteToTopic. CHECK-debug")
-	topic.sseOut <- sseMsg //check if this hangs
+	//the SSEDistro never waits on slow clients so this does not hold up the write
+	topic.sseOut <- sseMsg
 
 	return message, nil
 }
 
-//PullMessage retrieves a message from the Topic message queue if the user is subscibed
-func (user *User) PullMessage(topic *Topic, messageID int) (Message, error) {
+//PullMessage retrieves a message from the Topic message queue if the user is subscibed.
+// Name picks the User's named Subscription to pull from, or is empty for the default Subscription
+func (user *User) PullMessage(topic *Topic, name string, messageID int) (Message, error) {
 	//check user is subscribed and isn't pulling a push sub
 	user.mu.RLock()
-	pushURL, ok := user.Subscriptions[topic.Name]
+	pushURL, ok := user.Subscriptions[userSubscriptionKey(topic.Name, name)]
 	user.mu.RUnlock()
 	if !ok {
 		return Message{}, fmt.Errorf("User not subscribed to Topic")
@@ -153,20 +251,18 @@ func (user *User) PullMessage(topic *Topic, messageID int) (Message, error) {
 	//get message from position if exists
 	topic.mu.Lock()
 	defer topic.mu.Unlock()
+	sub, position, subscribed := topic.findSubscriber(subscriptionKey(user.UUID, name))
+	if subscribed && sub.Shared {
+		return Message{}, fmt.Errorf("shared subscription %s is pulled in batches - give max_messages or wait with a consumer", name)
+	}
 	if msg, ok := topic.Messages[messageID]; ok {
 		//Move pointer
-		for position, sub := range topic.PointerPositions { //find current pointer position
-			for subID := range sub {
-				if subID == user.UUID {
-					if messageID > position {
-						if _, ok := topic.PointerPositions[messageID+1]; !ok {
-							topic.PointerPositions[messageID+1] = make(Subscribers)
-						}
-						topic.PointerPositions[messageID+1][user.UUID] = topic.PointerPositions[position][user.UUID]
-						delete(topic.PointerPositions[position], user.UUID)
-					}
-				}
-			}
+		if subscribed && messageID > position {
+			topic.moveSubscriber(sub, position, messageID+1)
+		}
+		//filtered out messages are acknowledged by the move but not handed out
+		if subscribed && !sub.matches(msg) {
+			return Message{}, fmt.Errorf("message #%d does not match the subscription filter", messageID)
 		}
 		return msg, nil
 	}
@@ -175,6 +271,58 @@ func (user *User) PullMessage(topic *Topic, messageID int) (Message, error) {
 
 //------------------helpers
 
+//validate checks the SubscriptionOptions make sense for the Topic and fills in defaults.
+// Shared is whether the options are for a shared Subscription
+func (options *SubscriptionOptions) validate(topic *Topic, shared bool) error {
+	if err := options.RetryPolicy.validate(); err != nil {
+		return err
+	}
+	if options.BatchMaxMessages < 0 || options.BatchMaxBytes < 0 || options.BatchLinger < 0 {
+		return fmt.Errorf("batch_max_messages, batch_max_bytes and batch_linger can not be negative")
+	}
+	if options.AckDeadline < 0 || options.AckDeadline > maxAckDeadline {
+		return fmt.Errorf("ack_deadline must be between 0s and %s", maxAckDeadline)
+	}
+	if options.AckDeadline != 0 && options.PushURL != "" && !shared {
+		return fmt.Errorf("ack_deadline is only available to pull subscriptions")
+	}
+	if options.BatchMaxMessages != 0 || options.BatchMaxBytes != 0 || options.BatchLinger != 0 {
+		if options.PushURL == "" {
+			return fmt.Errorf("batching is only available to push subscriptions")
+		}
+		if shared {
+			return fmt.Errorf("batching is not available to shared subscriptions")
+		}
+	}
+	if options.Sticky && !shared {
+		return fmt.Errorf("sticky is only available to shared subscriptions")
+	}
+	filter, err := ParseFilter(options.Filter)
+	if err != nil {
+		return err
+	}
+	options.filter = filter
+	if options.DeadLetterTopic == "" {
+		if options.MaxAttempts != 0 || options.MaxAge != 0 {
+			return fmt.Errorf("dead_letter_topic is required when setting max_attempts or max_age")
+		}
+		return nil
+	}
+	if options.PushURL == "" && !shared {
+		return fmt.Errorf("dead letter topics are only available to push subscriptions")
+	}
+	if options.DeadLetterTopic == topic.Name {
+		return fmt.Errorf("dead letter topic must be different to the subscribed topic")
+	}
+	if options.MaxAttempts < 0 || options.MaxAge < 0 {
+		return fmt.Errorf("max_attempts and max_age can not be negative")
+	}
+	if options.MaxAttempts == 0 && options.MaxAge == 0 {
+		options.MaxAttempts = defaultMaxAttempts
+	}
+	return nil
+}
+
 //GetCreatedDateTime fetches the created datetime string and parses it
 func (user User) GetCreatedDateTime() (time.Time, error) {
 	if user.Created == "" {
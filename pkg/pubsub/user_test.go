@@ -0,0 +1,64 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWriteToTopicMovesCreatorSubscription(t *testing.T) {
+	tests := []struct {
+		name string
+		//setup changes the creator's default Subscription before the write
+		setup           func(t *testing.T, creator *User, topic *Topic)
+		wantAckDeadline time.Duration
+	}{
+		{
+			name:  "auto subscription",
+			setup: func(t *testing.T, creator *User, topic *Topic) {},
+		},
+		{
+			name: "settings are kept",
+			setup: func(t *testing.T, creator *User, topic *Topic) {
+				if _, err := creator.Subscribe(topic, SubscriptionOptions{AckDeadline: time.Minute}); err != nil {
+					t.Fatalf("Subscribe() error = %v", err)
+				}
+			},
+			wantAckDeadline: time.Minute,
+		},
+		{
+			name: "unsubscribed creator is subscribed again",
+			setup: func(t *testing.T, creator *User, topic *Topic) {
+				if err := creator.Unsubscribe(topic, ""); err != nil {
+					t.Fatalf("Unsubscribe() error = %v", err)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pubsub, creator := newTestPubSub(t)
+			topic, err := pubsub.CreateTopic("orders", creator)
+			if err != nil {
+				t.Fatalf("CreateTopic() error = %v", err)
+			}
+			test.setup(t, creator, topic)
+			writeMessages(t, creator, topic, 3, time.Now())
+
+			topic.mu.RLock()
+			defer topic.mu.RUnlock()
+			sub, position, ok := topic.findSubscriber(subscriptionKey(creator.UUID, ""))
+			if !ok {
+				t.Fatalf("creator is not subscribed")
+			}
+			if position != topic.PointerHead {
+				t.Errorf("creator subscription position = %d, want %d", position, topic.PointerHead)
+			}
+			if sub.AckDeadline != test.wantAckDeadline {
+				t.Errorf("creator subscription AckDeadline = %s, want %s", sub.AckDeadline, test.wantAckDeadline)
+			}
+			if _, ok := creator.Subscriptions[userSubscriptionKey(topic.Name, "")]; !ok {
+				t.Errorf("creator Subscriptions is missing %s", topic.Name)
+			}
+		})
+	}
+}
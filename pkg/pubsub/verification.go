@@ -0,0 +1,162 @@
+package pubsub
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	//SubscriptionActive is the Status of a Subscriber receiving messages
+	SubscriptionActive = "active"
+	//SubscriptionPending is the Status of a push Subscriber whose endpoint has not yet confirmed the subscription
+	SubscriptionPending = "pending"
+	//maxVerifyAttempts is the number of failed verification requests before a pending Subscription is removed
+	maxVerifyAttempts = 5
+	//maxChallengeLength is the most of the response body read when checking for the echoed challenge
+	maxChallengeLength = 1024
+)
+
+//pending is whether the Subscriber is waiting on its endpoint to be verified.
+// Subscribers without a Status are from before verification existed so are active
+func (subscriber *Subscriber) pending() bool {
+	subscriber.mu.RLock()
+	defer subscriber.mu.RUnlock()
+	return subscriber.Status == SubscriptionPending
+}
+
+//verify does the WebSub style intent verification of the worker's endpoint - the
+// Subscriber's PushURL or that of its consumer for shared Subscribers.
+//
+//A GET request is sent to the endpoint with `hub.mode`, `hub.topic`, `hub.challenge`
+// and `hub.lease_seconds` query params. The endpoint confirms the Subscription by
+// responding with a 2xx status code and the `hub.challenge` value as the body
+func (dispatcher *PushDispatcher) verify(worker *pushWorker) error {
+	challenge, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	pushURL, secret := worker.endpoint()
+	endpoint, err := url.Parse(pushURL)
+	if err != nil {
+		return err
+	}
+	query := endpoint.Query()
+	query.Set("hub.mode", "subscribe")
+	query.Set("hub.topic", worker.topic.Name)
+	query.Set("hub.challenge", challenge)
+	query.Set("hub.lease_seconds", strconv.Itoa(int(durationToStale.Seconds())))
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if secret != "" {
+		req.Header.Set(HeaderSignature, signPayload(secret, timestamp, nil))
+	}
+	//wait for a free slot
+	select {
+	case dispatcher.slots <- struct{}{}:
+	case <-worker.quit:
+		return fmt.Errorf("worker stopped before verification")
+	}
+	defer func() { <-dispatcher.slots }()
+
+	started := time.Now()
+	resp, err := dispatcher.client.Do(req)
+	if err != nil {
+		worker.recordAttempt(DeliveryTypeVerification, nil, started, 0, err)
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxChallengeLength))
+	if err == nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		err = fmt.Errorf("verification responded with status code %d", resp.StatusCode)
+	}
+	if err == nil && string(body) != challenge {
+		err = fmt.Errorf("verification response did not echo the challenge")
+	}
+	worker.recordAttempt(DeliveryTypeVerification, nil, started, resp.StatusCode, err)
+	return err
+}
+
+//activate marks the Subscriber, or the consumer of a shared Subscriber, as verified and persists the change
+func (dispatcher *PushDispatcher) activate(worker *pushWorker) {
+	subscriber := worker.subscriber
+	if worker.member != nil {
+		dispatcher.activateMember(worker)
+		return
+	}
+	subscriber.mu.Lock()
+	subscriber.Status = SubscriptionActive
+	record := *subscriber
+	subscriber.mu.Unlock()
+
+	worker.topic.mu.RLock()
+	position, ok := worker.topic.subscriberPosition(subscriber)
+	worker.topic.mu.RUnlock()
+	if !ok {
+		return
+	}
+	dispatcher.pubsub.persistLayer.Switchboard().subscriberWriter <- PersistSubscriberStruct{
+		Subscriber: record,
+		MessageID:  position,
+		TopicName:  worker.topic.Name,
+	}
+}
+
+//activateMember marks the consumer of a shared Subscriber as verified and persists the change
+func (dispatcher *PushDispatcher) activateMember(worker *pushWorker) {
+	worker.topic.mu.Lock()
+	worker.member.Status = SubscriptionActive
+	position, ok := worker.topic.subscriberPosition(worker.subscriber)
+	record := worker.subscriber.record()
+	worker.topic.mu.Unlock()
+	if !ok {
+		return
+	}
+	dispatcher.pubsub.persistLayer.Switchboard().subscriberWriter <- PersistSubscriberStruct{
+		Subscriber: record,
+		MessageID:  position,
+		TopicName:  worker.topic.Name,
+	}
+}
+
+//abandon removes a pending Subscription, or the pending consumer of a shared Subscription,
+// whose endpoint could not be verified
+func (dispatcher *PushDispatcher) abandon(worker *pushWorker) {
+	pubsub := dispatcher.pubsub
+	pubsub.mu.RLock()
+	user, ok := pubsub.Users[worker.subscriber.UsernameHash]
+	pubsub.mu.RUnlock()
+	if !ok {
+		return
+	}
+	//leave alone if the User has subscribed again since
+	worker.topic.mu.RLock()
+	_, current := worker.topic.subscriberPosition(worker.subscriber)
+	if current && worker.member != nil {
+		current = worker.subscriber.Members[worker.member.ID] == worker.member
+	}
+	worker.topic.mu.RUnlock()
+	if !current {
+		return
+	}
+	log.Printf("Removed subscription %s from topic %s as its webhook could not be verified\n", worker.name(), worker.topic.Name)
+	if worker.member != nil {
+		if err := user.LeaveSubscription(worker.topic, worker.subscriber.Name, worker.member.ID); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	if err := user.Unsubscribe(worker.topic, worker.subscriber.Name); err != nil {
+		log.Println(err)
+	}
+}
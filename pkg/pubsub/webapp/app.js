@@ -36,6 +36,13 @@ function react(evt) {
   evt.addEventListener("message", function (event) {
     AddStreamItem(JSON.parse(event.data));
   })
+  //handle system events about subscriptions to the streamed topics
+  for (const systemEvent of ["subscription.tombstoned", "subscription.deleted"]) {
+    evt.addEventListener(systemEvent, function (event) {
+      const sseMsg = JSON.parse(event.data);
+      M.toast({ text: `${sseMsg.topic_name}: ${systemEvent} - ${sseMsg.system.reason}` });
+    })
+  }
   //handle SSE errors
   evt.onerror = function (err) {
     console.error("EventSource failed:", err);
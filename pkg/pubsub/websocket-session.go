@@ -0,0 +1,480 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+//WebSocket frame types sent by clients
+const (
+	//WSAuth logs the connection in with a username and password or a token
+	WSAuth = "auth"
+	//WSSubscribe starts streaming a topic live, or from one of the User's pull subscriptions
+	WSSubscribe = "subscribe"
+	//WSUnsubscribe stops streaming a topic started by WSSubscribe
+	WSUnsubscribe = "unsubscribe"
+	//WSPublish writes a message to a topic
+	WSPublish = "publish"
+	//WSAck acknowledges messages streamed from a pull subscription
+	WSAck = "ack"
+)
+
+//WebSocket frame types sent to clients. Replies to client frames are the client
+// frame type in the past tense, or WSError
+const (
+	WSAuthenticated = "authenticated"
+	WSSubscribed    = "subscribed"
+	WSUnsubscribed  = "unsubscribed"
+	WSPublished     = "published"
+	WSAcked         = "acked"
+	//WSMessage carries a streamed message
+	WSMessage = "message"
+	//WSSystem carries a system event about a streamed topic
+	WSSystem = "system"
+	//WSError replies to a client frame that failed, or reports a stream that was stopped
+	WSError = "error"
+)
+
+//WSRequest is a frame sent by a WebSocket client. Type picks the operation and ID is
+// echoed back in the reply so clients can match them up
+type WSRequest struct {
+	Type     string `json:"type"`
+	ID       string `json:"id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Topic    string `json:"topic,omitempty"`
+	//Subscription names the User's pull subscription to stream. Nil streams the topic live
+	// and an empty string is the User's default subscription
+	Subscription *string `json:"subscription,omitempty"`
+	Consumer     string  `json:"consumer,omitempty"`
+	//From is the message ID to start streaming from. Pull subscriptions are sought to it
+	From *int `json:"from,omitempty"`
+	//Filter picks the messages of live streams. Pull subscriptions use their own filter
+	Filter string `json:"filter,omitempty"`
+	//Ack is how a pull subscription stream acknowledges messages. Defaults to SSEAckAuto
+	Ack        SSEAckMode        `json:"ack,omitempty"`
+	Message    interface{}       `json:"message,omitempty"`
+	Key        string            `json:"key,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	MessageIDs []int             `json:"message_ids,omitempty"`
+}
+
+//WSResponse is a frame sent to a WebSocket client
+type WSResponse struct {
+	Type            string       `json:"type"`
+	ID              string       `json:"id,omitempty"`
+	User            string       `json:"user_id,omitempty"`
+	Topic           string       `json:"topic,omitempty"`
+	Subscription    *string      `json:"subscription,omitempty"`
+	Message         *Message     `json:"message,omitempty"`
+	System          *SystemEvent `json:"system,omitempty"`
+	PointerPosition *int         `json:"pointer_position,omitempty"`
+	Error           string       `json:"error,omitempty"`
+}
+
+//wsOutgoing is a frame queued for the client. Written is called once it has been written.
+// Frames of a stream are dropped unwritten if the stream's ctx is done by the time they are reached
+type wsOutgoing struct {
+	ctx     context.Context
+	frame   WSResponse
+	written func()
+}
+
+//wsSession runs the JSON frame protocol over a WebSocket connection.
+//
+//Frames to the client are queued on a bounded channel drained by a single writer.
+// Streams wait on the queue when the client is slow, so pull subscriptions stop pulling
+// and live streams fall behind on their SSEDistro buffer until its overflow policy applies
+type wsSession struct {
+	pubsub *PubSub
+	conn   *wsConn
+	user   *User
+	ctx    context.Context
+	cancel context.CancelFunc
+	out    chan wsOutgoing
+	//streams holds the cancel functions of the running streams by streamKey
+	mu      *sync.Mutex
+	streams map[string]context.CancelFunc
+}
+
+//runWebSocket serves the JSON frame protocol to the connection until it is closed.
+// User is nil if the connection was not opened with a token and must send WSAuth first
+func (pubsub *PubSub) runWebSocket(conn *wsConn, user *User) {
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &wsSession{
+		pubsub:  pubsub,
+		conn:    conn,
+		user:    user,
+		ctx:     ctx,
+		cancel:  cancel,
+		out:     make(chan wsOutgoing, pubsub.sseDistro.BufferSize),
+		mu:      &sync.Mutex{},
+		streams: make(map[string]context.CancelFunc),
+	}
+	go session.writeLoop()
+	defer cancel()
+
+	for {
+		//any frame from the client, including a pong, shows it is still there
+		conn.conn.SetReadDeadline(time.Now().Add(2 * wsPingInterval))
+		payload, err := conn.readMessage()
+		if err != nil {
+			if closeErr, ok := err.(wsCloseError); ok {
+				conn.close(closeErr.Code, closeErr.Reason)
+			} else {
+				conn.conn.Close()
+			}
+			return
+		}
+		var req WSRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			session.fail(req, fmt.Errorf("invalid frame: %v", err))
+			continue
+		}
+		session.handle(req)
+	}
+}
+
+//writeLoop writes queued frames to the client and pings it every wsPingInterval.
+// The session is ended if a write fails
+func (session *wsSession) writeLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	defer session.conn.conn.Close()
+	for {
+		select {
+		case <-session.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := session.conn.writeFrame(wsPing, nil); err != nil {
+				session.cancel()
+				return
+			}
+		case outgoing := <-session.out:
+			//the client has unsubscribed from the stream the frame was queued for
+			if outgoing.ctx.Err() != nil {
+				continue
+			}
+			payload, err := json.Marshal(outgoing.frame)
+			if err != nil {
+				log.Printf("error encoding websocket frame: %v\n", err)
+				continue
+			}
+			if err := session.conn.writeFrame(wsText, payload); err != nil {
+				session.cancel()
+				return
+			}
+			if outgoing.written != nil {
+				outgoing.written()
+			}
+		}
+	}
+}
+
+//send queues the frame for the client, waiting while the queue is full. ctx is the session's
+// or that of the stream the frame belongs to. Returns false if ctx was done first
+func (session *wsSession) send(ctx context.Context, frame WSResponse, written func()) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case session.out <- wsOutgoing{ctx: ctx, frame: frame, written: written}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+//reply answers the client frame
+func (session *wsSession) reply(req WSRequest, frame WSResponse) {
+	frame.ID = req.ID
+	session.send(session.ctx, frame, nil)
+}
+
+//fail answers the client frame with the error
+func (session *wsSession) fail(req WSRequest, err error) {
+	session.reply(req, WSResponse{Type: WSError, Topic: req.Topic, Subscription: req.Subscription, Error: err.Error()})
+}
+
+//handle carries out a client frame
+func (session *wsSession) handle(req WSRequest) {
+	if req.Type == WSAuth {
+		session.authenticate(req)
+		return
+	}
+	if session.user == nil {
+		session.fail(req, fmt.Errorf("authenticate with an auth frame first"))
+		return
+	}
+	switch req.Type {
+	case WSSubscribe:
+		session.subscribe(req)
+	case WSUnsubscribe:
+		if !session.endStream(streamKey(req.Topic, req.Subscription)) {
+			session.fail(req, fmt.Errorf("Topic %s is not being streamed", req.Topic))
+			return
+		}
+		session.reply(req, WSResponse{Type: WSUnsubscribed, Topic: req.Topic, Subscription: req.Subscription})
+	case WSPublish:
+		session.publish(req)
+	case WSAck:
+		session.ack(req)
+	default:
+		session.fail(req, fmt.Errorf("unknown frame type %q", req.Type))
+	}
+}
+
+//authenticate logs the session in as the User of the username and password or token.
+// Sessions can not change User once logged in
+func (session *wsSession) authenticate(req WSRequest) {
+	if session.user != nil {
+		session.fail(req, fmt.Errorf("already authenticated"))
+		return
+	}
+	var user *User
+	var err error
+	switch {
+	case req.Token != "":
+		user, err = session.pubsub.TokenUser(req.Token)
+	case req.Username != "" && req.Password != "":
+		user, err = session.pubsub.GetUser(req.Username, req.Password)
+	default:
+		err = fmt.Errorf("username and password or token are required")
+	}
+	if err != nil {
+		session.fail(req, err)
+		return
+	}
+	session.user = user
+	session.reply(req, WSResponse{Type: WSAuthenticated, User: user.UUID})
+}
+
+//publish writes the message to the topic, creating the topic if needed as the write endpoint does
+func (session *wsSession) publish(req WSRequest) {
+	if req.Topic == "" {
+		session.fail(req, fmt.Errorf("Topic Name is required"))
+		return
+	}
+	topic, err := session.pubsub.GetTopic(req.Topic, session.user)
+	if err != nil {
+		session.fail(req, err)
+		return
+	}
+	msg := Message{Data: req.Message, Key: req.Key, Attributes: req.Attributes}
+	msg.AddCreatedDatestring(time.Now())
+	message, err := session.user.WriteToTopic(topic, msg)
+	if err != nil {
+		session.fail(req, err)
+		return
+	}
+	session.reply(req, WSResponse{Type: WSPublished, Topic: topic.Name, Message: &message})
+}
+
+//ack acknowledges messages streamed from a pull subscription
+func (session *wsSession) ack(req WSRequest) {
+	topic, err := session.pubsub.FetchTopic(req.Topic, session.user)
+	if err != nil {
+		session.fail(req, err)
+		return
+	}
+	consumer := Consumer{Member: req.Consumer}
+	if req.Subscription != nil {
+		consumer.Subscription = *req.Subscription
+	}
+	position, err := session.user.Ack(topic, consumer, req.MessageIDs)
+	if err != nil {
+		session.fail(req, err)
+		return
+	}
+	session.reply(req, WSResponse{Type: WSAcked, Topic: topic.Name, Subscription: req.Subscription, PointerPosition: &position})
+}
+
+//streamKey identifies a stream on a session by its topic and subscription
+func streamKey(topicName string, subscription *string) string {
+	if subscription == nil {
+		return "live/" + topicName
+	}
+	return "subscription/" + topicName + "/" + *subscription
+}
+
+//subscribe starts streaming the topic live, or from a pull subscription if one is named
+func (session *wsSession) subscribe(req WSRequest) {
+	key := streamKey(req.Topic, req.Subscription)
+	session.mu.Lock()
+	_, streaming := session.streams[key]
+	session.mu.Unlock()
+	if streaming {
+		session.fail(req, fmt.Errorf("Topic %s is already being streamed", req.Topic))
+		return
+	}
+
+	var stream func(ctx context.Context)
+	if req.Subscription == nil {
+		filter, err := ParseFilter(req.Filter)
+		if err != nil {
+			session.fail(req, err)
+			return
+		}
+		if !session.pubsub.streamable(req.Topic, session.user) {
+			session.fail(req, fmt.Errorf("User can not read private Topic %s", req.Topic))
+			return
+		}
+		from := -1
+		if req.From != nil {
+			from = *req.From
+		}
+		stream = func(ctx context.Context) {
+			session.streamLive(ctx, req, filter, from)
+		}
+	} else {
+		if req.Filter != "" {
+			session.fail(req, fmt.Errorf("filter can not be used with a subscription - subscribe with a filter instead"))
+			return
+		}
+		mode := req.Ack
+		if mode == "" {
+			mode = SSEAckAuto
+		}
+		if mode != SSEAckAuto && mode != SSEAckManual {
+			session.fail(req, fmt.Errorf("ack must be %s or %s", SSEAckAuto, SSEAckManual))
+			return
+		}
+		topic, err := session.pubsub.FetchTopic(req.Topic, session.user)
+		if err != nil {
+			session.fail(req, err)
+			return
+		}
+		consumer := Consumer{Subscription: *req.Subscription, Member: req.Consumer}
+		if _, err := session.user.touchSubscription(topic, consumer); err != nil {
+			session.fail(req, err)
+			return
+		}
+		if req.From != nil {
+			if _, err := session.user.SeekToMessage(topic, consumer.Subscription, *req.From); err != nil {
+				session.fail(req, err)
+				return
+			}
+		}
+		stream = func(ctx context.Context) {
+			session.streamSubscription(ctx, req, topic, consumer, mode)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(session.ctx)
+	session.mu.Lock()
+	session.streams[key] = cancel
+	session.mu.Unlock()
+	//reply before streaming so the client sees it ahead of the first message
+	session.reply(req, WSResponse{Type: WSSubscribed, Topic: req.Topic, Subscription: req.Subscription})
+	go stream(ctx)
+}
+
+//endStream stops the stream of the key. Returns false if it was not running
+func (session *wsSession) endStream(key string) bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	cancel, ok := session.streams[key]
+	if ok {
+		cancel()
+		delete(session.streams, key)
+	}
+	return ok
+}
+
+//stopStream ends the stream of the request and tells the client why
+func (session *wsSession) stopStream(req WSRequest, err error) {
+	session.endStream(streamKey(req.Topic, req.Subscription))
+	session.send(session.ctx, WSResponse{Type: WSError, Topic: req.Topic, Subscription: req.Subscription, Error: err.Error()}, nil)
+}
+
+//streamLive sends the topic's messages from the SSE fan-out as they are written, after
+// replaying the retained messages from the message ID from if it is not negative
+func (session *wsSession) streamLive(ctx context.Context, req WSRequest, filter *Filter, from int) {
+	clientName := RandomString(6)
+	receiver := make(chan SSEResponse, session.pubsub.sseDistro.BufferSize)
+	session.pubsub.sseDistro.Add <- SSEAddRequester{
+		ID:       clientName,
+		Topics:   []string{req.Topic},
+		Receiver: receiver,
+	}
+	defer func() {
+		session.pubsub.sseDistro.Cancel <- clientName
+	}()
+	//replay before going live. Live messages written meanwhile are skipped by the cursor
+	cursor := make(SSECursor)
+	for _, item := range session.pubsub.sseBacklog(req.Topic, cursor, from) {
+		if !filter.Matches(*item.Message) {
+			continue
+		}
+		cursor[req.Topic] = item.Message.ID
+		message := *item.Message
+		if !session.send(ctx, WSResponse{Type: WSMessage, Topic: req.Topic, Message: &message}, nil) {
+			return
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item, ok := <-receiver:
+			//the SSEDistro closes the receiver if the client falls too far behind
+			if !ok {
+				session.stopStream(req, fmt.Errorf("stream fell behind and was stopped - subscribe again from the last message ID to resume"))
+				return
+			}
+			if !session.pubsub.streamable(req.Topic, session.user) {
+				session.stopStream(req, fmt.Errorf("read access to Topic %s was revoked", req.Topic))
+				return
+			}
+			if item.System != nil {
+				if !session.send(ctx, WSResponse{Type: WSSystem, Topic: req.Topic, System: item.System}, nil) {
+					return
+				}
+				continue
+			}
+			if !filter.Matches(*item.Message) {
+				continue
+			}
+			if last, ok := cursor[req.Topic]; ok && item.Message.ID <= last {
+				continue
+			}
+			cursor[req.Topic] = item.Message.ID
+			message := *item.Message
+			if !session.send(ctx, WSResponse{Type: WSMessage, Topic: req.Topic, Message: &message}, nil) {
+				return
+			}
+		}
+	}
+}
+
+//streamSubscription sends the messages of the User's pull subscription from its pointer.
+// With SSEAckAuto messages are acknowledged once written to the client, otherwise the
+// client acknowledges them with WSAck frames
+func (session *wsSession) streamSubscription(ctx context.Context, req WSRequest, topic *Topic, consumer Consumer, mode SSEAckMode) {
+	user := session.user
+	err := user.streamSubscription(ctx, topic, consumer, func(msgs []Message) error {
+		for _, msg := range msgs {
+			message := msg
+			var written func()
+			if mode == SSEAckAuto {
+				written = func() {
+					if _, err := user.Ack(topic, consumer, []int{message.ID}); err != nil {
+						log.Printf("error acknowledging message #%d streamed over websocket from Topic %s: %v\n", message.ID, topic.Name, err)
+					}
+				}
+			}
+			if !session.send(ctx, WSResponse{Type: WSMessage, Topic: topic.Name, Subscription: req.Subscription, Message: &message}, written) {
+				return ctx.Err()
+			}
+		}
+		return nil
+	}, nil)
+	if ctx.Err() == nil {
+		session.stopStream(req, err)
+	}
+}
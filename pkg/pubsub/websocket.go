@@ -0,0 +1,249 @@
+package pubsub
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//websocketGUID is appended to the client's key to accept a WebSocket handshake. See RFC 6455
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	//wsMaxMessageSize caps the payload of a frame or fragmented message read from a client
+	wsMaxMessageSize = 1 << 20
+	//wsPingInterval is how often clients are pinged. Clients that send nothing, not even
+	// a pong, for two intervals are disconnected
+	wsPingInterval = 30 * time.Second
+	//wsWriteTimeout is how long a client can take to accept a frame before it is disconnected
+	wsWriteTimeout = 10 * time.Second
+)
+
+//WebSocket frame opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+//WebSocket close status codes
+const (
+	wsCloseNormal        = 1000
+	wsCloseProtocolError = 1002
+	wsCloseTooBig        = 1009
+)
+
+//wsConn is the server side of a WebSocket connection. Frames can be written from
+// multiple goroutines but must only be read from one
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	//writeMu stops frames from different goroutines interleaving
+	writeMu *sync.Mutex
+}
+
+//wsCloseError is returned by readMessage when the connection should be closed with the status Code
+type wsCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (err wsCloseError) Error() string {
+	return fmt.Sprintf("websocket closed with status %d: %s", err.Code, err.Reason)
+}
+
+//wsUpgrade completes the WebSocket opening handshake and takes over the connection from the
+// http server. Nothing is written to rw if the request is not a valid handshake so the caller
+// can still respond with an error
+func wsUpgrade(rw http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		return nil, fmt.Errorf("websocket handshakes must be GET requests")
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || !headerHasToken(r.Header, "Connection", "upgrade") {
+		return nil, fmt.Errorf("not a websocket handshake - expected Upgrade: websocket")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		rw.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, fmt.Errorf("unsupported websocket version - only 13 is supported")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("Sec-WebSocket-Key header is required")
+	}
+	hijacker, ok := rw.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("server does not support websocket connections")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("could not take over connection for websocket: %v", err)
+	}
+	//the http server's timeouts no longer apply - the connection manages its own
+	conn.SetDeadline(time.Time{})
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(buffered, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(accept[:]))
+	if err := buffered.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{
+		conn:    conn,
+		reader:  buffered.Reader,
+		writeMu: &sync.Mutex{},
+	}, nil
+}
+
+//headerHasToken is whether the comma separated header contains the token, ignoring case
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//readMessage reads the next text or binary message from the client, joining fragmented
+// frames. Pings are answered and pongs skipped while reading. Returns a wsCloseError
+// if the client closed the connection or broke the protocol
+func (ws *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	fragmented := false
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			code := wsCloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			return nil, wsCloseError{Code: code, Reason: "closed by client"}
+		case wsText, wsBinary:
+			if fragmented {
+				return nil, wsCloseError{Code: wsCloseProtocolError, Reason: "new message before the last was finished"}
+			}
+			message = payload
+		case wsContinuation:
+			if !fragmented {
+				return nil, wsCloseError{Code: wsCloseProtocolError, Reason: "continuation frame without a message"}
+			}
+			if len(message)+len(payload) > wsMaxMessageSize {
+				return nil, wsCloseError{Code: wsCloseTooBig, Reason: "message too large"}
+			}
+			message = append(message, payload...)
+		default:
+			return nil, wsCloseError{Code: wsCloseProtocolError, Reason: fmt.Sprintf("unknown opcode %d", opcode)}
+		}
+		if fin {
+			return message, nil
+		}
+		fragmented = true
+	}
+}
+
+//readFrame reads a single frame from the client and unmasks its payload
+func (ws *wsConn) readFrame() (bool, byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(ws.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, wsCloseError{Code: wsCloseProtocolError, Reason: "reserved bits set without an extension"}
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, wsCloseError{Code: wsCloseProtocolError, Reason: "client frames must be masked"}
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(ws.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(ws.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	//control frames can not be fragmented or carry more than 125 bytes
+	if opcode >= wsClose && (!fin || length > 125) {
+		return false, 0, nil, wsCloseError{Code: wsCloseProtocolError, Reason: "invalid control frame"}
+	}
+	if length > wsMaxMessageSize {
+		return false, 0, nil, wsCloseError{Code: wsCloseTooBig, Reason: "message too large"}
+	}
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(ws.reader, mask); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+//writeFrame writes an unfragmented frame to the client. Clients that do not accept
+// it within wsWriteTimeout get an error
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+	ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+//close sends a close frame with the status code and reason then closes the connection
+func (ws *wsConn) close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	ws.writeFrame(wsClose, payload)
+	return ws.conn.Close()
+}
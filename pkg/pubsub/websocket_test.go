@@ -0,0 +1,248 @@
+package pubsub
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+//bufferConn is a net.Conn that keeps what is written to it
+type bufferConn struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (conn *bufferConn) Write(b []byte) (int, error)      { return conn.written.Write(b) }
+func (conn *bufferConn) SetWriteDeadline(time.Time) error { return nil }
+func (conn *bufferConn) Close() error                     { return nil }
+
+//newTestWSConn gives a wsConn reading the input and the bufferConn it writes to
+func newTestWSConn(input []byte) (*wsConn, *bufferConn) {
+	conn := &bufferConn{}
+	return &wsConn{conn: conn, reader: bufio.NewReader(bytes.NewReader(input)), writeMu: &sync.Mutex{}}, conn
+}
+
+//clientFrame encodes a frame as a client sends it, masked with a fixed key
+func clientFrame(fin bool, opcode byte, payload []byte) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+//serverFrame decodes the unmasked frame at the start of data as the server writes it and gives the rest of data
+func serverFrame(t *testing.T, data []byte) (bool, byte, []byte, []byte) {
+	t.Helper()
+	if len(data) < 2 {
+		t.Fatalf("frame header truncated: % x", data)
+	}
+	if data[1]&0x80 != 0 {
+		t.Fatalf("server frame is masked")
+	}
+	fin, opcode := data[0]&0x80 != 0, data[0]&0x0F
+	length, offset := uint64(data[1]&0x7F), 2
+	switch length {
+	case 126:
+		length, offset = uint64(binary.BigEndian.Uint16(data[2:])), 4
+	case 127:
+		length, offset = binary.BigEndian.Uint64(data[2:]), 10
+	}
+	if uint64(len(data)-offset) < length {
+		t.Fatalf("frame payload truncated")
+	}
+	end := offset + int(length)
+	return fin, opcode, data[offset:end], data[end:]
+}
+
+func TestWriteFrame(t *testing.T) {
+	//lengths either side of the 7, 16 and 64 bit length encodings
+	for _, length := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		ws, conn := newTestWSConn(nil)
+		payload := bytes.Repeat([]byte("a"), length)
+		if err := ws.writeFrame(wsText, payload); err != nil {
+			t.Fatalf("writeFrame() error = %v", err)
+		}
+		fin, opcode, got, rest := serverFrame(t, conn.written.Bytes())
+		if !fin || opcode != wsText || !bytes.Equal(got, payload) || len(rest) != 0 {
+			t.Errorf("writeFrame() of %d bytes read back as fin %v opcode %d %d bytes, %d trailing", length, fin, opcode, len(got), len(rest))
+		}
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	large := bytes.Repeat([]byte("ab"), 0x9000)
+	unmasked := clientFrame(true, wsText, []byte("hi"))
+	unmasked[1] &^= 0x80
+	tooLarge := []byte{0x81, 0x80 | 127, 0, 0, 0, 0, 0, 0x20, 0, 0}
+	tests := []struct {
+		name        string
+		input       []byte
+		wantFin     bool
+		wantOpcode  byte
+		wantPayload []byte
+		wantCode    int //wantCode is the wsCloseError code expected, or -1 for any other error
+	}{
+		{name: "short payload", input: clientFrame(true, wsText, []byte("hello")), wantFin: true, wantOpcode: wsText, wantPayload: []byte("hello")},
+		{name: "empty payload", input: clientFrame(true, wsBinary, nil), wantFin: true, wantOpcode: wsBinary, wantPayload: []byte{}},
+		{name: "16 bit length", input: clientFrame(true, wsText, large[:300]), wantFin: true, wantOpcode: wsText, wantPayload: large[:300]},
+		{name: "64 bit length", input: clientFrame(true, wsBinary, large), wantFin: true, wantOpcode: wsBinary, wantPayload: large},
+		{name: "fragment", input: clientFrame(false, wsText, []byte("he")), wantOpcode: wsText, wantPayload: []byte("he")},
+		{name: "ping", input: clientFrame(true, wsPing, []byte("p")), wantFin: true, wantOpcode: wsPing, wantPayload: []byte("p")},
+		{name: "unmasked", input: unmasked, wantCode: wsCloseProtocolError},
+		{name: "reserved bits", input: append([]byte{0xC1}, clientFrame(true, wsText, nil)[1:]...), wantCode: wsCloseProtocolError},
+		{name: "fragmented control frame", input: clientFrame(false, wsPing, nil), wantCode: wsCloseProtocolError},
+		{name: "long control frame", input: clientFrame(true, wsClose, large[:126]), wantCode: wsCloseProtocolError},
+		{name: "over the size limit", input: tooLarge, wantCode: wsCloseTooBig},
+		{name: "truncated header", input: []byte{0x81}, wantCode: -1},
+		{name: "truncated length", input: []byte{0x81, 0x80 | 126, 0}, wantCode: -1},
+		{name: "truncated payload", input: clientFrame(true, wsText, []byte("hello"))[:8], wantCode: -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ws, _ := newTestWSConn(test.input)
+			fin, opcode, payload, err := ws.readFrame()
+			if test.wantCode != 0 {
+				var closeErr wsCloseError
+				isClose := errors.As(err, &closeErr)
+				if err == nil || (test.wantCode > 0 && (!isClose || closeErr.Code != test.wantCode)) || (test.wantCode < 0 && isClose) {
+					t.Fatalf("readFrame() error = %v, want close code %d", err, test.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readFrame() error = %v", err)
+			}
+			if fin != test.wantFin || opcode != test.wantOpcode || !bytes.Equal(payload, test.wantPayload) {
+				t.Errorf("readFrame() = %v, %d, %.20q, want %v, %d, %.20q", fin, opcode, payload, test.wantFin, test.wantOpcode, test.wantPayload)
+			}
+		})
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	join := func(frames ...[]byte) []byte { return bytes.Join(frames, nil) }
+	tests := []struct {
+		name     string
+		input    []byte
+		want     []byte
+		wantCode int
+		//wantPongs are the payloads of the pongs answering pings
+		wantPongs [][]byte
+	}{
+		{name: "single frame", input: clientFrame(true, wsText, []byte("hello")), want: []byte("hello")},
+		{
+			name:  "fragmented",
+			input: join(clientFrame(false, wsText, []byte("he")), clientFrame(false, wsContinuation, []byte("ll")), clientFrame(true, wsContinuation, []byte("o"))),
+			want:  []byte("hello"),
+		},
+		{
+			name:      "control frames between fragments",
+			input:     join(clientFrame(false, wsText, []byte("he")), clientFrame(true, wsPing, []byte("p")), clientFrame(true, wsPong, nil), clientFrame(true, wsContinuation, []byte("llo"))),
+			want:      []byte("hello"),
+			wantPongs: [][]byte{[]byte("p")},
+		},
+		{name: "close", input: clientFrame(true, wsClose, []byte{0x03, 0xE9}), wantCode: 1001},
+		{name: "close without a status", input: clientFrame(true, wsClose, nil), wantCode: wsCloseNormal},
+		{name: "continuation without a message", input: clientFrame(true, wsContinuation, []byte("x")), wantCode: wsCloseProtocolError},
+		{
+			name:     "message before the last was finished",
+			input:    join(clientFrame(false, wsText, []byte("he")), clientFrame(true, wsText, []byte("llo"))),
+			wantCode: wsCloseProtocolError,
+		},
+		{name: "unknown opcode", input: clientFrame(true, 0x3, nil), wantCode: wsCloseProtocolError},
+		{
+			name:     "fragments over the size limit",
+			input:    join(clientFrame(false, wsBinary, make([]byte, wsMaxMessageSize)), clientFrame(true, wsContinuation, []byte("x"))),
+			wantCode: wsCloseTooBig,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ws, conn := newTestWSConn(test.input)
+			got, err := ws.readMessage()
+			if test.wantCode != 0 {
+				var closeErr wsCloseError
+				if !errors.As(err, &closeErr) || closeErr.Code != test.wantCode {
+					t.Fatalf("readMessage() error = %v, want close code %d", err, test.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readMessage() error = %v", err)
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("readMessage() = %q, want %q", got, test.want)
+			}
+			pongs, written := [][]byte{}, conn.written.Bytes()
+			for len(written) > 0 {
+				_, opcode, payload, rest := serverFrame(t, written)
+				if opcode != wsPong {
+					t.Errorf("wrote opcode %d, want only pongs", opcode)
+				}
+				pongs, written = append(pongs, payload), rest
+			}
+			if len(pongs) != len(test.wantPongs) || (len(pongs) > 0 && !reflect.DeepEqual(pongs, test.wantPongs)) {
+				t.Errorf("pongs = %q, want %q", pongs, test.wantPongs)
+			}
+		})
+	}
+}
+
+func TestWSSessionDropsFramesOfEndedStreams(t *testing.T) {
+	ws, conn := newTestWSConn(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &wsSession{conn: ws, ctx: ctx, cancel: cancel, out: make(chan wsOutgoing, 4)}
+	stream, unsubscribe := context.WithCancel(ctx)
+	dropped := false
+	if !session.send(stream, WSResponse{Type: WSMessage, Topic: "dropped"}, func() { dropped = true }) {
+		t.Fatalf("send() on a running stream = false, want true")
+	}
+	unsubscribe()
+	if session.send(stream, WSResponse{Type: WSMessage, Topic: "dropped"}, nil) {
+		t.Errorf("send() on an ended stream = true, want false")
+	}
+	written := make(chan struct{})
+	session.send(ctx, WSResponse{Type: WSMessage, Topic: "kept"}, func() { close(written) })
+
+	stopped := make(chan struct{})
+	go func() {
+		session.writeLoop()
+		close(stopped)
+	}()
+	<-written
+	cancel()
+	<-stopped
+	if dropped {
+		t.Errorf("frame of the ended stream was written")
+	}
+	_, _, payload, rest := serverFrame(t, conn.written.Bytes())
+	var frame WSResponse
+	if err := json.Unmarshal(payload, &frame); err != nil || frame.Topic != "kept" || len(rest) != 0 {
+		t.Errorf("wrote %q then %d bytes, want only the kept frame", payload, len(rest))
+	}
+}